@@ -0,0 +1,522 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"tcpserver/protocol"
+	"time"
+)
+
+// DefaultMaxFrameSize is the maximum size of the frames read from the server, unless set in the Options
+const DefaultMaxFrameSize uint32 = 1 << 20
+
+var (
+	ErrClosed = errors.New("client closed")
+)
+
+// StatusError is returned when the server answers with a status other than protocol.StatusOK
+type StatusError struct {
+	Status uint16
+}
+
+func (se *StatusError) Error() string {
+	return fmt.Sprintf("server answered %s", protocol.StatusName(se.Status))
+}
+
+// Options configures the client. The zero value is a plain TCP client.
+type Options struct {
+	// TLSConfig is optional: when set, the connection is made over TLS
+	TLSConfig *tls.Config
+	// MaxFrameSize is the maximum size of the frames read from the server, DefaultMaxFrameSize if 0
+	MaxFrameSize uint32
+	// OnPush is optional: when set, it's called with the frames pushed by the server
+	// instead of sending them to Pushes. It must not block, nor make calls on the client.
+	OnPush func(protocol.Body)
+	// PushBuffer is the capacity of Pushes, 64 if 0
+	PushBuffer int
+	// PongTimeout is the maximum time to write the Pong answering a Ping of the server, 10s if 0
+	PongTimeout time.Duration
+}
+
+// Client speaks the chat protocol over a single connection. Its methods can be called concurrently:
+// each call gets its own correlationId, and waits for the answer carrying it.
+// A goroutine reads the frames from the server, answering its Pings on its own.
+type Client struct {
+	conn   net.Conn
+	opts   Options
+	pushes chan protocol.Body
+
+	writeMu sync.Mutex
+	lastID  atomic.Uint32
+
+	mu       sync.Mutex
+	pending  map[uint32]chan protocol.Body
+	username string
+	token    protocol.SessionToken
+	err      error
+	// version is the one negotiated with Hello, 0 until then; features are the ones it enabled
+	version  byte
+	features []string
+
+	// done gets closed when the connection can't be read anymore
+	done chan struct{}
+	// closing gets closed by Close, so that the pushes stop waiting to be drained
+	closing   chan struct{}
+	closeOnce sync.Once
+}
+
+// Dial connects to the server at the given address
+func Dial(ctx context.Context, address string, opts Options) (*Client, error) {
+
+	var conn net.Conn
+	var err error
+	if opts.TLSConfig != nil {
+		dialer := tls.Dialer{Config: opts.TLSConfig}
+		conn, err = dialer.DialContext(ctx, "tcp", address)
+	} else {
+		var dialer net.Dialer
+		conn, err = dialer.DialContext(ctx, "tcp", address)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return New(conn, opts), nil
+}
+
+// New returns a client speaking on a connection already established
+func New(conn net.Conn, opts Options) *Client {
+
+	if opts.MaxFrameSize == 0 {
+		opts.MaxFrameSize = DefaultMaxFrameSize
+	}
+	if opts.PushBuffer == 0 {
+		opts.PushBuffer = 64
+	}
+	if opts.PongTimeout == 0 {
+		opts.PongTimeout = 10 * time.Second
+	}
+
+	c := &Client{
+		conn:    conn,
+		opts:    opts,
+		pushes:  make(chan protocol.Body, opts.PushBuffer),
+		pending: make(map[uint32]chan protocol.Body),
+		done:    make(chan struct{}),
+		closing: make(chan struct{}),
+	}
+
+	go c.readLoop()
+
+	return c
+}
+
+// Pushes returns the frames pushed by the server: *protocol.Delivery, *protocol.ReplayDone
+// and *protocol.GoingAway, or *protocol.NumberedDelivery instead of *protocol.Delivery once
+// the "delivery-acks" feature is enabled with Hello. It gets closed with the connection.
+// Unless Options.OnPush is set, it must be drained: the answers to the calls are read after the pushes.
+func (c *Client) Pushes() <-chan protocol.Body {
+	return c.pushes
+}
+
+// Done gets closed when the connection can't be read anymore, see Err
+func (c *Client) Done() <-chan struct{} {
+	return c.done
+}
+
+// Err returns why the connection can't be read anymore, nil while it can
+func (c *Client) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.err
+}
+
+// Username returns the user logged in by the last successful login, empty if none
+func (c *Client) Username() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.username
+}
+
+// SessionToken returns the token received after the last successful login, to resume the session
+// with protocol.Resume on a new connection. It's empty unless the session-tokens feature was
+// enabled with Hello before logging in, and the server issues tokens.
+// The server sends it right after the response to the login, so it's set before the answer to any later call.
+func (c *Client) SessionToken() (string, time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.token.Token, c.token.ExpiresAt
+}
+
+// Close closes the connection, failing the calls still waiting for their answer
+func (c *Client) Close() error {
+	c.closeOnce.Do(func() { close(c.closing) })
+
+	err := c.conn.Close()
+	<-c.done
+	return err
+}
+
+// Login logs in a user on their username alone, which the server accepts only if it allows passwordless logins
+func (c *Client) Login(ctx context.Context, username string) error {
+	return c.login(ctx, username, &protocol.Login{Username: username})
+}
+
+// LoginWithPassword logs in a user created by Register
+func (c *Client) LoginWithPassword(ctx context.Context, username string, password string) error {
+	return c.login(ctx, username, &protocol.LoginV2{Username: username, Password: password})
+}
+
+// Register creates a user who logs in with LoginWithPassword. It doesn't log the user in.
+func (c *Client) Register(ctx context.Context, username string, password string) error {
+	_, err := c.Do(ctx, &protocol.Register{Username: username, Password: password})
+	return err
+}
+
+func (c *Client) login(ctx context.Context, username string, body protocol.Body) error {
+
+	_, err := c.Do(ctx, body)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.username = username
+	return nil
+}
+
+// Hello negotiates the version of the protocol and the optional features of the connection,
+// e.g. "delivery-acks". The frames written afterwards carry the version chosen by the server.
+// It must be used instead of sending a protocol.Hello with Do, which wouldn't switch the version.
+func (c *Client) Hello(ctx context.Context, versions []byte, features []string) (*protocol.HelloResult, error) {
+
+	resp, err := c.Do(ctx, &protocol.Hello{Versions: versions, Features: features})
+	if err != nil {
+		return nil, err
+	}
+
+	var result protocol.HelloResult
+	err = result.Decode(bytes.NewReader(resp.Body))
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.version = result.Version
+	c.features = result.Features
+	return &result, nil
+}
+
+// Version returns the version of the protocol spoken on the connection:
+// the one negotiated with Hello, protocol.Version1 until then
+func (c *Client) Version() byte {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.version == 0 {
+		return protocol.Version1
+	}
+	return c.version
+}
+
+// HasFeature tells if the optional feature has been enabled with Hello
+func (c *Client) HasFeature(feature string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return slices.Contains(c.features, feature)
+}
+
+// Send sends a message from the user logged in to another one
+func (c *Client) Send(ctx context.Context, to string, message string) error {
+
+	// from version 0x02, the sender is always the user logged in on the connection
+	now := time.Now()
+	var body protocol.Body = &protocol.Message{Message: message, From: c.Username(), To: to, Timestamp: now}
+	if c.Version() >= protocol.Version2 {
+		body = &protocol.MessageV2{Message: message, To: to, Timestamp: now}
+	}
+
+	_, err := c.Do(ctx, body)
+	return err
+}
+
+// Logout logs out the user logged in. The connection stays open, to log in again.
+func (c *Client) Logout(ctx context.Context) error {
+
+	_, err := c.Do(ctx, &protocol.Logout{})
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.username = ""
+	c.token = protocol.SessionToken{}
+	return nil
+}
+
+// ListUsers returns a page of the known users, see protocol.ListUsers
+func (c *Client) ListUsers(ctx context.Context, query protocol.ListUsers) (*protocol.ListUsersResult, error) {
+
+	resp, err := c.Do(ctx, &query)
+	if err != nil {
+		return nil, err
+	}
+
+	var result protocol.ListUsersResult
+	err = result.Decode(bytes.NewReader(resp.Body))
+	if err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+// Ping checks that the server is alive, returning the round trip time
+func (c *Client) Ping(ctx context.Context) (time.Duration, error) {
+
+	start := time.Now()
+	_, err := c.call(ctx, &protocol.Ping{})
+	if err != nil {
+		return 0, err
+	}
+
+	return time.Since(start), nil
+}
+
+// Ack acknowledges the numbered deliveries received, up to the one with the given sequence,
+// so that the server doesn't deliver them again. The server doesn't answer it.
+func (c *Client) Ack(ctx context.Context, sequence uint64) error {
+
+	c.mu.Lock()
+	err := c.err
+	c.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	return c.write(ctx, c.nextID(), &protocol.Ack{Sequence: sequence})
+}
+
+// Do sends a frame and waits for the response carrying its correlationId, or for the context to be done.
+// A response with a status other than OK is returned along with a *StatusError,
+// since some of them have a body too, e.g. the unreached recipients of a MultiMessage.
+func (c *Client) Do(ctx context.Context, body protocol.Body) (*protocol.Response, error) {
+
+	answer, err := c.call(ctx, body)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, ok := answer.(*protocol.Response)
+	if !ok {
+		return nil, fmt.Errorf("%w: expected a response, got code 0x%02X", protocol.ErrUnknownFrame, answer.Code())
+	}
+	if resp.Status != protocol.StatusOK {
+		return resp, &StatusError{Status: resp.Status}
+	}
+
+	return resp, nil
+}
+
+// call sends a frame and waits for the frame answering it
+func (c *Client) call(ctx context.Context, body protocol.Body) (protocol.Body, error) {
+
+	id := c.nextID()
+	answer := make(chan protocol.Body, 1)
+
+	c.mu.Lock()
+	if c.err != nil {
+		c.mu.Unlock()
+		return nil, c.err
+	}
+	c.pending[id] = answer
+	c.mu.Unlock()
+
+	defer func() {
+		c.mu.Lock()
+		delete(c.pending, id)
+		c.mu.Unlock()
+	}()
+
+	err := c.write(ctx, id, body)
+	if err != nil {
+		return nil, err
+	}
+
+	select {
+	case a := <-answer:
+		return a, nil
+	case <-c.done:
+		return nil, c.Err()
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// nextID returns the next correlationId, skipping 0 which is carried by the frames pushed by the server
+func (c *Client) nextID() uint32 {
+	for {
+		id := c.lastID.Add(1)
+		if id != 0 {
+			return id
+		}
+	}
+}
+
+// write sends a frame, until the deadline of the context or until it gets cancelled.
+// A frame interrupted midway would leave the stream out of sync, so a failed write closes the connection.
+func (c *Client) write(ctx context.Context, correlationID uint32, body protocol.Body) error {
+
+	var frame bytes.Buffer
+	err := protocol.WriteFrame(&frame, c.Version(), correlationID, body)
+	if err != nil {
+		return err
+	}
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	deadline, _ := ctx.Deadline()
+	err = c.conn.SetWriteDeadline(deadline)
+	if err != nil {
+		return err
+	}
+
+	// the cancellation moves the deadline to now, which unblocks the write
+	interrupted := make(chan struct{})
+	stop := context.AfterFunc(ctx, func() {
+		defer close(interrupted)
+		_ = c.conn.SetWriteDeadline(time.Now())
+	})
+
+	_, err = c.conn.Write(frame.Bytes())
+
+	if !stop() {
+		<-interrupted
+	}
+	if err == nil {
+		return nil
+	}
+
+	switch {
+	case c.isClosing():
+		err = ErrClosed
+	case ctx.Err() != nil:
+		err = ctx.Err()
+	case errors.Is(err, os.ErrDeadlineExceeded):
+		// the deadline of the connection, which is the one of the context, may expire first
+		err = context.DeadlineExceeded
+	}
+	c.fail(err)
+	return err
+}
+
+func (c *Client) isClosing() bool {
+	select {
+	case <-c.closing:
+		return true
+	default:
+		return false
+	}
+}
+
+// fail records why the connection is unusable, unless it's already known, and closes it
+func (c *Client) fail(err error) {
+	c.mu.Lock()
+	if c.err == nil {
+		c.err = err
+	}
+	c.mu.Unlock()
+
+	_ = c.conn.Close()
+}
+
+func (c *Client) readLoop() {
+
+	err := c.read()
+
+	if c.isClosing() {
+		err = ErrClosed
+	}
+
+	c.mu.Lock()
+	if c.err == nil {
+		c.err = err
+	}
+	c.mu.Unlock()
+
+	close(c.done)
+	close(c.pushes)
+}
+
+func (c *Client) read() error {
+	for {
+		header, body, err := protocol.ReadFrame(c.conn, c.opts.MaxFrameSize)
+		if errors.Is(err, protocol.ErrUnknownFrame) {
+			// the frame has been read as a whole, so the next one can still be read
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		switch b := body.(type) {
+		case *protocol.Ping:
+			// the reading waits for the Pong to be written, so it must not wait for long
+			ctx, cancel := context.WithTimeout(context.Background(), c.opts.PongTimeout)
+			err = c.write(ctx, header.CorrelationID, &protocol.Pong{})
+			cancel()
+			if err != nil {
+				return err
+			}
+		case *protocol.SessionToken:
+			c.mu.Lock()
+			c.token = *b
+			c.mu.Unlock()
+		case *protocol.Response, *protocol.Pong:
+			c.answer(header.CorrelationID, body)
+		default:
+			c.push(body)
+		}
+	}
+}
+
+// answer hands the frame to the call waiting for it, if it's still waiting
+func (c *Client) answer(correlationID uint32, body protocol.Body) {
+	c.mu.Lock()
+	answer, ok := c.pending[correlationID]
+	delete(c.pending, correlationID)
+	c.mu.Unlock()
+
+	if ok {
+		answer <- body
+	}
+}
+
+func (c *Client) push(body protocol.Body) {
+	if c.opts.OnPush != nil {
+		c.opts.OnPush(body)
+		return
+	}
+	select {
+	case c.pushes <- body:
+	case <-c.closing:
+	}
+}
@@ -0,0 +1,332 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"tcpserver/protocol"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeServer answers the frames read from the client with the frames returned by handle
+type fakeServer struct {
+	t    *testing.T
+	conn net.Conn
+}
+
+type reply struct {
+	correlationID uint32
+	body          protocol.Body
+}
+
+func newTestClient(t *testing.T, opts Options) (*Client, *fakeServer) {
+	clientConn, serverConn := net.Pipe()
+
+	c := New(clientConn, opts)
+	t.Cleanup(func() {
+		_ = c.Close()
+		_ = serverConn.Close()
+	})
+
+	return c, &fakeServer{t: t, conn: serverConn}
+}
+
+// serve answers each frame read with the replies returned by handle, until the connection gets closed
+func (fs *fakeServer) serve(handle func(header protocol.Header, body protocol.Body) []reply) {
+	go func() {
+		for {
+			header, body, err := protocol.ReadFrame(fs.conn, DefaultMaxFrameSize)
+			if err != nil {
+				return
+			}
+			for _, r := range handle(header, body) {
+				fs.write(r.correlationID, r.body)
+			}
+		}
+	}()
+}
+
+func (fs *fakeServer) write(correlationID uint32, body protocol.Body) {
+	_ = protocol.WriteFrame(fs.conn, protocol.Version1, correlationID, body)
+}
+
+func ok(header protocol.Header) []reply {
+	return []reply{{header.CorrelationID, &protocol.Response{Status: protocol.StatusOK, Body: []byte{}}}}
+}
+
+func Test_Client_Calls(t *testing.T) {
+	c, fs := newTestClient(t, Options{})
+
+	var mu sync.Mutex
+	var received []protocol.Body
+	fs.serve(func(header protocol.Header, body protocol.Body) []reply {
+		mu.Lock()
+		defer mu.Unlock()
+		received = append(received, body)
+
+		switch b := body.(type) {
+		case *protocol.Login:
+			return append(ok(header), reply{header.CorrelationID, &protocol.SessionToken{
+				Token:     "token",
+				ExpiresAt: time.Unix(1735689600, 0),
+			}})
+		case *protocol.Message:
+			if b.To == "nobody" {
+				return []reply{{header.CorrelationID, &protocol.Response{Status: protocol.StatusUserNotFound}}}
+			}
+			return ok(header)
+		case *protocol.ListUsers:
+			var result bytes.Buffer
+			_ = (&protocol.ListUsersResult{Users: []protocol.UserStatus{{Username: "alice", Online: true}}}).Encode(&result)
+			return []reply{{header.CorrelationID, &protocol.Response{Status: protocol.StatusOK, Body: result.Bytes()}}}
+		case *protocol.Ping:
+			return []reply{{header.CorrelationID, &protocol.Pong{}}}
+		default:
+			return ok(header)
+		}
+	})
+	ctx := context.Background()
+
+	require.NoError(t, c.Login(ctx, "alice"))
+	assert.Equal(t, "alice", c.Username())
+
+	require.NoError(t, c.Send(ctx, "bob", "Hi"))
+	token, expiresAt := c.SessionToken()
+	assert.Equal(t, "token", token)
+	assert.Equal(t, time.Unix(1735689600, 0), expiresAt)
+
+	err := c.Send(ctx, "nobody", "Hi")
+	assert.Equal(t, &StatusError{Status: protocol.StatusUserNotFound}, err)
+	assert.EqualError(t, err, "server answered user_not_found")
+
+	users, err := c.ListUsers(ctx, protocol.ListUsers{Prefix: "a"})
+	require.NoError(t, err)
+	assert.Equal(t, []protocol.UserStatus{{Username: "alice", Online: true}}, users.Users)
+
+	_, err = c.Ping(ctx)
+	require.NoError(t, err)
+
+	require.NoError(t, c.Logout(ctx))
+	assert.Equal(t, "", c.Username())
+	token, _ = c.SessionToken()
+	assert.Equal(t, "", token)
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.Len(t, received, 6)
+	assert.Equal(t, &protocol.Login{Username: "alice"}, received[0])
+	sent, isMessage := received[1].(*protocol.Message)
+	require.True(t, isMessage)
+	assert.Equal(t, "alice", sent.From)
+	assert.Equal(t, "bob", sent.To)
+	assert.Equal(t, "Hi", sent.Message)
+	assert.Equal(t, &protocol.Logout{}, received[5])
+}
+
+func Test_Client_Hello(t *testing.T) {
+	c, fs := newTestClient(t, Options{})
+
+	headers := make(chan protocol.Header, 3)
+	bodies := make(chan protocol.Body, 3)
+	fs.serve(func(header protocol.Header, body protocol.Body) []reply {
+		headers <- header
+		bodies <- body
+
+		switch body.(type) {
+		case *protocol.Hello:
+			var result bytes.Buffer
+			_ = (&protocol.HelloResult{Version: protocol.Version2, Features: []string{"delivery-acks"}}).Encode(&result)
+			return []reply{{header.CorrelationID, &protocol.Response{Status: protocol.StatusOK, Body: result.Bytes()}}}
+		case *protocol.Pong:
+			return nil
+		default:
+			return ok(header)
+		}
+	})
+	ctx := context.Background()
+
+	result, err := c.Hello(ctx, []byte{protocol.Version1, protocol.Version2}, []string{"delivery-acks", "session-tokens"})
+
+	require.NoError(t, err)
+	assert.Equal(t, &protocol.HelloResult{Version: protocol.Version2, Features: []string{"delivery-acks"}}, result)
+	assert.Equal(t, protocol.Version2, c.Version())
+	assert.True(t, c.HasFeature("delivery-acks"))
+	assert.False(t, c.HasFeature("session-tokens"))
+	assert.Equal(t, protocol.Version1, (<-headers).Version)
+	<-bodies
+
+	// the frames following it carry the version chosen, the Pongs included
+	require.NoError(t, c.Send(ctx, "bob", "Hi"))
+	assert.Equal(t, protocol.Version2, (<-headers).Version)
+	sent, isMessageV2 := (<-bodies).(*protocol.MessageV2)
+	require.True(t, isMessageV2)
+	assert.Equal(t, "bob", sent.To)
+	assert.Equal(t, "Hi", sent.Message)
+
+	fs.write(42, &protocol.Ping{})
+	assert.Equal(t, protocol.Header{Version: protocol.Version2, Code: protocol.CodePong, CorrelationID: 42}, <-headers)
+}
+
+func Test_Client_MatchesResponsesByCorrelationID(t *testing.T) {
+	c, fs := newTestClient(t, Options{})
+
+	// the server holds the first two messages, then answers them in reverse order, with different statuses
+	held := make(chan protocol.Header, 2)
+	fs.serve(func(header protocol.Header, body protocol.Body) []reply {
+		held <- header
+		if len(held) < 2 {
+			return nil
+		}
+		first, second := <-held, <-held
+		return []reply{
+			{second.CorrelationID, &protocol.Response{Status: protocol.StatusMailboxFull}},
+			{first.CorrelationID, &protocol.Response{Status: protocol.StatusUserNotFound}},
+		}
+	})
+
+	errs := make(map[string]error)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, to := range []string{"bob", "carol"} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := c.Send(context.Background(), to, "Hi")
+			mu.Lock()
+			errs[to] = err
+			mu.Unlock()
+		}()
+		// the first message is sent before the second one
+		time.Sleep(20 * time.Millisecond)
+	}
+	wg.Wait()
+
+	assert.Equal(t, &StatusError{Status: protocol.StatusUserNotFound}, errs["bob"])
+	assert.Equal(t, &StatusError{Status: protocol.StatusMailboxFull}, errs["carol"])
+}
+
+func Test_Client_Pushes(t *testing.T) {
+	delivery := &protocol.Delivery{Message: "Hi", From: "alice", To: "bob", Timestamp: time.Unix(1735689600, 0)}
+
+	t.Run("channel", func(t *testing.T) {
+		c, fs := newTestClient(t, Options{})
+
+		go func() {
+			fs.write(0, delivery)
+			fs.write(0, &protocol.ReplayDone{Count: 1})
+		}()
+
+		assert.Equal(t, delivery, <-c.Pushes())
+		assert.Equal(t, &protocol.ReplayDone{Count: 1}, <-c.Pushes())
+	})
+
+	t.Run("callback", func(t *testing.T) {
+		pushed := make(chan protocol.Body, 1)
+		c, fs := newTestClient(t, Options{OnPush: func(body protocol.Body) { pushed <- body }})
+
+		go fs.write(0, delivery)
+
+		assert.Equal(t, delivery, <-pushed)
+		assert.Empty(t, c.Pushes())
+	})
+}
+
+func Test_Client_AnswersPings(t *testing.T) {
+	_, fs := newTestClient(t, Options{})
+
+	go fs.write(42, &protocol.Ping{})
+
+	header, body, err := protocol.ReadFrame(fs.conn, DefaultMaxFrameSize)
+
+	require.NoError(t, err)
+	assert.Equal(t, protocol.Header{Version: protocol.Version1, Code: protocol.CodePong, CorrelationID: 42}, header)
+	assert.Equal(t, &protocol.Pong{}, body)
+}
+
+func Test_Client_Ack(t *testing.T) {
+	c, fs := newTestClient(t, Options{})
+
+	ack := make(chan error, 1)
+	go func() {
+		ack <- c.Ack(context.Background(), 3)
+	}()
+
+	header, body, err := protocol.ReadFrame(fs.conn, DefaultMaxFrameSize)
+
+	require.NoError(t, err)
+	assert.Equal(t, protocol.CodeAck, header.Code)
+	assert.Equal(t, &protocol.Ack{Sequence: 3}, body)
+	assert.NoError(t, <-ack)
+}
+
+func Test_Client_Timeout(t *testing.T) {
+	c, fs := newTestClient(t, Options{})
+
+	// the server reads the frames but never answers
+	fs.serve(func(protocol.Header, protocol.Body) []reply { return nil })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	err := c.Send(ctx, "bob", "Hi")
+
+	assert.Equal(t, context.DeadlineExceeded, err)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	assert.Empty(t, c.pending)
+}
+
+func Test_Client_Close(t *testing.T) {
+	c, fs := newTestClient(t, Options{})
+	fs.serve(func(protocol.Header, protocol.Body) []reply { return nil })
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- c.Send(context.Background(), "bob", "Hi")
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	require.NoError(t, c.Close())
+
+	assert.Equal(t, ErrClosed, <-errs)
+	assert.Equal(t, ErrClosed, c.Err())
+	assert.Equal(t, ErrClosed, c.Send(context.Background(), "bob", "Hi"))
+	_, open := <-c.Pushes()
+	assert.False(t, open)
+}
+
+func Test_Client_CancelledWrite(t *testing.T) {
+	// the server never reads, so the write blocks: only the cancellation can interrupt it
+	c, _ := newTestClient(t, Options{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	err := c.Send(ctx, "bob", "Hi")
+
+	assert.Equal(t, context.Canceled, err)
+	// the frame may have been partly written, so the connection can't be used anymore
+	<-c.Done()
+	assert.Equal(t, context.Canceled, c.Err())
+	assert.Equal(t, context.Canceled, c.Send(context.Background(), "bob", "Hi"))
+}
+
+func Test_Client_PongTimeout(t *testing.T) {
+	c, fs := newTestClient(t, Options{PongTimeout: 50 * time.Millisecond})
+
+	// the server sends a Ping but never reads the Pong
+	go fs.write(42, &protocol.Ping{})
+
+	select {
+	case <-c.Done():
+	case <-time.After(time.Second):
+		require.Fail(t, "the client still waits for the Pong to be written")
+	}
+	assert.ErrorIs(t, c.Err(), context.DeadlineExceeded)
+}
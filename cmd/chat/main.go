@@ -0,0 +1,294 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"tcpserver/client"
+	"tcpserver/protocol"
+	"time"
+)
+
+const help = `commands:
+  /msg <user> <text>  send a message to a user
+  /users [prefix]     list the known users, and whether they are online
+  /logout             log out and quit
+  /quit               quit without logging out
+  /help               show this help`
+
+// errPasswordlessRefused is returned when the user logs in on their username alone, but the server doesn't allow it
+var errPasswordlessRefused = errors.New("the server refuses the logins without a password: set -password, or start it with -allow-passwordless-login")
+
+type options struct {
+	address   string
+	username  string
+	password  string
+	register  bool
+	tls       bool
+	tlsCAFile string
+	timeout   time.Duration
+}
+
+func main() {
+
+	var opts options
+	fs := flag.NewFlagSet("chat", flag.ContinueOnError)
+	fs.StringVar(&opts.address, "address", "localhost:5555", "address of the chat server")
+	fs.StringVar(&opts.username, "username", "", "user to log in, asked on start if empty")
+	fs.StringVar(&opts.password, "password", os.Getenv("CHAT_PASSWORD"), "password of the user, empty to log in on the username alone if the server allows it with -allow-passwordless-login (default $CHAT_PASSWORD)")
+	fs.BoolVar(&opts.register, "register", false, "create the user with the password before logging in")
+	fs.BoolVar(&opts.tls, "tls", false, "connect over TLS")
+	fs.StringVar(&opts.tlsCAFile, "tls-ca-file", "", "PEM CAs to verify the certificate of the server with, instead of the ones of the system")
+	fs.DurationVar(&opts.timeout, "timeout", 5*time.Second, "maximum time to wait for the answer to a command")
+
+	err := fs.Parse(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		os.Exit(2)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	err = run(ctx, opts, os.Stdin, os.Stdout)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// printer writes the lines on the output, from both the prompt and the pushes of the server
+type printer struct {
+	mu  sync.Mutex
+	out io.Writer
+}
+
+func (p *printer) printf(format string, args ...any) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	fmt.Fprintf(p.out, format+"\n", args...)
+}
+
+func run(ctx context.Context, opts options, in io.Reader, out io.Writer) error {
+
+	p := &printer{out: out}
+
+	lines := make(chan string)
+	go func() {
+		defer close(lines)
+		scanner := bufio.NewScanner(in)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+	}()
+
+	if opts.username == "" {
+		p.printf("username:")
+		select {
+		case line, ok := <-lines:
+			if !ok {
+				return nil
+			}
+			opts.username = strings.TrimSpace(line)
+		case <-ctx.Done():
+			return nil
+		}
+	}
+
+	clientOpts := client.Options{}
+	if opts.tls {
+		tlsConfig, err := newTLSConfig(opts.tlsCAFile)
+		if err != nil {
+			return err
+		}
+		clientOpts.TLSConfig = tlsConfig
+	}
+
+	dialCtx, cancel := context.WithTimeout(ctx, opts.timeout)
+	defer cancel()
+
+	c, err := client.Dial(dialCtx, opts.address, clientOpts)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	go showPushes(c, p)
+
+	err = login(ctx, c, opts)
+	if err != nil {
+		return fmt.Errorf("logging in as %q: %w", opts.username, err)
+	}
+	p.printf("logged in as %s, /help lists the commands", opts.username)
+
+	for {
+		select {
+		case line, ok := <-lines:
+			if !ok {
+				return nil
+			}
+			quit := execute(ctx, c, p, opts.timeout, strings.TrimSpace(line))
+			if quit {
+				return nil
+			}
+		case <-c.Done():
+			p.printf("connection closed: %v", c.Err())
+			return nil
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+func newTLSConfig(caFile string) (*tls.Config, error) {
+
+	if caFile == "" {
+		return &tls.Config{}, nil
+	}
+
+	pem, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, err
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificate found in %s", caFile)
+	}
+
+	return &tls.Config{RootCAs: pool}, nil
+}
+
+func login(ctx context.Context, c *client.Client, opts options) error {
+
+	ctx, cancel := context.WithTimeout(ctx, opts.timeout)
+	defer cancel()
+
+	if opts.password == "" {
+		err := c.Login(ctx, opts.username)
+		var se *client.StatusError
+		if errors.As(err, &se) && se.Status == protocol.StatusNotAllowed {
+			err = fmt.Errorf("%w: %w", errPasswordlessRefused, err)
+		}
+		return err
+	}
+
+	if opts.register {
+		err := c.Register(ctx, opts.username, opts.password)
+		if err != nil {
+			return err
+		}
+	}
+
+	return c.LoginWithPassword(ctx, opts.username, opts.password)
+}
+
+// showPushes prints the frames pushed by the server, until the connection gets closed
+func showPushes(c *client.Client, p *printer) {
+	for push := range c.Pushes() {
+		switch f := push.(type) {
+		case *protocol.Delivery:
+			p.printf("[%s] %s: %s", f.Timestamp.Local().Format(time.TimeOnly), f.From, f.Message)
+		case *protocol.ReplayDone:
+			if f.Count > 0 {
+				p.printf("(%d messages received while offline)", f.Count)
+			}
+		case *protocol.GoingAway:
+			p.printf("the server is shutting down")
+		}
+	}
+}
+
+// execute runs a command typed by the user, returning true if the chat must quit
+func execute(ctx context.Context, c *client.Client, p *printer, timeout time.Duration, line string) bool {
+
+	if line == "" {
+		return false
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	command, args, _ := strings.Cut(line, " ")
+	switch command {
+	case "/msg":
+		to, text, _ := strings.Cut(strings.TrimSpace(args), " ")
+		if to == "" || text == "" {
+			p.printf("usage: /msg <user> <text>")
+			return false
+		}
+		err := c.Send(ctx, to, text)
+		if err != nil {
+			p.printf("message to %s not sent: %v", to, err)
+		}
+
+	case "/users":
+		err := listUsers(ctx, c, p, strings.TrimSpace(args))
+		if err != nil {
+			p.printf("users not listed: %v", err)
+		}
+
+	case "/logout":
+		err := c.Logout(ctx)
+		if err != nil {
+			p.printf("not logged out: %v", err)
+			return false
+		}
+		p.printf("logged out")
+		return true
+
+	case "/quit":
+		return true
+
+	case "/help":
+		p.printf(help)
+
+	default:
+		p.printf("unknown command %q, /help lists the commands", command)
+	}
+
+	return false
+}
+
+// listUsers prints all the users whose username starts with the prefix, going through all the pages
+func listUsers(ctx context.Context, c *client.Client, p *printer, prefix string) error {
+
+	query := protocol.ListUsers{Prefix: prefix}
+	count := 0
+	for {
+		page, err := c.ListUsers(ctx, query)
+		if err != nil {
+			return err
+		}
+
+		for _, user := range page.Users {
+			status := "offline"
+			if user.Online {
+				status = "online"
+			}
+			p.printf("  %s (%s)", user.Username, status)
+		}
+		count += len(page.Users)
+
+		if page.NextCursor == "" {
+			break
+		}
+		query.Cursor = page.NextCursor
+	}
+
+	p.printf("%d users", count)
+	return nil
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"tcpserver/client"
+	"tcpserver/protocol"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeServer answers each frame read from the client with the response returned by handle,
+// recording the frames
+type fakeServer struct {
+	mu       sync.Mutex
+	received []protocol.Body
+}
+
+func newTestClient(t *testing.T, handle func(body protocol.Body) *protocol.Response) (*client.Client, *fakeServer) {
+	clientConn, serverConn := net.Pipe()
+	fs := &fakeServer{}
+
+	go func() {
+		for {
+			header, body, err := protocol.ReadFrame(serverConn, client.DefaultMaxFrameSize)
+			if err != nil {
+				return
+			}
+			fs.mu.Lock()
+			fs.received = append(fs.received, body)
+			fs.mu.Unlock()
+
+			_ = protocol.WriteFrame(serverConn, protocol.Version1, header.CorrelationID, handle(body))
+		}
+	}()
+
+	c := client.New(clientConn, client.Options{})
+	t.Cleanup(func() {
+		_ = c.Close()
+		_ = serverConn.Close()
+	})
+
+	return c, fs
+}
+
+func (fs *fakeServer) frames() []protocol.Body {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	return fs.received
+}
+
+func okResponse() *protocol.Response {
+	return &protocol.Response{Status: protocol.StatusOK, Body: []byte{}}
+}
+
+// usersPage encodes a page of ListUsersResult
+func usersPage(nextCursor string, users ...protocol.UserStatus) *protocol.Response {
+	var body bytes.Buffer
+	_ = (&protocol.ListUsersResult{Users: users, NextCursor: nextCursor}).Encode(&body)
+	return &protocol.Response{Status: protocol.StatusOK, Body: body.Bytes()}
+}
+
+func Test_execute(t *testing.T) {
+	tests := []struct {
+		name       string
+		line       string
+		handle     func(body protocol.Body) *protocol.Response
+		wantQuit   bool
+		wantOutput string
+		wantFrames []protocol.Body
+	}{
+		{
+			name:       "message",
+			line:       "/msg bob Hi there",
+			wantFrames: []protocol.Body{&protocol.Message{Message: "Hi there", To: "bob"}},
+		},
+		{
+			name:       "message without a text",
+			line:       "/msg bob",
+			wantOutput: "usage: /msg <user> <text>\n",
+		},
+		{
+			name: "message refused: the status is shown by name",
+			line: "/msg nobody Hi",
+			handle: func(protocol.Body) *protocol.Response {
+				return &protocol.Response{Status: protocol.StatusUserNotFound}
+			},
+			wantOutput: "message to nobody not sent: server answered user_not_found\n",
+			wantFrames: []protocol.Body{&protocol.Message{Message: "Hi", To: "nobody"}},
+		},
+		{
+			name: "users, going through the pages",
+			line: "/users a",
+			handle: func(body protocol.Body) *protocol.Response {
+				if body.(*protocol.ListUsers).Cursor == "" {
+					return usersPage("alice", protocol.UserStatus{Username: "alice", Online: true})
+				}
+				return usersPage("", protocol.UserStatus{Username: "anna"})
+			},
+			wantOutput: "  alice (online)\n  anna (offline)\n2 users\n",
+			wantFrames: []protocol.Body{
+				&protocol.ListUsers{Prefix: "a"},
+				&protocol.ListUsers{Prefix: "a", Cursor: "alice"},
+			},
+		},
+		{
+			name: "users refused",
+			line: "/users",
+			handle: func(protocol.Body) *protocol.Response {
+				return &protocol.Response{Status: protocol.StatusNotAllowed}
+			},
+			wantOutput: "users not listed: server answered not_allowed\n",
+			wantFrames: []protocol.Body{&protocol.ListUsers{}},
+		},
+		{
+			name:       "logout",
+			line:       "/logout",
+			wantQuit:   true,
+			wantOutput: "logged out\n",
+			wantFrames: []protocol.Body{&protocol.Logout{}},
+		},
+		{
+			name: "logout refused: the chat goes on",
+			line: "/logout",
+			handle: func(protocol.Body) *protocol.Response {
+				return &protocol.Response{Status: protocol.StatusInternalError}
+			},
+			wantOutput: "not logged out: server answered internal_error\n",
+			wantFrames: []protocol.Body{&protocol.Logout{}},
+		},
+		{
+			name:     "quit",
+			line:     "/quit",
+			wantQuit: true,
+		},
+		{
+			name:       "help",
+			line:       "/help",
+			wantOutput: help + "\n",
+		},
+		{
+			name:       "unknown command",
+			line:       "/whisper bob",
+			wantOutput: "unknown command \"/whisper\", /help lists the commands\n",
+		},
+		{
+			name: "empty line",
+			line: "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			handle := tt.handle
+			if handle == nil {
+				handle = func(protocol.Body) *protocol.Response { return okResponse() }
+			}
+			c, fs := newTestClient(t, handle)
+			var out strings.Builder
+
+			quit := execute(context.Background(), c, &printer{out: &out}, time.Second, tt.line)
+
+			assert.Equal(t, tt.wantQuit, quit)
+			assert.Equal(t, tt.wantOutput, out.String())
+
+			frames := fs.frames()
+			require.Len(t, frames, len(tt.wantFrames))
+			for i, want := range tt.wantFrames {
+				// the timestamp of the messages is the time they are sent
+				if msg, ok := frames[i].(*protocol.Message); ok {
+					msg.Timestamp = time.Time{}
+				}
+				assert.Equal(t, want, frames[i])
+			}
+		})
+	}
+}
+
+func Test_login(t *testing.T) {
+	tests := []struct {
+		name       string
+		opts       options
+		status     uint16
+		wantErr    string
+		wantFrames []protocol.Body
+	}{
+		{
+			name:       "passwordless",
+			opts:       options{username: "alice"},
+			status:     protocol.StatusOK,
+			wantFrames: []protocol.Body{&protocol.Login{Username: "alice"}},
+		},
+		{
+			name:       "passwordless refused by the server",
+			opts:       options{username: "alice"},
+			status:     protocol.StatusNotAllowed,
+			wantErr:    errPasswordlessRefused.Error() + ": server answered not_allowed",
+			wantFrames: []protocol.Body{&protocol.Login{Username: "alice"}},
+		},
+		{
+			name:   "registering first",
+			opts:   options{username: "alice", password: "secret", register: true},
+			status: protocol.StatusOK,
+			wantFrames: []protocol.Body{
+				&protocol.Register{Username: "alice", Password: "secret"},
+				&protocol.LoginV2{Username: "alice", Password: "secret"},
+			},
+		},
+		{
+			name:       "with a password",
+			opts:       options{username: "alice", password: "secret"},
+			status:     protocol.StatusBadCredentials,
+			wantErr:    "server answered bad_credentials",
+			wantFrames: []protocol.Body{&protocol.LoginV2{Username: "alice", Password: "secret"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			c, fs := newTestClient(t, func(protocol.Body) *protocol.Response {
+				return &protocol.Response{Status: tt.status, Body: []byte{}}
+			})
+			tt.opts.timeout = time.Second
+
+			err := login(context.Background(), c, tt.opts)
+
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tt.wantFrames, fs.frames())
+		})
+	}
+}
@@ -0,0 +1,339 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math/rand/v2"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"tcpserver/client"
+	"tcpserver/protocol"
+	"time"
+)
+
+// errPasswordlessRefused is returned when the users log in on their username alone, but the server doesn't allow it
+var errPasswordlessRefused = errors.New("the server refuses the logins without a password: set -password, or start it with -allow-passwordless-login")
+
+type options struct {
+	address     string
+	connections int
+	rate        float64
+	sizes       string
+	duration    time.Duration
+	timeout     time.Duration
+	maxInflight int
+	drain       time.Duration
+	userPrefix  string
+	password    string
+}
+
+func main() {
+
+	var opts options
+	fs := flag.NewFlagSet("chatbench", flag.ContinueOnError)
+	fs.StringVar(&opts.address, "address", "localhost:5555", "address of the chat server")
+	fs.IntVar(&opts.connections, "connections", 100, "number of connections, each logging in its own user")
+	fs.Float64Var(&opts.rate, "rate", 1000, "messages sent per second over all the connections, 0 to send each message as soon as the previous one on its connection is answered")
+	fs.StringVar(&opts.sizes, "sizes", "64", "sizes of the messages in bytes: a fixed size (64), a range picked uniformly (16-256), or sizes with their weight (64:9,4096:1)")
+	fs.DurationVar(&opts.duration, "duration", 10*time.Second, "time spent sending messages")
+	fs.DurationVar(&opts.timeout, "timeout", 5*time.Second, "maximum time to wait for the response to a message, or to a login")
+	fs.IntVar(&opts.maxInflight, "max-inflight", 100, "maximum number of messages waiting for their response per connection, the messages beyond it are skipped")
+	fs.DurationVar(&opts.drain, "drain", 2*time.Second, "maximum time to wait for the deliveries after the last response")
+	fs.StringVar(&opts.userPrefix, "user-prefix", "bench", "prefix of the usernames, followed by the number of the connection")
+	fs.StringVar(&opts.password, "password", "", "password the users are registered and logged in with, empty to log them in on their username alone (the server must allow it with -allow-passwordless-login)")
+
+	err := fs.Parse(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		os.Exit(2)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	err = run(ctx, opts, os.Stdout)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// bench holds the state shared by the connections during the run
+type bench struct {
+	opts      options
+	sizes     sizes
+	payload   string
+	usernames []string
+	clients   []*client.Client
+	stats     *stats
+	// start is when the run started: the deliveries of messages sent before it, by a previous run, are left out
+	start time.Time
+}
+
+func run(ctx context.Context, opts options, out io.Writer) error {
+
+	if opts.connections <= 0 {
+		return fmt.Errorf("invalid connections %d: must be positive", opts.connections)
+	}
+	if opts.rate < 0 {
+		return fmt.Errorf("invalid rate %g: must be positive, or 0", opts.rate)
+	}
+	if opts.maxInflight <= 0 {
+		return fmt.Errorf("invalid max-inflight %d: must be positive", opts.maxInflight)
+	}
+
+	sizes, err := parseSizes(opts.sizes)
+	if err != nil {
+		return err
+	}
+
+	b := &bench{
+		opts:      opts,
+		sizes:     sizes,
+		payload:   strings.Repeat("m", sizes.max()),
+		usernames: make([]string, opts.connections),
+		clients:   make([]*client.Client, opts.connections),
+		stats:     newStats(),
+		start:     time.Now(),
+	}
+	for i := range b.usernames {
+		b.usernames[i] = fmt.Sprintf("%s-%d", opts.userPrefix, i)
+	}
+
+	err = b.connect(ctx)
+	defer b.disconnect()
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "%d users logged in, in %s\n", opts.connections, time.Since(b.start).Round(time.Millisecond))
+
+	sendCtx, cancel := context.WithTimeout(ctx, opts.duration)
+	defer cancel()
+
+	sendStart := time.Now()
+	var wg sync.WaitGroup
+	for i := range b.clients {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			b.send(sendCtx, i)
+		}()
+	}
+	wg.Wait()
+	elapsed := time.Since(sendStart)
+
+	b.waitDeliveries(ctx)
+
+	b.stats.report(out, elapsed)
+	return nil
+}
+
+// connect logs in all the users, a few at a time. The first one logs in alone,
+// so that a server refusing the logins fails the run once, instead of once per user.
+func (b *bench) connect(ctx context.Context) error {
+
+	c, err := b.login(ctx, b.usernames[0])
+	if err != nil {
+		return fmt.Errorf("logging in %s: %w", b.usernames[0], err)
+	}
+	b.clients[0] = c
+
+	var mu sync.Mutex
+	var errs []error
+
+	slots := make(chan struct{}, 32)
+	var wg sync.WaitGroup
+	for i := 1; i < len(b.usernames); i++ {
+		username := b.usernames[i]
+		wg.Add(1)
+		slots <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-slots }()
+
+			c, err := b.login(ctx, username)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				errs = append(errs, fmt.Errorf("logging in %s: %w", username, err))
+				return
+			}
+			b.clients[i] = c
+		}()
+	}
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
+
+func (b *bench) login(ctx context.Context, username string) (*client.Client, error) {
+
+	ctx, cancel := context.WithTimeout(ctx, b.opts.timeout)
+	defer cancel()
+
+	c, err := client.Dial(ctx, b.opts.address, client.Options{OnPush: b.onPush})
+	if err != nil {
+		return nil, err
+	}
+
+	if b.opts.password == "" {
+		err = c.Login(ctx, username)
+		var se *client.StatusError
+		if errors.As(err, &se) && se.Status == protocol.StatusNotAllowed {
+			err = fmt.Errorf("%w: %w", errPasswordlessRefused, err)
+		}
+	} else {
+		err = b.register(ctx, c, username)
+		if err == nil {
+			err = c.LoginWithPassword(ctx, username, b.opts.password)
+		}
+	}
+	if err != nil {
+		_ = c.Close()
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// register creates the user, unless a previous run already did
+func (b *bench) register(ctx context.Context, c *client.Client, username string) error {
+
+	err := c.Register(ctx, username, b.opts.password)
+
+	var se *client.StatusError
+	if errors.As(err, &se) && se.Status == protocol.StatusUsernameTaken {
+		return nil
+	}
+
+	return err
+}
+
+// onPush records the latency of the deliveries, from the timestamp set by the sender
+func (b *bench) onPush(body protocol.Body) {
+
+	delivery, ok := body.(*protocol.Delivery)
+	if !ok || delivery.Timestamp.Before(b.start) || !strings.HasPrefix(delivery.From, b.opts.userPrefix+"-") {
+		return
+	}
+
+	b.stats.recordDelivery(time.Since(delivery.Timestamp))
+}
+
+// send sends messages on the i-th connection until the context is done, then waits for their responses
+func (b *bench) send(ctx context.Context, i int) {
+
+	c := b.clients[i]
+
+	if b.opts.rate == 0 {
+		for ctx.Err() == nil {
+			b.sendOne(c, i)
+		}
+		return
+	}
+
+	// each connection sends its share of the rate, starting at a random time
+	// so that the connections don't all send at once
+	interval := max(time.Duration(float64(time.Second)*float64(len(b.clients))/b.opts.rate), time.Microsecond)
+	select {
+	case <-time.After(rand.N(interval)):
+	case <-ctx.Done():
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	inflight := make(chan struct{}, b.opts.maxInflight)
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	for {
+		select {
+		case inflight <- struct{}{}:
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				defer func() { <-inflight }()
+				b.sendOne(c, i)
+			}()
+		default:
+			b.stats.recordSkipped()
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// sendOne sends a message from the i-th user to another one, picked at random
+func (b *bench) sendOne(c *client.Client, i int) {
+
+	to := i
+	if len(b.usernames) > 1 {
+		to = rand.IntN(len(b.usernames) - 1)
+		if to >= i {
+			to++
+		}
+	}
+
+	// the messages sent at the end of the run still get their response
+	ctx, cancel := context.WithTimeout(context.Background(), b.opts.timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := c.Send(ctx, b.usernames[to], b.payload[:b.sizes.next()])
+	b.stats.recordResponse(time.Since(start), err)
+}
+
+// waitDeliveries waits until all the messages accepted by the server have been delivered,
+// or until the drain time is over
+func (b *bench) waitDeliveries(ctx context.Context) {
+
+	deadline := time.After(b.opts.drain)
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+
+	for !b.stats.allDelivered() {
+		select {
+		case <-ticker.C:
+		case <-deadline:
+			return
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// disconnect logs out the users, so that their sessions can't be resumed, and closes the connections
+func (b *bench) disconnect() {
+
+	var wg sync.WaitGroup
+	for _, c := range b.clients {
+		if c == nil {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			ctx, cancel := context.WithTimeout(context.Background(), b.opts.timeout)
+			defer cancel()
+
+			_ = c.Logout(ctx)
+			_ = c.Close()
+		}()
+	}
+	wg.Wait()
+}
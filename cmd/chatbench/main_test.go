@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"tcpserver/protocol"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeServer accepts the connections, refusing the passwordless logins as a server with the default config,
+// and answering OK to any other frame
+func fakeServer(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			t.Cleanup(func() { _ = conn.Close() })
+
+			go func() {
+				for {
+					header, body, err := protocol.ReadFrame(conn, 1<<20)
+					if err != nil {
+						return
+					}
+					status := protocol.StatusOK
+					if _, ok := body.(*protocol.Login); ok {
+						status = protocol.StatusNotAllowed
+					}
+					_ = protocol.WriteFrame(conn, protocol.Version1, header.CorrelationID, &protocol.Response{Status: status})
+				}
+			}()
+		}
+	}()
+
+	return listener.Addr().String()
+}
+
+func Test_run_Logins(t *testing.T) {
+	tests := []struct {
+		name     string
+		password string
+		wantErr  error
+		wantOut  string
+	}{
+		{
+			name:    "passwordless logins refused: the run stops at the first one",
+			wantErr: errPasswordlessRefused,
+		},
+		{
+			name:     "users registered with a password",
+			password: "secret",
+			wantOut:  "3 users logged in",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			opts := options{
+				address:     fakeServer(t),
+				connections: 3,
+				rate:        100,
+				sizes:       "8",
+				duration:    20 * time.Millisecond,
+				timeout:     time.Second,
+				maxInflight: 1,
+				drain:       10 * time.Millisecond,
+				userPrefix:  "bench",
+				password:    tt.password,
+			}
+			var out strings.Builder
+
+			err := run(context.Background(), opts, &out)
+
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				assert.Equal(t, 1, strings.Count(err.Error(), "logging in"), err.Error())
+				return
+			}
+			require.NoError(t, err)
+			assert.Contains(t, out.String(), tt.wantOut)
+		})
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrInvalidSizes = errors.New("invalid message sizes")
+)
+
+// sizes is the distribution of the sizes of the messages sent
+type sizes interface {
+	next() int
+	max() int
+}
+
+// fixedSize sends all the messages with the same size, e.g. "64"
+type fixedSize int
+
+func (fs fixedSize) next() int { return int(fs) }
+func (fs fixedSize) max() int  { return int(fs) }
+
+// uniformSizes picks the sizes uniformly between low and high included, e.g. "16-256"
+type uniformSizes struct {
+	low  int
+	high int
+}
+
+func (us uniformSizes) next() int { return us.low + rand.IntN(us.high-us.low+1) }
+func (us uniformSizes) max() int  { return us.high }
+
+// weightedSizes picks the sizes in proportion to their weight, e.g. "64:9,4096:1"
+// sends one message of 4096 bytes every 10
+type weightedSizes struct {
+	sizes []int
+	// cumulative holds the sum of the weights up to each size
+	cumulative []int
+}
+
+func (ws weightedSizes) next() int {
+	n := rand.IntN(ws.cumulative[len(ws.cumulative)-1])
+	for i, c := range ws.cumulative {
+		if n < c {
+			return ws.sizes[i]
+		}
+	}
+	return ws.sizes[len(ws.sizes)-1]
+}
+
+func (ws weightedSizes) max() int {
+	m := 0
+	for _, s := range ws.sizes {
+		m = max(m, s)
+	}
+	return m
+}
+
+// parseSizes parses the distribution of the sizes: a fixed size, a range, or a list of sizes with their weight
+func parseSizes(value string) (sizes, error) {
+
+	if strings.Contains(value, ":") {
+		return parseWeightedSizes(value)
+	}
+
+	low, high, isRange := strings.Cut(value, "-")
+	if !isRange {
+		size, err := parseSize(value)
+		if err != nil {
+			return nil, err
+		}
+		return fixedSize(size), nil
+	}
+
+	minSize, err := parseSize(low)
+	if err != nil {
+		return nil, err
+	}
+	maxSize, err := parseSize(high)
+	if err != nil {
+		return nil, err
+	}
+	if minSize > maxSize {
+		return nil, fmt.Errorf("%w: %q, the minimum is greater than the maximum", ErrInvalidSizes, value)
+	}
+
+	return uniformSizes{low: minSize, high: maxSize}, nil
+}
+
+func parseWeightedSizes(value string) (sizes, error) {
+
+	var ws weightedSizes
+	total := 0
+	for _, entry := range strings.Split(value, ",") {
+
+		sizeValue, weightValue, _ := strings.Cut(entry, ":")
+
+		size, err := parseSize(sizeValue)
+		if err != nil {
+			return nil, err
+		}
+
+		weight, err := strconv.Atoi(strings.TrimSpace(weightValue))
+		if err != nil || weight <= 0 {
+			return nil, fmt.Errorf("%w: invalid weight %q, expected a positive integer", ErrInvalidSizes, weightValue)
+		}
+
+		total += weight
+		ws.sizes = append(ws.sizes, size)
+		ws.cumulative = append(ws.cumulative, total)
+	}
+
+	return ws, nil
+}
+
+func parseSize(value string) (int, error) {
+
+	size, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil || size <= 0 || size > 0xFFFF {
+		return 0, fmt.Errorf("%w: invalid size %q, expected between 1 and %d bytes", ErrInvalidSizes, value, 0xFFFF)
+	}
+
+	return size, nil
+}
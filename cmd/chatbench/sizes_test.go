@@ -0,0 +1,173 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_parseSizes(t *testing.T) {
+	tests := []struct {
+		name      string
+		value     string
+		wantSizes sizes
+		wantErr   string
+	}{
+		{
+			name:      "happy path: fixed size",
+			value:     "64",
+			wantSizes: fixedSize(64),
+		},
+		{
+			name:      "happy path: range",
+			value:     "16-256",
+			wantSizes: uniformSizes{low: 16, high: 256},
+		},
+		{
+			name:      "happy path: range of a single size",
+			value:     "16-16",
+			wantSizes: uniformSizes{low: 16, high: 16},
+		},
+		{
+			name:      "happy path: weighted sizes, with spaces",
+			value:     "64:9, 4096 : 1",
+			wantSizes: weightedSizes{sizes: []int{64, 4096}, cumulative: []int{9, 10}},
+		},
+		{
+			name:      "happy path: largest size",
+			value:     "65535",
+			wantSizes: fixedSize(65535),
+		},
+		{
+			name:    "error: empty",
+			value:   "",
+			wantErr: `invalid message sizes: invalid size "", expected between 1 and 65535 bytes`,
+		},
+		{
+			name:    "error: not a number",
+			value:   "big",
+			wantErr: `invalid size "big"`,
+		},
+		{
+			name:    "error: zero",
+			value:   "0",
+			wantErr: `invalid size "0"`,
+		},
+		{
+			name:    "error: too large for a frame",
+			value:   "65536",
+			wantErr: `invalid size "65536"`,
+		},
+		{
+			name:    "error: range without maximum",
+			value:   "16-",
+			wantErr: `invalid size ""`,
+		},
+		{
+			name:    "error: range with negative minimum",
+			value:   "-16",
+			wantErr: `invalid size ""`,
+		},
+		{
+			name:    "error: range upside down",
+			value:   "256-16",
+			wantErr: `invalid message sizes: "256-16", the minimum is greater than the maximum`,
+		},
+		{
+			name:    "error: weight missing",
+			value:   "64:9,4096",
+			wantErr: `invalid weight "", expected a positive integer`,
+		},
+		{
+			name:    "error: weight zero",
+			value:   "64:0",
+			wantErr: `invalid weight "0", expected a positive integer`,
+		},
+		{
+			name:    "error: weighted size invalid",
+			value:   "0:1",
+			wantErr: `invalid size "0"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			got, err := parseSizes(tt.value)
+
+			if tt.wantErr != "" {
+				assert.ErrorIs(t, err, ErrInvalidSizes)
+				assert.ErrorContains(t, err, tt.wantErr)
+				assert.Nil(t, got)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantSizes, got)
+		})
+	}
+}
+
+func Test_sizes_next(t *testing.T) {
+	tests := []struct {
+		name    string
+		sizes   sizes
+		want    []int
+		wantMax int
+	}{
+		{
+			name:    "fixed size",
+			sizes:   fixedSize(64),
+			want:    []int{64},
+			wantMax: 64,
+		},
+		{
+			name:    "uniform sizes: bounds included",
+			sizes:   uniformSizes{low: 1, high: 3},
+			want:    []int{1, 2, 3},
+			wantMax: 3,
+		},
+		{
+			name:    "weighted sizes: every size gets picked",
+			sizes:   weightedSizes{sizes: []int{4096, 64}, cumulative: []int{1, 3}},
+			want:    []int{64, 4096},
+			wantMax: 4096,
+		},
+		{
+			name:    "weighted sizes: a single size",
+			sizes:   weightedSizes{sizes: []int{64}, cumulative: []int{5}},
+			want:    []int{64},
+			wantMax: 64,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			picked := map[int]bool{}
+			for range 1000 {
+				picked[tt.sizes.next()] = true
+			}
+
+			assert.Len(t, picked, len(tt.want))
+			for _, size := range tt.want {
+				assert.True(t, picked[size], "size %d never picked", size)
+			}
+			assert.Equal(t, tt.wantMax, tt.sizes.max())
+		})
+	}
+}
+
+func Test_weightedSizes_next_FollowsWeights(t *testing.T) {
+	ws := weightedSizes{sizes: []int{64, 4096}, cumulative: []int{9, 10}}
+
+	large := 0
+	for range 10000 {
+		if ws.next() == 4096 {
+			large++
+		}
+	}
+
+	// one message in 10 on average, with a wide margin so that the test doesn't flake
+	assert.InDelta(t, 1000, large, 200)
+}
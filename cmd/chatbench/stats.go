@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"math"
+	"slices"
+	"sync"
+	"tcpserver/client"
+	"tcpserver/protocol"
+	"time"
+)
+
+// stats collects the outcome of the messages sent and delivered during the run
+type stats struct {
+	mu sync.Mutex
+
+	sent    int
+	skipped int
+	// responseLatencies are the times between sending a message and receiving the response with its correlationId
+	responseLatencies []time.Duration
+	// deliveryLatencies are the times between sending a message and its delivery to the recipient
+	deliveryLatencies []time.Duration
+	// errors counts the failed messages by status name, or by kind of error when there was no response
+	errors map[string]int
+}
+
+func newStats() *stats {
+	return &stats{
+		errors: make(map[string]int),
+	}
+}
+
+// recordResponse records the outcome of a message, given the time it took to get the response
+func (s *stats) recordResponse(latency time.Duration, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sent++
+
+	var se *client.StatusError
+	switch {
+	case err == nil:
+		s.responseLatencies = append(s.responseLatencies, latency)
+	case errors.As(err, &se):
+		// the server answered all the same: the latency is measured on the failures too
+		s.responseLatencies = append(s.responseLatencies, latency)
+		s.errors[protocol.StatusName(se.Status)]++
+	case errors.Is(err, context.DeadlineExceeded):
+		s.errors["timeout"]++
+	case errors.Is(err, client.ErrClosed):
+		s.errors["closed"]++
+	default:
+		s.errors["connection_error"]++
+	}
+}
+
+// recordSkipped records a message not sent, because too many messages were waiting for their response
+func (s *stats) recordSkipped() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.skipped++
+}
+
+func (s *stats) recordDelivery(latency time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.deliveryLatencies = append(s.deliveryLatencies, latency)
+}
+
+// failed returns the number of messages that got an error, s.mu must be held
+func (s *stats) failed() int {
+	failed := 0
+	for _, count := range s.errors {
+		failed += count
+	}
+	return failed
+}
+
+// allDelivered tells whether all the messages accepted by the server have been delivered
+func (s *stats) allDelivered() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.deliveryLatencies) >= s.sent-s.failed()
+}
+
+// report writes the summary of the run, which lasted the given duration
+func (s *stats) report(out io.Writer, elapsed time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	succeeded := s.sent - s.failed()
+
+	fmt.Fprintf(out, "duration:   %s\n", elapsed.Round(time.Millisecond))
+	fmt.Fprintf(out, "sent:       %d (%.1f/s), skipped %d\n", s.sent, perSecond(s.sent, elapsed), s.skipped)
+	fmt.Fprintf(out, "succeeded:  %d (%.1f/s)\n", succeeded, perSecond(succeeded, elapsed))
+	fmt.Fprintf(out, "delivered:  %d (%.1f/s)\n", len(s.deliveryLatencies), perSecond(len(s.deliveryLatencies), elapsed))
+	fmt.Fprintf(out, "response latency: %s\n", percentiles(s.responseLatencies))
+	fmt.Fprintf(out, "delivery latency: %s\n", percentiles(s.deliveryLatencies))
+
+	if len(s.errors) == 0 {
+		fmt.Fprintln(out, "errors:     none")
+		return
+	}
+	fmt.Fprintln(out, "errors:")
+	for _, name := range slices.Sorted(maps.Keys(s.errors)) {
+		fmt.Fprintf(out, "  %-20s %d\n", name, s.errors[name])
+	}
+}
+
+func perSecond(count int, elapsed time.Duration) float64 {
+	if elapsed <= 0 {
+		return 0
+	}
+	return float64(count) / elapsed.Seconds()
+}
+
+// percentiles describes the distribution of the latencies
+func percentiles(latencies []time.Duration) string {
+
+	if len(latencies) == 0 {
+		return "no samples"
+	}
+
+	sorted := slices.Clone(latencies)
+	slices.Sort(sorted)
+
+	at := func(p float64) time.Duration {
+		i := int(math.Ceil(p*float64(len(sorted)))) - 1
+		return sorted[max(i, 0)]
+	}
+
+	return fmt.Sprintf("p50 %s, p99 %s, p999 %s, max %s",
+		round(at(0.50)), round(at(0.99)), round(at(0.999)), round(sorted[len(sorted)-1]))
+}
+
+func round(d time.Duration) time.Duration {
+	return d.Round(time.Microsecond)
+}
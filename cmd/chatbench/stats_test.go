@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"tcpserver/client"
+	"tcpserver/protocol"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_percentiles(t *testing.T) {
+
+	// 1ms, 2ms, ..., 1000ms, shuffled by steps of 7 to check that they get sorted
+	thousand := make([]time.Duration, 1000)
+	for i := range thousand {
+		thousand[i] = time.Duration((i*7)%1000+1) * time.Millisecond
+	}
+
+	tests := []struct {
+		name      string
+		latencies []time.Duration
+		want      string
+	}{
+		{
+			name: "no samples",
+			want: "no samples",
+		},
+		{
+			name:      "a single sample is every percentile",
+			latencies: []time.Duration{3 * time.Millisecond},
+			want:      "p50 3ms, p99 3ms, p999 3ms, max 3ms",
+		},
+		{
+			name:      "two samples: p50 is the lower one",
+			latencies: []time.Duration{2 * time.Millisecond, time.Millisecond},
+			want:      "p50 1ms, p99 2ms, p999 2ms, max 2ms",
+		},
+		{
+			name:      "a thousand samples",
+			latencies: thousand,
+			want:      "p50 500ms, p99 990ms, p999 999ms, max 1s",
+		},
+		{
+			name:      "rounded to the microsecond",
+			latencies: []time.Duration{1500 * time.Nanosecond},
+			want:      "p50 2µs, p99 2µs, p999 2µs, max 2µs",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			before := fmt.Sprint(tt.latencies)
+
+			got := percentiles(tt.latencies)
+
+			assert.Equal(t, tt.want, got)
+			assert.Equal(t, before, fmt.Sprint(tt.latencies), "the latencies must be left unsorted")
+		})
+	}
+}
+
+func Test_stats_allDelivered(t *testing.T) {
+	tests := []struct {
+		name       string
+		responses  []error
+		deliveries int
+		want       bool
+	}{
+		{
+			name: "nothing sent",
+			want: true,
+		},
+		{
+			name:      "sent, not delivered yet",
+			responses: []error{nil, nil},
+			want:      false,
+		},
+		{
+			name:       "some delivered",
+			responses:  []error{nil, nil},
+			deliveries: 1,
+			want:       false,
+		},
+		{
+			name:       "all delivered",
+			responses:  []error{nil, nil},
+			deliveries: 2,
+			want:       true,
+		},
+		{
+			name:      "failures are not waited for",
+			responses: []error{&client.StatusError{Status: protocol.StatusMailboxFull}, context.DeadlineExceeded},
+			want:      true,
+		},
+		{
+			name:       "failures and deliveries",
+			responses:  []error{nil, client.ErrClosed},
+			deliveries: 1,
+			want:       true,
+		},
+		{
+			name:       "delivered twice, e.g. after a resume",
+			responses:  []error{nil},
+			deliveries: 2,
+			want:       true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			s := newStats()
+			for _, err := range tt.responses {
+				s.recordResponse(time.Millisecond, err)
+			}
+			for range tt.deliveries {
+				s.recordDelivery(time.Millisecond)
+			}
+
+			assert.Equal(t, tt.want, s.allDelivered())
+		})
+	}
+}
+
+func Test_stats_recordResponse(t *testing.T) {
+	s := newStats()
+
+	s.recordResponse(time.Millisecond, nil)
+	s.recordResponse(2*time.Millisecond, &client.StatusError{Status: protocol.StatusUserNotFound})
+	s.recordResponse(0, fmt.Errorf("sending: %w", context.DeadlineExceeded))
+	s.recordResponse(0, client.ErrClosed)
+	s.recordResponse(0, errors.New("connection reset by peer"))
+	s.recordSkipped()
+
+	assert.Equal(t, 5, s.sent)
+	assert.Equal(t, 1, s.skipped)
+	assert.Equal(t, []time.Duration{time.Millisecond, 2 * time.Millisecond}, s.responseLatencies)
+	assert.Equal(t, map[string]int{
+		protocol.StatusName(protocol.StatusUserNotFound): 1,
+		"timeout":          1,
+		"closed":           1,
+		"connection_error": 1,
+	}, s.errors)
+
+	var out strings.Builder
+	s.report(&out, time.Second)
+	assert.Contains(t, out.String(), "sent:       5 (5.0/s), skipped 1\n")
+	assert.Contains(t, out.String(), "succeeded:  1 (1.0/s)\n")
+	assert.Contains(t, out.String(), "  timeout              1\n")
+}
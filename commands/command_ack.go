@@ -0,0 +1,59 @@
+package commands
+
+import (
+	"io"
+	"log/slog"
+	"net"
+	"tcpserver/protocol"
+)
+
+const (
+	AckCommandCode = protocol.CodeAck
+)
+
+// AckCommand acknowledges the deliveries received by the user logged in on the connection,
+// up to the one with the given sequence. They won't be delivered again, so it gets no answer.
+type AckCommand struct {
+	metadata Metadata
+	sequence uint64
+	conn     net.Conn
+}
+
+func NewAckCommand(
+	metadata Metadata,
+	stream io.Reader,
+	conn net.Conn,
+) (*AckCommand, error) {
+
+	var frame protocol.Ack
+	err := frame.Decode(stream)
+	if err != nil {
+		return nil, err
+	}
+
+	ac := &AckCommand{
+		metadata: metadata,
+		sequence: frame.Sequence,
+		conn:     conn,
+	}
+
+	return ac, nil
+}
+
+func (ac *AckCommand) Process(state State) (Frame, error) {
+
+	username, ok := state.Username(ac.conn)
+	if ok {
+		state.Acknowledge(username, ac.sequence)
+	}
+
+	return nil, nil
+}
+
+// LogValue describes the command in the logs
+func (ac *AckCommand) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.String("name", "Ack"),
+		slog.Uint64("sequence", ac.sequence),
+	)
+}
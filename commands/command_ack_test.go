@@ -0,0 +1,86 @@
+package commands
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net"
+	"tcpserver/state"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_NewAckCommand(t *testing.T) {
+	mockConn := net.TCPConn{}
+
+	tests := []struct {
+		name    string
+		body    string
+		wantRes *AckCommand
+		wantErr error
+	}{
+		{
+			name: "happy path: correct ack packet gets parsed",
+			body: "\x00\x00\x00\x00\x00\x00\x00\x03",
+			wantRes: &AckCommand{
+				metadata: Metadata{},
+				sequence: 3,
+				conn:     &mockConn,
+			},
+			wantErr: nil,
+		},
+		{
+			name:    "error: malformed command, sequence truncated",
+			body:    "\x00\x00\x00\x03",
+			wantRes: nil,
+			wantErr: io.ErrUnexpectedEOF,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			buf := bufio.NewReader(bytes.NewBuffer([]byte(tt.body)))
+
+			res, err := NewAckCommand(Metadata{}, buf, &mockConn)
+
+			assert.Equal(t, tt.wantRes, res)
+			assert.Equal(t, tt.wantErr, err)
+		})
+	}
+}
+
+func Test_AckCommand_Process(t *testing.T) {
+	mockConn := net.TCPConn{}
+	msg := state.Message{From: "alice", Timestamp: time.Unix(1, 0), Payload: "Hi"}
+
+	s := state.NewState()
+	require.NoError(t, s.Login(&mockConn, "bob"))
+	for range 3 {
+		s.Deliver("bob", msg)
+	}
+
+	ac := &AckCommand{
+		metadata: Metadata{version: 1, cmdCode: AckCommandCode, correlationId: 2},
+		sequence: 2,
+		conn:     &mockConn,
+	}
+
+	res, err := ac.Process(s)
+
+	assert.Nil(t, res)
+	assert.NoError(t, err)
+	assert.Equal(t, []state.Delivery{{Sequence: 3, Message: msg}}, s.Unacknowledged("bob"))
+}
+
+func Test_AckCommand_Process_NotLoggedIn(t *testing.T) {
+
+	ac := &AckCommand{sequence: 2, conn: &net.TCPConn{}}
+
+	res, err := ac.Process(state.NewState())
+
+	assert.Nil(t, res)
+	assert.NoError(t, err)
+}
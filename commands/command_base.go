@@ -2,121 +2,208 @@ package commands
 
 import (
 	"bytes"
-	"encoding/binary"
 	"errors"
 	"fmt"
 	"io"
 	"net"
+	"tcpserver/protocol"
 	"time"
 )
 
 var (
-	ErrMalformedMetadata     = errors.New("malformed metadata")
-	ErrMalformedCommand      = errors.New("malformed command")
-	ErrUnknownCommand        = errors.New("unknown command")
-	ErrUnsupportedLengthSize = errors.New("unsupported length size")
+	ErrMalformedMetadata = errors.New("malformed metadata")
+	ErrMalformedCommand  = errors.New("malformed command")
+	ErrUnknownCommand    = errors.New("unknown command")
+	ErrFieldTooLong      = protocol.ErrFieldTooLong
+	ErrNotLoggedIn       = errors.New("not logged in")
+	ErrSenderMismatch    = errors.New("sender doesn't match the logged user")
+	ErrEmptyPassword     = errors.New("empty password")
 )
 
 type State interface {
 	Login(conn net.Conn, username string) error
+	Register(username string, password string) error
+	LoginWithPassword(conn net.Conn, username string, password string) error
+	// IssueToken returns the token resuming the session of the user, or state.ErrTokensDisabled
+	IssueToken(username string) (string, time.Time, error)
+	Resume(conn net.Conn, token string) (string, error)
+	RevokeTokens(username string)
+	Logout(conn net.Conn)
+	Users() map[string]bool
+	Username(conn net.Conn) (string, bool)
 	EnqueueMessage(from string, to string, timestamp time.Time, message string) error
+	// Acknowledge forgets the deliveries to the user up to the sequence, which were received
+	Acknowledge(username string, sequence uint64)
+}
+
+// Frame is anything the server writes on a connection
+type Frame interface {
+	Write(out io.Writer) error
 }
 
 type Command interface {
-	Process(state State) (*Response, error)
+	// Process executes the command, returning the frame to answer with,
+	// or nil if the command doesn't need an answer
+	Process(state State) (Frame, error)
+}
+
+// ParseError is returned when a whole frame has been read from the stream,
+// but its content couldn't be parsed. The stream is still in sync,
+// so the client can be answered with an error response.
+type ParseError struct {
+	metadata Metadata
+	err      error
 }
 
+func (pe *ParseError) Error() string {
+	return pe.err.Error()
+}
+
+func (pe *ParseError) Unwrap() error {
+	return pe.err
+}
+
+// CorrelationID returns the correlationId of the frame, 0 if it couldn't be parsed
+func (pe *ParseError) CorrelationID() uint32 {
+	return pe.metadata.correlationId
+}
+
+// Response returns the error response to send back to the client
+func (pe *ParseError) Response() *Response {
+	return newErrorResponse(pe.metadata, pe.err)
+}
+
+// MetadataLength is the size of the metadata at the beginning of each frame:
+// version, command code and correlationId
+const MetadataLength = protocol.HeaderLength
+
 type Metadata struct {
 	version       byte
 	cmdCode       uint16
 	correlationId uint32
 }
 
-func ParseCommand(stream net.Conn) (Command, error) {
+// ParseCommand reads the next command from the connection of the session. Besides the errors reading from it,
+// it returns a *ParseError if the frame is invalid, or its version or command isn't allowed in the session,
+// but the stream can still be read, or a *FrameError if the frame couldn't be read as a whole.
+// Both the errors and the processing of the command get reported to the instrumentation of the session.
+func ParseCommand(session *Session, limits Limits) (Command, error) {
 
-	var len uint32
-	body, bErr := readFieldWithLength(stream, len)
+	cmd, err := parseCommand(session, limits)
+	if err != nil {
+		session.parseFailed(err)
+		return nil, err
+	}
+
+	return cmd, nil
+}
+
+func parseCommand(session *Session, limits Limits) (Command, error) {
+
+	stream := session.Conn()
+	session.setCorrelationID(0, false)
+
+	body, bErr := readFrame(stream, limits)
 	if bErr != nil {
 		return nil, bErr
 	}
-	fmt.Printf("### Received command: %X\n", body)
 
 	bodyStream := bytes.NewBuffer(body)
 
 	metadata, mErr := parseMetadata(bodyStream)
 	if mErr != nil {
-		return nil, mErr
-	}
-
-	switch metadata.cmdCode {
-	case LoginCommandCode:
-		return NewLoginCommand(*metadata, bodyStream, stream)
-	case MessageCommandCode:
-		return NewMessageCommand(*metadata, bodyStream)
-	case CorrelationIDTestCommandCode:
-		return NewCorrelationIDTestCommand(*metadata, bodyStream)
-	default:
-		return nil, ErrUnknownCommand
+		return nil, &ParseError{
+			err: fmt.Errorf("%w: %w", ErrMalformedMetadata, mErr),
+		}
 	}
-}
 
-func readFieldWithLength(stream io.Reader, fieldLen any) ([]byte, error) {
-	var field []byte
+	session.setCorrelationID(metadata.correlationId, true)
 
-	switch tFieldLen := fieldLen.(type) {
-	case uint16:
-
-		err := binary.Read(stream, binary.BigEndian, &tFieldLen)
-		if err != nil {
-			return nil, err
+	vErr := session.checkVersion(*metadata)
+	if vErr != nil {
+		return nil, &ParseError{
+			metadata: *metadata,
+			err:      vErr,
 		}
+	}
 
-		field = make([]byte, tFieldLen)
-
-	case uint32:
+	decode, ok := decoders[metadata.version][metadata.cmdCode]
+	if !ok {
+		return nil, &ParseError{
+			metadata: *metadata,
+			err:      ErrUnknownCommand,
+		}
+	}
 
-		err := binary.Read(stream, binary.BigEndian, &tFieldLen)
-		if err != nil {
-			return nil, err
+	cmd, cErr := decode(*metadata, bodyStream, session, limits)
+	if cErr != nil {
+		return nil, &ParseError{
+			metadata: *metadata,
+			err:      fmt.Errorf("%w: %w", ErrMalformedCommand, cErr),
 		}
+	}
 
-		field = make([]byte, tFieldLen)
+	aErr := session.checkAllowed(metadata.cmdCode)
+	if aErr != nil {
+		return nil, &ParseError{
+			metadata: *metadata,
+			err:      aErr,
+		}
+	}
 
-	default:
-		return nil, ErrUnsupportedLengthSize
+	pErr := session.policy.checkAllowed(metadata.cmdCode)
+	if pErr != nil {
+		return nil, &ParseError{
+			metadata: *metadata,
+			err:      pErr,
+		}
 	}
 
-	_, err := io.ReadFull(stream, field)
-	if err != nil {
-		return nil, err
+	lc, ok := cmd.(limitedCommand)
+	if ok {
+		lErr := lc.checkLimits(limits)
+		if lErr != nil {
+			return nil, &ParseError{
+				metadata: *metadata,
+				err:      lErr,
+			}
+		}
 	}
 
-	return field, nil
+	session.CommandLogger().Debug("command received",
+		"version", metadata.version,
+		"command", cmd,
+	)
+
+	return session.instrument(metadata.cmdCode, cmd), nil
 }
 
-func parseMetadata(stream io.Reader) (*Metadata, error) {
+// sessionSender returns the user logged in on the connection, who is the sender
+// of the messages sent on it: a client can't send messages on behalf of someone else
+func sessionSender(state State, conn net.Conn, from string) (string, error) {
 
-	var version byte
-	vErr := binary.Read(stream, binary.BigEndian, &version)
-	if vErr != nil {
-		return nil, vErr
+	username, ok := state.Username(conn)
+	if !ok {
+		return "", ErrNotLoggedIn
 	}
-
-	var cmdCode uint16
-	cErr := binary.Read(stream, binary.BigEndian, &cmdCode)
-	if cErr != nil {
-		return nil, cErr
+	if from != username {
+		return "", fmt.Errorf("%w: %q is logged in, not %q", ErrSenderMismatch, username, from)
 	}
 
-	var correlationId uint32
-	crErr := binary.Read(stream, binary.BigEndian, &correlationId)
-	if crErr != nil {
-		return nil, crErr
+	return username, nil
+}
+
+func parseMetadata(stream io.Reader) (*Metadata, error) {
+
+	var header protocol.Header
+	err := header.Decode(stream)
+	if err != nil {
+		return nil, err
 	}
 
 	return &Metadata{
-		version:       version,
-		cmdCode:       cmdCode,
-		correlationId: correlationId,
+		version:       header.Version,
+		cmdCode:       header.Code,
+		correlationId: header.CorrelationID,
 	}, nil
 }
@@ -1,9 +1,10 @@
 package commands
 
 import (
-	"errors"
+	"fmt"
 	"io"
 	"net"
+	"strings"
 	"testing"
 	"time"
 
@@ -12,11 +13,25 @@ import (
 
 func Test_ParseCommand(t *testing.T) {
 	mockLoginStream := generateStream("\x00\x00\x00\x11\x01\x00\x01\x00\x00\x00\x01\x00\x08TestUser")
+	mockTokensLoginStream := generateStream("\x00\x00\x00\x11\x01\x00\x01\x00\x00\x00\x01\x00\x08TestUser")
+	mockLogoutStream := generateStream("\x00\x00\x00\x07\x01\x00\x06\x00\x00\x00\x02")
+	mockMessageV2Stream := generateStream("\x00\x00\x00\x19\x02\x00\x02\x00\x00\x00\x01\x00\x03msg\x00\x03rec\x18\x16\x68\x7E\xC0\x57\x00\x00")
+	mockResumeStream := generateStream("\x00\x00\x00\x0E\x01\x00\x11\x00\x00\x00\x04\x00\x05token")
+	mockMessageStream := generateStream("\x00\x00\x00\x1E\x01\x00\x02\x00\x00\x00\x01\x00\x03msg\x00\x03usr\x00\x03rec\x18\x16\x68\x7E\xC0\x57\x00\x00")
+	skipOversized := testLimits
+	skipOversized.SkipOversizedFrames = true
+	passwordsOnly := Policy{}
+
 	tests := []struct {
-		name    string
-		stream  net.Conn
-		wantRes Command
-		wantErr error
+		name     string
+		stream   net.Conn
+		phase    Phase
+		version  byte
+		features []string
+		limits   *Limits
+		policy   *Policy
+		wantRes  Command
+		wantErr  error
 	}{
 		{
 			name:   "happy path: correct login packet gets parsed",
@@ -32,6 +47,22 @@ func Test_ParseCommand(t *testing.T) {
 			},
 			wantErr: nil,
 		},
+		{
+			name:     "happy path: login of a client that asked for the session tokens",
+			stream:   mockTokensLoginStream,
+			features: []string{FeatureSessionTokens},
+			wantRes: &LoginCommand{
+				metadata: Metadata{
+					version:       1,
+					cmdCode:       1,
+					correlationId: 1,
+				},
+				username: "TestUser",
+				conn:     mockTokensLoginStream,
+				tokens:   true,
+			},
+			wantErr: nil,
+		},
 		{
 			name:   "happy path: correct correlationIDTest packet gets parsed",
 			stream: generateStream("\x00\x00\x00\x07\x01\x00\x09\x00\x00\x00\x0A"),
@@ -47,7 +78,8 @@ func Test_ParseCommand(t *testing.T) {
 
 		{
 			name:   "happy path: correct message packet gets parsed",
-			stream: generateStream("\x00\x00\x00\x1E\x01\x00\x02\x00\x00\x00\x01\x00\x03msg\x00\x03usr\x00\x03rec\x18\x16\x68\x7E\xC0\x57\x00\x00"),
+			stream: mockMessageStream,
+			phase:  PhaseAuthenticated,
 			wantRes: &MessageCommand{
 				metadata: Metadata{
 					version:       1,
@@ -58,6 +90,69 @@ func Test_ParseCommand(t *testing.T) {
 				from:      "usr",
 				to:        "rec",
 				timestamp: time.Unix(1735689600, 0),
+				conn:      mockMessageStream,
+			},
+			wantErr: nil,
+		},
+		{
+			name:    "happy path: correct v2 message packet gets parsed",
+			stream:  mockMessageV2Stream,
+			phase:   PhaseAuthenticated,
+			version: ProtocolVersion2,
+			wantRes: &MessageCommand{
+				metadata: Metadata{
+					version:       2,
+					cmdCode:       MessageCommandCode,
+					correlationId: 1,
+				},
+				message:     "msg",
+				fromSession: true,
+				to:          "rec",
+				timestamp:   time.Unix(1735689600, 0),
+				conn:        mockMessageV2Stream,
+			},
+			wantErr: nil,
+		},
+		{
+			name:   "happy path: correct register packet gets parsed",
+			stream: generateStream("\x00\x00\x00\x16\x01\x00\x0E\x00\x00\x00\x03\x00\x05alice\x00\x06secret"),
+			policy: &passwordsOnly,
+			wantRes: &RegisterCommand{
+				metadata: Metadata{
+					version:       1,
+					cmdCode:       RegisterCommandCode,
+					correlationId: 3,
+				},
+				username: "alice",
+				password: "secret",
+			},
+			wantErr: nil,
+		},
+		{
+			name:   "happy path: correct resume packet gets parsed",
+			stream: mockResumeStream,
+			wantRes: &ResumeCommand{
+				metadata: Metadata{
+					version:       1,
+					cmdCode:       ResumeCommandCode,
+					correlationId: 4,
+				},
+				token: "token",
+				conn:  mockResumeStream,
+			},
+			wantErr: nil,
+		},
+		{
+			name:   "happy path: correct logout packet gets parsed",
+			stream: mockLogoutStream,
+			phase:  PhaseAuthenticated,
+			wantRes: &LogoutCommand{
+				metadata: Metadata{
+					version:       1,
+					cmdCode:       6,
+					correlationId: 2,
+				},
+				conn: mockLogoutStream,
 			},
 			wantErr: nil,
 		},
@@ -65,43 +160,197 @@ func Test_ParseCommand(t *testing.T) {
 			name:    "error: malformed command, length field too short",
 			stream:  generateStream("\x01\x00"),
 			wantRes: nil,
-			wantErr: io.ErrUnexpectedEOF,
+			wantErr: &FrameError{
+				err: fmt.Errorf("%w: %w", ErrTruncatedFrame, io.ErrUnexpectedEOF),
+			},
 		},
 		{
 			name:    "error: malformed command, incorrect length",
 			stream:  generateStream("\x00\x00\x00\x11\x01"),
 			wantRes: nil,
-			wantErr: io.ErrUnexpectedEOF,
+			wantErr: &FrameError{
+				err: fmt.Errorf("%w: %w", ErrTruncatedFrame, io.ErrUnexpectedEOF),
+			},
 		},
 		{
 			name:    "error: malformed command, missing metadata",
 			stream:  generateStream("\x00\x00\x00\x00"),
 			wantRes: nil,
-			wantErr: errors.New("EOF"),
+			wantErr: &ParseError{
+				err: fmt.Errorf("%w: %w", ErrMalformedMetadata, io.EOF),
+			},
 		},
 		{
 			name:    "error: malformed metadata, command code too short",
 			stream:  generateStream("\x00\x00\x00\x02\x01\x00"),
 			wantRes: nil,
-			wantErr: io.ErrUnexpectedEOF,
+			wantErr: &ParseError{
+				err: fmt.Errorf("%w: %w", ErrMalformedMetadata, io.ErrUnexpectedEOF),
+			},
 		},
 		{
 			name:    "error: malformed command, correlationId too short",
 			stream:  generateStream("\x00\x00\x00\x06\x01\x00\x01\x00\x00\x00"),
 			wantRes: nil,
-			wantErr: io.ErrUnexpectedEOF,
+			wantErr: &ParseError{
+				err: fmt.Errorf("%w: %w", ErrMalformedMetadata, io.ErrUnexpectedEOF),
+			},
+		},
+		{
+			name:    "error: version not negotiated",
+			stream:  generateStream("\x00\x00\x00\x11\x02\x00\x01\x00\x00\x00\x01\x00\x08TestUser"),
+			wantRes: nil,
+			wantErr: &ParseError{
+				metadata: Metadata{
+					version:       2,
+					cmdCode:       LoginCommandCode,
+					correlationId: 1,
+				},
+				err: fmt.Errorf("%w: 0x02, the session speaks 0x01", ErrUnsupportedVersion),
+			},
 		},
 		{
 			name:    "error: unknown command",
 			stream:  generateStream("\x00\x00\x00\x07\x01\x00\x99\x00\x00\x00\x01"),
 			wantRes: nil,
-			wantErr: ErrUnknownCommand,
+			wantErr: &ParseError{
+				metadata: Metadata{
+					version:       1,
+					cmdCode:       0x99,
+					correlationId: 1,
+				},
+				err: ErrUnknownCommand,
+			},
+		},
+		{
+			name:    "error: malformed command body",
+			stream:  generateStream("\x00\x00\x00\x0A\x01\x00\x01\x00\x00\x00\x01\x00\x08T"),
+			wantRes: nil,
+			wantErr: &ParseError{
+				metadata: Metadata{
+					version:       1,
+					cmdCode:       1,
+					correlationId: 1,
+				},
+				err: fmt.Errorf("%w: %w", ErrMalformedCommand, io.ErrUnexpectedEOF),
+			},
+		},
+		{
+			name:    "error: message before logging in",
+			stream:  generateStream("\x00\x00\x00\x1E\x01\x00\x02\x00\x00\x00\x03\x00\x03msg\x00\x03usr\x00\x03rec\x18\x16\x68\x7E\xC0\x57\x00\x00"),
+			wantRes: nil,
+			wantErr: &ParseError{
+				metadata: Metadata{
+					version:       1,
+					cmdCode:       2,
+					correlationId: 3,
+				},
+				err: fmt.Errorf("%w while %s: 0x%02X", ErrCommandNotAllowed, PhaseConnected, MessageCommandCode),
+			},
+		},
+		{
+			name:    "error: login twice on the same connection",
+			stream:  generateStream("\x00\x00\x00\x11\x01\x00\x01\x00\x00\x00\x04\x00\x08TestUser"),
+			phase:   PhaseAuthenticated,
+			wantRes: nil,
+			wantErr: &ParseError{
+				metadata: Metadata{
+					version:       1,
+					cmdCode:       1,
+					correlationId: 4,
+				},
+				err: fmt.Errorf("%w while %s: 0x%02X", ErrCommandNotAllowed, PhaseAuthenticated, LoginCommandCode),
+			},
+		},
+		{
+			name:    "error: passwordless login disabled",
+			stream:  generateStream("\x00\x00\x00\x11\x01\x00\x01\x00\x00\x00\x04\x00\x08TestUser"),
+			policy:  &passwordsOnly,
+			wantRes: nil,
+			wantErr: &ParseError{
+				metadata: Metadata{
+					version:       1,
+					cmdCode:       1,
+					correlationId: 4,
+				},
+				err: ErrPasswordlessLoginDisabled,
+			},
+		},
+		{
+			name:    "error: no more frames",
+			stream:  generateStream(""),
+			wantRes: nil,
+			wantErr: io.EOF,
+		},
+		{
+			name:    "error: frame too large",
+			stream:  generateStream("\xFF\xFF\xFF\xFF\x01\x00\x02\x00\x00\x00\x05\x00\x03msg"),
+			wantRes: nil,
+			wantErr: &FrameError{
+				metadata: Metadata{
+					version:       1,
+					cmdCode:       2,
+					correlationId: 5,
+				},
+				err: fmt.Errorf("%w: %d bytes, the maximum is %d", ErrFrameTooLarge, uint32(0xFFFFFFFF), testLimits.MaxFrameSize),
+			},
+		},
+		{
+			name:    "error: frame too large gets skipped",
+			stream:  generateStream("\x00\x00\x01\x07\x01\x00\x02\x00\x00\x00\x05" + strings.Repeat("x", 0x100)),
+			limits:  &skipOversized,
+			wantRes: nil,
+			wantErr: &ParseError{
+				metadata: Metadata{
+					version:       1,
+					cmdCode:       2,
+					correlationId: 5,
+				},
+				err: fmt.Errorf("%w: %d bytes, the maximum is %d", ErrFrameTooLarge, 0x107, testLimits.MaxFrameSize),
+			},
+		},
+		{
+			name:    "error: frame too large and truncated",
+			stream:  generateStream("\x00\x00\x01\x07\x01\x00\x02\x00\x00\x00\x05xx"),
+			limits:  &skipOversized,
+			wantRes: nil,
+			wantErr: &FrameError{
+				metadata: Metadata{
+					version:       1,
+					cmdCode:       2,
+					correlationId: 5,
+				},
+				err: fmt.Errorf("%w: %w", ErrTruncatedFrame, io.ErrUnexpectedEOF),
+			},
+		},
+		{
+			name:    "error: username too long",
+			stream:  generateStream("\x00\x00\x00\x1B\x01\x00\x01\x00\x00\x00\x01\x00\x12TestUserWithLongName"),
+			wantRes: nil,
+			wantErr: &ParseError{
+				metadata: Metadata{
+					version:       1,
+					cmdCode:       1,
+					correlationId: 1,
+				},
+				err: fmt.Errorf("%w: username longer than %d bytes", ErrFieldTooLong, testLimits.MaxUsernameLength),
+			},
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 
-			res, err := ParseCommand(tt.stream)
+			limits := testLimits
+			if tt.limits != nil {
+				limits = *tt.limits
+			}
+
+			policy := testPolicy
+			if tt.policy != nil {
+				policy = *tt.policy
+			}
+
+			res, err := ParseCommand(&Session{conn: tt.stream, phase: tt.phase, version: tt.version, features: tt.features, policy: policy}, limits)
 
 			assert.Equal(t, tt.wantRes, res)
 			assert.Equal(t, tt.wantErr, err)
@@ -109,6 +358,16 @@ func Test_ParseCommand(t *testing.T) {
 	}
 }
 
+var testLimits = Limits{
+	MaxFrameSize:      0x100,
+	MaxUsernameLength: 16,
+	MaxMessageLength:  32,
+}
+
+var testPolicy = Policy{
+	AllowPasswordlessLogin: true,
+}
+
 func generateStream(body string) net.Conn {
 	server, client := net.Pipe()
 	go func() {
@@ -0,0 +1,118 @@
+package commands
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"maps"
+	"net"
+	"slices"
+	"tcpserver/logging"
+	"tcpserver/protocol"
+	"time"
+)
+
+const (
+	BroadcastCommandCode = protocol.CodeBroadcast
+
+	// BroadcastFlagOnlineOnly restricts the broadcast to the users currently online
+	BroadcastFlagOnlineOnly = protocol.BroadcastFlagOnlineOnly
+)
+
+// BroadcastCommand sends a message to all the known users, except the sender.
+// Its response carries the number of users the message has been sent to, as a uint32:
+// the users whose mailbox is full are skipped.
+type BroadcastCommand struct {
+	metadata   Metadata
+	message    string
+	from       string
+	onlineOnly bool
+	timestamp  time.Time
+	conn       net.Conn
+}
+
+func NewBroadcastCommand(
+	metadata Metadata,
+	stream io.Reader,
+	conn net.Conn,
+) (*BroadcastCommand, error) {
+
+	var frame protocol.Broadcast
+	err := frame.Decode(stream)
+	if err != nil {
+		return nil, err
+	}
+
+	bc := &BroadcastCommand{
+		metadata:   metadata,
+		message:    frame.Message,
+		from:       frame.From,
+		onlineOnly: frame.Flags&BroadcastFlagOnlineOnly != 0,
+		timestamp:  frame.Timestamp,
+		conn:       conn,
+	}
+
+	return bc, nil
+}
+
+func (bc *BroadcastCommand) Process(state State) (Frame, error) {
+
+	from, err := sessionSender(state, bc.conn, bc.from)
+	if err != nil {
+		return newErrorResponse(bc.metadata, err), nil
+	}
+
+	users := state.Users()
+
+	var sent uint32
+	for _, username := range slices.Sorted(maps.Keys(users)) {
+
+		if username == from {
+			continue
+		}
+		if bc.onlineOnly && !users[username] {
+			continue
+		}
+
+		// a full mailbox doesn't stop the broadcast to the other users
+		err := state.EnqueueMessage(from, username, bc.timestamp, bc.message)
+		if StatusCode(err) == ResponseStatusCodeMailboxFull {
+			continue
+		}
+		if err != nil {
+			return newErrorResponse(bc.metadata, err), nil
+		}
+		sent++
+	}
+
+	var body bytes.Buffer
+	err = (&protocol.BroadcastResult{Sent: sent}).Encode(&body)
+	if err != nil {
+		return newErrorResponse(bc.metadata, err), nil
+	}
+
+	resp := newResponse(bc.metadata, ResponseStatusCodeOK)
+	resp.body = body.Bytes()
+
+	return resp, nil
+}
+
+func (bc *BroadcastCommand) checkLimits(limits Limits) error {
+	err := limits.checkMessage(bc.message)
+	if err != nil {
+		return err
+	}
+
+	return limits.checkUsernames(bc.from)
+}
+
+// LogValue describes the command in the logs
+func (bc *BroadcastCommand) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.String("name", "Broadcast"),
+		slog.String("from", bc.from),
+		slog.Bool("online_only", bc.onlineOnly),
+		slog.Time("time", bc.timestamp),
+		logging.Payload(bc.message),
+	)
+}
@@ -0,0 +1,208 @@
+package commands
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net"
+	"tcpserver/state"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_NewBroadcastCommand(t *testing.T) {
+	mockConn := net.TCPConn{}
+
+	tests := []struct {
+		name    string
+		body    string
+		wantRes *BroadcastCommand
+		wantErr error
+	}{
+		{
+			name: "happy path: correct broadcast packet gets parsed",
+			body: "\x00\x03msg\x00\x03usr\x00\x18\x16\x68\x7E\xC0\x57\x00\x00",
+			wantRes: &BroadcastCommand{
+				metadata:   Metadata{},
+				message:    "msg",
+				from:       "usr",
+				onlineOnly: false,
+				timestamp:  time.Unix(1735689600, 0),
+				conn:       &mockConn,
+			},
+			wantErr: nil,
+		},
+		{
+			name: "happy path: online only broadcast",
+			body: "\x00\x03msg\x00\x03usr\x01\x18\x16\x68\x7E\xC0\x57\x00\x00",
+			wantRes: &BroadcastCommand{
+				metadata:   Metadata{},
+				message:    "msg",
+				from:       "usr",
+				onlineOnly: true,
+				timestamp:  time.Unix(1735689600, 0),
+				conn:       &mockConn,
+			},
+			wantErr: nil,
+		},
+		{
+			name:    "error: malformed command, flags field missing",
+			body:    "\x00\x03msg\x00\x03usr",
+			wantRes: nil,
+			wantErr: io.EOF,
+		},
+		{
+			name:    "error: malformed command, timestamp field too short",
+			body:    "\x00\x03msg\x00\x03usr\x00\x18\x16",
+			wantRes: nil,
+			wantErr: io.ErrUnexpectedEOF,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			buf := bufio.NewReader(bytes.NewBuffer([]byte(tt.body)))
+
+			res, err := NewBroadcastCommand(Metadata{}, buf, &mockConn)
+
+			assert.Equal(t, tt.wantRes, res)
+			assert.Equal(t, tt.wantErr, err)
+		})
+	}
+}
+
+func Test_BroadcastCommand_Process(t *testing.T) {
+	mockConn1 := net.TCPConn{}
+	mockConn2 := net.TCPConn{}
+	mockConn3 := net.TCPConn{}
+	metadata := Metadata{
+		version:       1,
+		cmdCode:       BroadcastCommandCode,
+		correlationId: 1,
+	}
+	tests := []struct {
+		name         string
+		bc           *BroadcastCommand
+		wantRes      *Response
+		wantMessages map[string]int
+	}{
+		{
+			name: "happy path: all the users but the sender get the message",
+			bc: &BroadcastCommand{
+				metadata: metadata,
+				from:     "sender",
+				conn:     &mockConn1,
+				message:  "message",
+			},
+			wantRes: &Response{
+				version:       1,
+				correlationID: 1,
+				statusCode:    ResponseStatusCodeOK,
+				body:          []byte("\x00\x00\x00\x02"),
+			},
+			wantMessages: map[string]int{"sender": 0, "online": 1, "offline": 1},
+		},
+		{
+			name: "happy path: only the online users get the message",
+			bc: &BroadcastCommand{
+				metadata:   metadata,
+				from:       "sender",
+				conn:       &mockConn1,
+				message:    "message",
+				onlineOnly: true,
+			},
+			wantRes: &Response{
+				version:       1,
+				correlationID: 1,
+				statusCode:    ResponseStatusCodeOK,
+				body:          []byte("\x00\x00\x00\x01"),
+			},
+			wantMessages: map[string]int{"sender": 0, "online": 1, "offline": 0},
+		},
+		{
+			name: "error: connection not logged in",
+			bc: &BroadcastCommand{
+				metadata: metadata,
+				from:     "sender",
+				conn:     &mockConn3,
+				message:  "message",
+			},
+			wantRes: &Response{
+				version:       1,
+				correlationID: 1,
+				statusCode:    ResponseStatusCodeForbidden,
+			},
+			wantMessages: map[string]int{"sender": 0, "online": 0, "offline": 0},
+		},
+		{
+			name: "error: sender doesn't match the logged user",
+			bc: &BroadcastCommand{
+				metadata: metadata,
+				from:     "online",
+				conn:     &mockConn1,
+				message:  "message",
+			},
+			wantRes: &Response{
+				version:       1,
+				correlationID: 1,
+				statusCode:    ResponseStatusCodeForbidden,
+			},
+			wantMessages: map[string]int{"sender": 0, "online": 0, "offline": 0},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			s := state.NewState()
+			_ = s.Login(&mockConn1, "sender")
+			_ = s.Login(&mockConn2, "online")
+			_ = s.Login(&mockConn3, "offline")
+			s.Logout(&mockConn3)
+
+			res, err := tt.bc.Process(s)
+
+			assert.Equal(t, tt.wantRes, res)
+			assert.Nil(t, err)
+			for username, count := range tt.wantMessages {
+				assert.Len(t, s.DrainMailbox(username), count)
+			}
+		})
+	}
+}
+
+func Test_BroadcastCommand_Process_MailboxFull(t *testing.T) {
+	mockConn1 := net.TCPConn{}
+	mockConn2 := net.TCPConn{}
+	mockConn3 := net.TCPConn{}
+
+	s := state.NewStateWithMailboxSize(1)
+	_ = s.Login(&mockConn1, "sender")
+	_ = s.Login(&mockConn2, "full")
+	_ = s.Login(&mockConn3, "empty")
+	_ = s.EnqueueMessage("sender", "full", time.Time{}, "filler")
+
+	bc := &BroadcastCommand{
+		metadata: Metadata{
+			version:       1,
+			cmdCode:       BroadcastCommandCode,
+			correlationId: 1,
+		},
+		from:    "sender",
+		conn:    &mockConn1,
+		message: "message",
+	}
+
+	res, err := bc.Process(s)
+
+	// the users with a full mailbox are skipped
+	assert.Equal(t, &Response{
+		version:       1,
+		correlationID: 1,
+		statusCode:    ResponseStatusCodeOK,
+		body:          []byte("\x00\x00\x00\x01"),
+	}, res)
+	assert.Nil(t, err)
+	assert.Len(t, s.DrainMailbox("empty"), 1)
+}
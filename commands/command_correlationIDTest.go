@@ -1,13 +1,13 @@
 package commands
 
 import (
-	"fmt"
 	"io"
+	"log/slog"
+	"tcpserver/protocol"
 )
 
-var (
-	CorrelationIDTestResponseLength uint32 = 0x0009
-	CorrelationIDTestCommandCode    uint16 = 0x09
+const (
+	CorrelationIDTestCommandCode = protocol.CodeCorrelationIDTest
 )
 
 type CorrelationIDTestCommand struct {
@@ -23,23 +23,16 @@ func NewCorrelationIDTestCommand(
 		metadata: metadata,
 	}
 
-	cc.print()
-
 	return cc, nil
 }
 
-func (cc *CorrelationIDTestCommand) Process(_ State) (*Response, error) {
-	return &Response{
-		version:       cc.metadata.version,
-		correlationID: cc.metadata.correlationId,
-		statusCode:    ResponseStatusCodeOK,
-	}, nil
+func (cc *CorrelationIDTestCommand) Process(_ State) (Frame, error) {
+	return newResponse(cc.metadata, ResponseStatusCodeOK), nil
 }
 
-func (cc *CorrelationIDTestCommand) print() {
-	fmt.Println("-----")
-	fmt.Println("CorrelationID Test")
-	fmt.Printf("\tversion: %d\n", cc.metadata.version)
-	fmt.Printf("\tcorrelationId: %d\n", cc.metadata.correlationId)
-	fmt.Println("-----")
+// LogValue describes the command in the logs
+func (cc *CorrelationIDTestCommand) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.String("name", "CorrelationIDTest"),
+	)
 }
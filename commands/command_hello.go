@@ -0,0 +1,101 @@
+package commands
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log/slog"
+	"slices"
+	"tcpserver/protocol"
+)
+
+const (
+	HelloCommandCode = protocol.CodeHello
+
+	// FeatureSessionTokens tells that the logins are followed by a SessionToken, to use with ResumeCommand
+	FeatureSessionTokens = "session-tokens"
+	// FeaturePasswordlessLogin tells that LoginCommand is accepted
+	FeaturePasswordlessLogin = "passwordless-login"
+	// FeatureDeliveryAcks tells that the messages are delivered with NumberedDelivery,
+	// again and again until AckCommand or ResumeCommand acknowledges them
+	FeatureDeliveryAcks = "delivery-acks"
+)
+
+// HelloCommand negotiates the version of the protocol spoken on the connection, and the optional features
+// enabled on it. The client lists the versions and the features it supports: its response carries
+// the version chosen by the server, as a byte, followed by the features enabled, as a list of strings.
+// The frames following it must be written with the version chosen.
+type HelloCommand struct {
+	metadata Metadata
+	versions []byte
+	features []string
+	session  *Session
+	// offered are the features the server can enable
+	offered []string
+}
+
+func NewHelloCommand(
+	metadata Metadata,
+	stream io.Reader,
+	session *Session,
+	offered []string,
+) (*HelloCommand, error) {
+
+	var frame protocol.Hello
+	err := frame.Decode(stream)
+	if err != nil {
+		return nil, err
+	}
+
+	hc := &HelloCommand{
+		metadata: metadata,
+		versions: frame.Versions,
+		features: frame.Features,
+		session:  session,
+		offered:  offered,
+	}
+
+	return hc, nil
+}
+
+func (hc *HelloCommand) Process(state State) (Frame, error) {
+
+	// the server picks the version it prefers among the ones supported by the client
+	i := slices.IndexFunc(SupportedVersions, func(v byte) bool {
+		return slices.Contains(hc.versions, v)
+	})
+	if i < 0 {
+		return newErrorResponse(hc.metadata, ErrUnsupportedVersion), nil
+	}
+	version := SupportedVersions[i]
+
+	enabled := []string{}
+	for _, feature := range hc.features {
+		if slices.Contains(hc.offered, feature) && !slices.Contains(enabled, feature) {
+			enabled = append(enabled, feature)
+		}
+	}
+
+	var body bytes.Buffer
+	err := (&protocol.HelloResult{Version: version, Features: enabled}).Encode(&body)
+	if err != nil {
+		return newErrorResponse(hc.metadata, err), nil
+	}
+
+	hc.session.setVersion(version)
+	hc.session.setFeatures(enabled)
+
+	resp := newResponse(hc.metadata, ResponseStatusCodeOK)
+	resp.body = body.Bytes()
+
+	return resp, nil
+}
+
+// LogValue describes the command in the logs
+func (hc *HelloCommand) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.String("name", "Hello"),
+		slog.String("versions", fmt.Sprintf("% X", hc.versions)),
+		slog.Any("features", hc.features),
+	)
+}
@@ -0,0 +1,142 @@
+package commands
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"log/slog"
+	"net"
+	"slices"
+	"tcpserver/state"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_NewHelloCommand(t *testing.T) {
+	session := &Session{}
+	offered := []string{FeatureSessionTokens}
+
+	tests := []struct {
+		name    string
+		body    string
+		wantRes *HelloCommand
+		wantErr error
+	}{
+		{
+			name: "happy path: correct hello packet gets parsed",
+			body: "\x00\x02\x02\x01\x00\x01\x00\x0Esession-tokens",
+			wantRes: &HelloCommand{
+				metadata: Metadata{},
+				versions: []byte{ProtocolVersion2, ProtocolVersion},
+				features: []string{FeatureSessionTokens},
+				session:  session,
+				offered:  offered,
+			},
+			wantErr: nil,
+		},
+		{
+			name:    "error: malformed command, features missing",
+			body:    "\x00\x01\x01",
+			wantRes: nil,
+			wantErr: io.EOF,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			buf := bufio.NewReader(bytes.NewBuffer([]byte(tt.body)))
+
+			res, err := NewHelloCommand(Metadata{}, buf, session, offered)
+
+			assert.Equal(t, tt.wantRes, res)
+			assert.Equal(t, tt.wantErr, err)
+		})
+	}
+}
+
+func Test_HelloCommand_Process(t *testing.T) {
+	metadata := Metadata{
+		version:       1,
+		cmdCode:       HelloCommandCode,
+		correlationId: 1,
+	}
+
+	tests := []struct {
+		name         string
+		versions     []byte
+		features     []string
+		wantRes      *Response
+		wantVersion  byte
+		wantFeatures []string
+	}{
+		{
+			name:     "happy path: the latest version supported by both gets chosen",
+			versions: []byte{ProtocolVersion, ProtocolVersion2, 0x07},
+			features: []string{FeatureSessionTokens, "unknown", FeaturePasswordlessLogin},
+			wantRes: &Response{
+				version:       1,
+				correlationID: 1,
+				statusCode:    ResponseStatusCodeOK,
+				body:          []byte("\x02\x00\x01\x00\x0Esession-tokens"),
+			},
+			wantVersion:  ProtocolVersion2,
+			wantFeatures: []string{FeatureSessionTokens},
+		},
+		{
+			name:     "happy path: a v1 client without features",
+			versions: []byte{ProtocolVersion},
+			features: []string{},
+			wantRes: &Response{
+				version:       1,
+				correlationID: 1,
+				statusCode:    ResponseStatusCodeOK,
+				body:          []byte("\x01\x00\x00"),
+			},
+			wantVersion: ProtocolVersion,
+		},
+		{
+			name:     "error: no version in common",
+			versions: []byte{0x07},
+			wantRes: &Response{
+				version:       1,
+				correlationID: 1,
+				statusCode:    ResponseStatusCodeUnsupportedVersion,
+			},
+			wantVersion: ProtocolVersion,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			session := NewSession(&net.TCPConn{}, nil, testPolicy, nil)
+			hc := &HelloCommand{
+				metadata: metadata,
+				versions: tt.versions,
+				features: tt.features,
+				session:  session,
+				offered:  []string{FeatureSessionTokens},
+			}
+
+			res, err := hc.Process(state.NewState())
+
+			assert.Equal(t, tt.wantRes, res)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantVersion, session.Version())
+			for _, feature := range []string{FeatureSessionTokens, FeaturePasswordlessLogin} {
+				assert.Equal(t, slices.Contains(tt.wantFeatures, feature), session.HasFeature(feature), feature)
+			}
+		})
+	}
+}
+
+func Test_HelloCommand_LogValue(t *testing.T) {
+
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, nil))
+
+	logger.Info("received", "command", &HelloCommand{versions: []byte{2, 1}, features: []string{FeatureSessionTokens}})
+
+	assert.Contains(t, buf.String(), `command.versions="02 01"`)
+	assert.Contains(t, buf.String(), "command.features=[session-tokens]")
+}
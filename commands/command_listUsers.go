@@ -0,0 +1,109 @@
+package commands
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"maps"
+	"slices"
+	"strings"
+	"tcpserver/protocol"
+)
+
+const (
+	ListUsersCommandCode = protocol.CodeListUsers
+
+	// ListUsersMaxLimit is the maximum number of users returned in a single page,
+	// also used when the client doesn't set any limit
+	ListUsersMaxLimit uint16 = 100
+)
+
+// ListUsersCommand returns a page of the known users, sorted by username,
+// each with its online status. The users can be filtered by username prefix.
+// The page starts right after the cursor, that is the last username of the previous page.
+type ListUsersCommand struct {
+	metadata Metadata
+	prefix   string
+	cursor   string
+	limit    uint16
+}
+
+func NewListUsersCommand(
+	metadata Metadata,
+	stream io.Reader,
+) (*ListUsersCommand, error) {
+
+	var frame protocol.ListUsers
+	err := frame.Decode(stream)
+	if err != nil {
+		return nil, err
+	}
+
+	luc := &ListUsersCommand{
+		metadata: metadata,
+		prefix:   frame.Prefix,
+		cursor:   frame.Cursor,
+		limit:    frame.Limit,
+	}
+
+	return luc, nil
+}
+
+func (luc *ListUsersCommand) Process(state State) (Frame, error) {
+
+	limit := luc.limit
+	if limit == 0 || limit > ListUsersMaxLimit {
+		limit = ListUsersMaxLimit
+	}
+
+	users := state.Users()
+
+	page := []string{}
+	nextCursor := ""
+	for _, username := range slices.Sorted(maps.Keys(users)) {
+
+		if !strings.HasPrefix(username, luc.prefix) || username <= luc.cursor {
+			continue
+		}
+
+		// the cursor is returned only if there's at least another user after the page
+		if len(page) == int(limit) {
+			nextCursor = page[len(page)-1]
+			break
+		}
+		page = append(page, username)
+	}
+
+	result := protocol.ListUsersResult{
+		Users:      make([]protocol.UserStatus, 0, len(page)),
+		NextCursor: nextCursor,
+	}
+	for _, username := range page {
+		result.Users = append(result.Users, protocol.UserStatus{Username: username, Online: users[username]})
+	}
+
+	var body bytes.Buffer
+	err := result.Encode(&body)
+	if err != nil {
+		return newErrorResponse(luc.metadata, err), nil
+	}
+
+	resp := newResponse(luc.metadata, ResponseStatusCodeOK)
+	resp.body = body.Bytes()
+
+	return resp, nil
+}
+
+func (luc *ListUsersCommand) checkLimits(limits Limits) error {
+	return limits.checkUsernames(luc.prefix, luc.cursor)
+}
+
+// LogValue describes the command in the logs
+func (luc *ListUsersCommand) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.String("name", "ListUsers"),
+		slog.String("prefix", luc.prefix),
+		slog.String("cursor", luc.cursor),
+		slog.Int("limit", int(luc.limit)),
+	)
+}
@@ -0,0 +1,158 @@
+package commands
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net"
+	"tcpserver/state"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_NewListUsersCommand(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		wantRes *ListUsersCommand
+		wantErr error
+	}{
+		{
+			name: "happy path: correct list users packet gets parsed",
+			body: "\x00\x02us\x00\x05user1\x00\x0A",
+			wantRes: &ListUsersCommand{
+				metadata: Metadata{},
+				prefix:   "us",
+				cursor:   "user1",
+				limit:    10,
+			},
+			wantErr: nil,
+		},
+		{
+			name: "happy path: no filters",
+			body: "\x00\x00\x00\x00\x00\x00",
+			wantRes: &ListUsersCommand{
+				metadata: Metadata{},
+				prefix:   "",
+				cursor:   "",
+				limit:    0,
+			},
+			wantErr: nil,
+		},
+		{
+			name:    "error: malformed command, limit field too short",
+			body:    "\x00\x00\x00\x00\x00",
+			wantRes: nil,
+			wantErr: io.ErrUnexpectedEOF,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			buf := bufio.NewReader(bytes.NewBuffer([]byte(tt.body)))
+
+			res, err := NewListUsersCommand(Metadata{}, buf)
+
+			assert.Equal(t, tt.wantRes, res)
+			assert.Equal(t, tt.wantErr, err)
+		})
+	}
+}
+
+func Test_ListUsersCommand_Process(t *testing.T) {
+	mockConn1 := net.TCPConn{}
+	mockConn2 := net.TCPConn{}
+	mockConn3 := net.TCPConn{}
+	metadata := Metadata{
+		version:       1,
+		cmdCode:       ListUsersCommandCode,
+		correlationId: 1,
+	}
+	tests := []struct {
+		name    string
+		luc     *ListUsersCommand
+		wantRes *Response
+	}{
+		{
+			name: "happy path: all the users",
+			luc: &ListUsersCommand{
+				metadata: metadata,
+			},
+			wantRes: &Response{
+				version:       1,
+				correlationID: 1,
+				statusCode:    ResponseStatusCodeOK,
+				body:          []byte("\x00\x03\x00\x05alice\x01\x00\x03bob\x00\x00\x05bobby\x01\x00\x00"),
+			},
+		},
+		{
+			name: "happy path: filtered by prefix",
+			luc: &ListUsersCommand{
+				metadata: metadata,
+				prefix:   "bob",
+			},
+			wantRes: &Response{
+				version:       1,
+				correlationID: 1,
+				statusCode:    ResponseStatusCodeOK,
+				body:          []byte("\x00\x02\x00\x03bob\x00\x00\x05bobby\x01\x00\x00"),
+			},
+		},
+		{
+			name: "happy path: first page",
+			luc: &ListUsersCommand{
+				metadata: metadata,
+				limit:    2,
+			},
+			wantRes: &Response{
+				version:       1,
+				correlationID: 1,
+				statusCode:    ResponseStatusCodeOK,
+				body:          []byte("\x00\x02\x00\x05alice\x01\x00\x03bob\x00\x00\x03bob"),
+			},
+		},
+		{
+			name: "happy path: last page",
+			luc: &ListUsersCommand{
+				metadata: metadata,
+				cursor:   "bob",
+				limit:    2,
+			},
+			wantRes: &Response{
+				version:       1,
+				correlationID: 1,
+				statusCode:    ResponseStatusCodeOK,
+				body:          []byte("\x00\x01\x00\x05bobby\x01\x00\x00"),
+			},
+		},
+		{
+			name: "happy path: no matching users",
+			luc: &ListUsersCommand{
+				metadata: metadata,
+				prefix:   "carol",
+			},
+			wantRes: &Response{
+				version:       1,
+				correlationID: 1,
+				statusCode:    ResponseStatusCodeOK,
+				body:          []byte("\x00\x00\x00\x00"),
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			s := state.NewState()
+			_ = s.Login(&mockConn1, "alice")
+			_ = s.Login(&mockConn2, "bob")
+			_ = s.Login(&mockConn3, "bobby")
+			s.Logout(&mockConn2)
+
+			res, err := tt.luc.Process(s)
+
+			assert.Equal(t, tt.wantRes, res)
+			assert.Nil(t, err)
+		})
+	}
+}
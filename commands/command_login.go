@@ -1,70 +1,67 @@
 package commands
 
 import (
-	"encoding/binary"
-	"fmt"
 	"io"
+	"log/slog"
 	"net"
+	"tcpserver/protocol"
 )
 
 const (
-	LoginCommandCode uint16 = 0x01
+	LoginCommandCode = protocol.CodeLogin
 )
 
+// LoginCommand logs in a user on their username alone, creating them if they don't exist yet.
+// It's refused unless the passwordless login is allowed (see Policy).
 type LoginCommand struct {
 	metadata Metadata
 	username string
 	conn     net.Conn
+	// tokens is set when the client asked for FeatureSessionTokens with HelloCommand
+	tokens bool
 }
 
 func NewLoginCommand(
 	metadata Metadata,
 	stream io.Reader,
 	conn net.Conn,
+	tokens bool,
 ) (*LoginCommand, error) {
 
-	var usernameLen uint16
-	lErr := binary.Read(stream, binary.BigEndian, &usernameLen)
-	if lErr != nil {
-		return nil, lErr
-	}
-
-	username := make([]byte, usernameLen)
-	_, uErr := io.ReadFull(stream, username)
-	if uErr != nil {
-		return nil, uErr
+	var frame protocol.Login
+	err := frame.Decode(stream)
+	if err != nil {
+		return nil, err
 	}
 
 	lc := &LoginCommand{
 		metadata: metadata,
-		username: string(username),
+		username: frame.Username,
 		conn:     conn,
+		tokens:   tokens,
 	}
 
-	lc.print()
-
 	return lc, nil
 }
 
-func (lc *LoginCommand) Process(state State) (*Response, error) {
+func (lc *LoginCommand) Process(state State) (Frame, error) {
 
 	err := state.Login(lc.conn, lc.username)
 	if err != nil {
-		return nil, err
+		return newErrorResponse(lc.metadata, err), nil
 	}
 
-	return &Response{
-		version:       lc.metadata.version,
-		correlationID: lc.metadata.correlationId,
-		statusCode:    ResponseStatusCodeOK,
-	}, nil
+	return loggedIn(state, lc.metadata, lc.username, lc.tokens)
+}
+
+func (lc *LoginCommand) checkLimits(limits Limits) error {
+	return limits.checkUsernames(lc.username)
 }
 
-func (lc *LoginCommand) print() {
-	fmt.Println("-----")
-	fmt.Println("Login")
-	fmt.Printf("\tversion: %d\n", lc.metadata.version)
-	fmt.Printf("\tcorrelationId: %d\n", lc.metadata.correlationId)
-	fmt.Printf("\tusername: %s\n", lc.username)
-	fmt.Println("-----")
+// LogValue describes the command in the logs
+func (lc *LoginCommand) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.String("name", "Login"),
+		slog.String("username", lc.username),
+	)
 }
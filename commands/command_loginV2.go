@@ -0,0 +1,68 @@
+package commands
+
+import (
+	"io"
+	"log/slog"
+	"net"
+	"tcpserver/protocol"
+)
+
+const (
+	LoginV2CommandCode = protocol.CodeLoginV2
+)
+
+// LoginV2Command logs in a user created by RegisterCommand, authenticating them with their password
+type LoginV2Command struct {
+	metadata Metadata
+	username string
+	password string
+	conn     net.Conn
+	// tokens is set when the client asked for FeatureSessionTokens with HelloCommand
+	tokens bool
+}
+
+func NewLoginV2Command(
+	metadata Metadata,
+	stream io.Reader,
+	conn net.Conn,
+	tokens bool,
+) (*LoginV2Command, error) {
+
+	var frame protocol.LoginV2
+	err := frame.Decode(stream)
+	if err != nil {
+		return nil, err
+	}
+
+	lc := &LoginV2Command{
+		metadata: metadata,
+		username: frame.Username,
+		password: frame.Password,
+		conn:     conn,
+		tokens:   tokens,
+	}
+
+	return lc, nil
+}
+
+func (lc *LoginV2Command) Process(state State) (Frame, error) {
+
+	err := state.LoginWithPassword(lc.conn, lc.username, lc.password)
+	if err != nil {
+		return newErrorResponse(lc.metadata, err), nil
+	}
+
+	return loggedIn(state, lc.metadata, lc.username, lc.tokens)
+}
+
+func (lc *LoginV2Command) checkLimits(limits Limits) error {
+	return limits.checkUsernames(lc.username)
+}
+
+// LogValue describes the command in the logs, leaving the password out
+func (lc *LoginV2Command) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.String("name", "LoginV2"),
+		slog.String("username", lc.username),
+	)
+}
@@ -0,0 +1,119 @@
+package commands
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"log/slog"
+	"net"
+	"strings"
+	"tcpserver/state"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_NewLoginV2Command(t *testing.T) {
+	mockConn := net.TCPConn{}
+
+	tests := []struct {
+		name    string
+		body    string
+		wantRes *LoginV2Command
+		wantErr error
+	}{
+		{
+			name: "happy path: correct loginV2 packet gets parsed",
+			body: "\x00\x05alice\x00\x06secret",
+			wantRes: &LoginV2Command{
+				metadata: Metadata{},
+				username: "alice",
+				password: "secret",
+				conn:     &mockConn,
+			},
+			wantErr: nil,
+		},
+		{
+			name:    "error: malformed command, password length incorrect",
+			body:    "\x00\x05alice\x00\x06short",
+			wantRes: nil,
+			wantErr: io.ErrUnexpectedEOF,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			buf := bufio.NewReader(bytes.NewBuffer([]byte(tt.body)))
+
+			res, err := NewLoginV2Command(Metadata{}, buf, &mockConn, false)
+
+			assert.Equal(t, tt.wantRes, res)
+			assert.Equal(t, tt.wantErr, err)
+		})
+	}
+}
+
+func Test_LoginV2Command_Process(t *testing.T) {
+	fastPasswordHashing(t)
+	mockConn := net.TCPConn{}
+	metadata := Metadata{
+		version:       1,
+		cmdCode:       LoginV2CommandCode,
+		correlationId: 1,
+	}
+
+	tests := []struct {
+		name           string
+		username       string
+		password       string
+		wantStatusCode uint16
+		wantLoggedIn   bool
+	}{
+		{
+			name:           "happy path: loginV2 command gets processed",
+			username:       "alice",
+			password:       "secret",
+			wantStatusCode: ResponseStatusCodeOK,
+			wantLoggedIn:   true,
+		},
+		{
+			name:           "error: wrong password",
+			username:       "alice",
+			password:       "wrong",
+			wantStatusCode: ResponseStatusCodeBadCredentials,
+		},
+		{
+			name:           "error: unknown user",
+			username:       "bob",
+			password:       "secret",
+			wantStatusCode: ResponseStatusCodeBadCredentials,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			s := state.NewState()
+			require.NoError(t, s.Register("alice", "secret"))
+			lc := &LoginV2Command{metadata: metadata, username: tt.username, password: tt.password, conn: &mockConn}
+
+			res, err := lc.Process(s)
+
+			assert.Equal(t, &Response{version: 1, correlationID: 1, statusCode: tt.wantStatusCode}, res)
+			assert.NoError(t, err)
+			_, loggedIn := s.Username(&mockConn)
+			assert.Equal(t, tt.wantLoggedIn, loggedIn)
+		})
+	}
+}
+
+func Test_LoginV2Command_LogValue(t *testing.T) {
+
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, nil))
+
+	logger.Info("received", "command", &LoginV2Command{username: "alice", password: "secret"})
+
+	assert.Contains(t, buf.String(), "command.username=alice")
+	assert.False(t, strings.Contains(buf.String(), "secret"))
+}
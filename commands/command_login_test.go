@@ -48,7 +48,7 @@ func Test_NewLoginCommand(t *testing.T) {
 
 			buf := bufio.NewReader(bytes.NewBuffer([]byte(tt.body)))
 
-			res, err := NewLoginCommand(Metadata{}, buf, &mockConn)
+			res, err := NewLoginCommand(Metadata{}, buf, &mockConn, false)
 
 			assert.Equal(t, tt.wantRes, res)
 			assert.Equal(t, tt.wantErr, err)
@@ -118,13 +118,17 @@ func Test_LoginCommand_Process(t *testing.T) {
 					"user1": true,
 				},
 			},
-			wantRes: nil,
+			wantRes: &Response{
+				version:       1,
+				correlationID: 1,
+				statusCode:    ResponseStatusCodeUserAlreadyLogged,
+			},
 			wantState: state.State{
 				LoggedUsers: map[string]bool{
 					"user1": true,
 				},
 			},
-			wantErr: state.ErrUserAlreadyOnline,
+			wantErr: nil,
 		},
 	}
 	for _, tt := range tests {
@@ -135,7 +139,7 @@ func Test_LoginCommand_Process(t *testing.T) {
 			assert.Equal(t, tt.wantRes, res)
 			assert.Equal(t, tt.wantState.LoggedUsers, tt.state.LoggedUsers)
 			assert.Equal(t, tt.wantState.Connections, tt.state.Connections)
-			assert.Equal(t, tt.wantState.Messages, tt.state.Messages)
+			assert.Equal(t, tt.wantState.Mailboxes, tt.state.Mailboxes)
 			assert.Equal(t, tt.wantState.Interrupts, tt.state.Interrupts)
 			assert.Equal(t, tt.wantErr, err)
 		})
@@ -0,0 +1,52 @@
+package commands
+
+import (
+	"io"
+	"log/slog"
+	"net"
+	"tcpserver/protocol"
+)
+
+const (
+	LogoutCommandCode = protocol.CodeLogout
+)
+
+type LogoutCommand struct {
+	metadata Metadata
+	conn     net.Conn
+}
+
+func NewLogoutCommand(
+	metadata Metadata,
+	stream io.Reader,
+	conn net.Conn,
+) (*LogoutCommand, error) {
+
+	lc := &LogoutCommand{
+		metadata: metadata,
+		conn:     conn,
+	}
+
+	return lc, nil
+}
+
+func (lc *LogoutCommand) Process(state State) (Frame, error) {
+
+	// logging out on purpose ends the session for good, so it can't be resumed
+	username, ok := state.Username(lc.conn)
+	if ok {
+		state.RevokeTokens(username)
+	}
+
+	// the connection stays open, so that it can be used to log in again
+	state.Logout(lc.conn)
+
+	return newResponse(lc.metadata, ResponseStatusCodeOK), nil
+}
+
+// LogValue describes the command in the logs
+func (lc *LogoutCommand) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.String("name", "Logout"),
+	)
+}
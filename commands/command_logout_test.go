@@ -0,0 +1,132 @@
+package commands
+
+import (
+	"bufio"
+	"bytes"
+	"net"
+	"tcpserver/state"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_NewLogoutCommand(t *testing.T) {
+	mockConn := net.TCPConn{}
+
+	buf := bufio.NewReader(bytes.NewBuffer([]byte{}))
+
+	res, err := NewLogoutCommand(Metadata{}, buf, &mockConn)
+
+	assert.Equal(t, &LogoutCommand{
+		metadata: Metadata{},
+		conn:     &mockConn,
+	}, res)
+	assert.Nil(t, err)
+}
+
+func Test_LogoutCommand_Process(t *testing.T) {
+	mockConn1 := net.TCPConn{}
+	mockConn2 := net.TCPConn{}
+	tests := []*struct {
+		name      string
+		lc        *LogoutCommand
+		state     state.State
+		wantRes   *Response
+		wantState state.State
+	}{
+		{
+			name: "happy path: logout command gets processed",
+			lc: &LogoutCommand{
+				metadata: Metadata{
+					version:       1,
+					cmdCode:       LogoutCommandCode,
+					correlationId: 1,
+				},
+				conn: &mockConn2,
+			},
+			state: state.State{
+				LoggedUsers: map[string]bool{
+					"user1": true,
+					"user2": true,
+				},
+				Connections: map[net.Conn]string{
+					&mockConn1: "user1",
+					&mockConn2: "user2",
+				},
+			},
+			wantRes: &Response{
+				version:       1,
+				correlationID: 1,
+				statusCode:    ResponseStatusCodeOK,
+			},
+			wantState: state.State{
+				LoggedUsers: map[string]bool{
+					"user1": true,
+					"user2": false,
+				},
+				Connections: map[net.Conn]string{
+					&mockConn1: "user1",
+				},
+			},
+		},
+		{
+			name: "happy path: connection not logged in",
+			lc: &LogoutCommand{
+				metadata: Metadata{
+					version:       1,
+					cmdCode:       LogoutCommandCode,
+					correlationId: 1,
+				},
+				conn: &mockConn2,
+			},
+			state: state.State{
+				LoggedUsers: map[string]bool{
+					"user1": true,
+				},
+				Connections: map[net.Conn]string{
+					&mockConn1: "user1",
+				},
+			},
+			wantRes: &Response{
+				version:       1,
+				correlationID: 1,
+				statusCode:    ResponseStatusCodeOK,
+			},
+			wantState: state.State{
+				LoggedUsers: map[string]bool{
+					"user1": true,
+				},
+				Connections: map[net.Conn]string{
+					&mockConn1: "user1",
+				},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			res, err := tt.lc.Process(&tt.state)
+
+			assert.Equal(t, tt.wantRes, res)
+			assert.Equal(t, tt.wantState.LoggedUsers, tt.state.LoggedUsers)
+			assert.Equal(t, tt.wantState.Connections, tt.state.Connections)
+			assert.Nil(t, err)
+		})
+	}
+}
+
+func Test_LogoutCommand_RevokesTokens(t *testing.T) {
+	mockConn := net.TCPConn{}
+	s := tokenState()
+	require.NoError(t, s.Login(&mockConn, "alice"))
+	token, _, err := s.IssueToken("alice")
+	require.NoError(t, err)
+
+	_, err = (&LogoutCommand{conn: &mockConn}).Process(s)
+	require.NoError(t, err)
+
+	// the session ended on purpose, so it can't be resumed
+	_, err = s.Resume(&mockConn, token)
+	assert.Equal(t, state.ErrInvalidToken, err)
+}
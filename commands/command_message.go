@@ -1,88 +1,115 @@
 package commands
 
 import (
-	"encoding/binary"
-	"fmt"
 	"io"
+	"log/slog"
+	"net"
+	"tcpserver/logging"
+	"tcpserver/protocol"
 	"time"
 )
 
 const (
-	MessageCommandCode uint16 = 0x02
+	MessageCommandCode = protocol.CodeMessage
 )
 
 type MessageCommand struct {
-	metadata  Metadata
-	message   string
-	from      string
-	to        string
-	timestamp time.Time
+	metadata Metadata
+	message  string
+	from     string
+	// fromSession is set by ProtocolVersion2, whose messages don't carry the sender:
+	// it's the user logged in on the connection
+	fromSession bool
+	to          string
+	timestamp   time.Time
+	conn        net.Conn
 }
 
 func NewMessageCommand(
 	metadata Metadata,
 	stream io.Reader,
+	conn net.Conn,
 ) (*MessageCommand, error) {
 
-	var mLen uint16
-	message, mErr := readFieldWithLength(stream, mLen)
-	if mErr != nil {
-		return nil, mErr
+	var frame protocol.Message
+	err := frame.Decode(stream)
+	if err != nil {
+		return nil, err
 	}
 
-	var fLen uint16
-	from, fErr := readFieldWithLength(stream, fLen)
-	if fErr != nil {
-		return nil, fErr
+	mc := &MessageCommand{
+		metadata:  metadata,
+		message:   frame.Message,
+		from:      frame.From,
+		to:        frame.To,
+		timestamp: frame.Timestamp,
+		conn:      conn,
 	}
 
-	var tLen uint16
-	to, tErr := readFieldWithLength(stream, tLen)
-	if tErr != nil {
-		return nil, tErr
-	}
+	return mc, nil
+}
+
+// NewMessageCommandV2 parses the MessageCommand of ProtocolVersion2, which doesn't carry the sender
+func NewMessageCommandV2(
+	metadata Metadata,
+	stream io.Reader,
+	conn net.Conn,
+) (*MessageCommand, error) {
 
-	var timestamp int64
-	err := binary.Read(stream, binary.BigEndian, &timestamp)
+	var frame protocol.MessageV2
+	err := frame.Decode(stream)
 	if err != nil {
 		return nil, err
 	}
 
 	mc := &MessageCommand{
-		metadata:  metadata,
-		message:   string(message),
-		from:      string(from),
-		to:        string(to),
-		timestamp: time.Unix(0, timestamp),
+		metadata:    metadata,
+		message:     frame.Message,
+		fromSession: true,
+		to:          frame.To,
+		timestamp:   frame.Timestamp,
+		conn:        conn,
 	}
 
-	mc.print()
-
 	return mc, nil
 }
 
-func (mc *MessageCommand) Process(state State) (*Response, error) {
+func (mc *MessageCommand) Process(state State) (Frame, error) {
+
+	claimed := mc.from
+	if mc.fromSession {
+		claimed, _ = state.Username(mc.conn)
+	}
 
-	err := state.EnqueueMessage(mc.from, mc.to, mc.timestamp, mc.message)
+	from, err := sessionSender(state, mc.conn, claimed)
 	if err != nil {
-		return nil, err
+		return newErrorResponse(mc.metadata, err), nil
+	}
+
+	err = state.EnqueueMessage(from, mc.to, mc.timestamp, mc.message)
+	if err != nil {
+		return newErrorResponse(mc.metadata, err), nil
+	}
+
+	return newResponse(mc.metadata, ResponseStatusCodeOK), nil
+}
+
+func (mc *MessageCommand) checkLimits(limits Limits) error {
+	err := limits.checkMessage(mc.message)
+	if err != nil {
+		return err
 	}
 
-	return &Response{
-		version:       mc.metadata.version,
-		correlationID: mc.metadata.correlationId,
-		statusCode:    ResponseStatusCodeOK,
-	}, nil
+	return limits.checkUsernames(mc.from, mc.to)
 }
 
-func (mc *MessageCommand) print() {
-	fmt.Println("-----")
-	fmt.Println("Message")
-	fmt.Printf("\tversion: %d\n", mc.metadata.version)
-	fmt.Printf("\tcorrelationId: %d\n", mc.metadata.correlationId)
-	fmt.Printf("\tmessage: %s\n", mc.message)
-	fmt.Printf("\tfrom: %s\n", mc.from)
-	fmt.Printf("\tto: %s\n", mc.to)
-	fmt.Printf("\ttime: %s\n", mc.timestamp.String())
-	fmt.Println("-----")
+// LogValue describes the command in the logs
+func (mc *MessageCommand) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.String("name", "Message"),
+		slog.String("from", mc.from),
+		slog.String("to", mc.to),
+		slog.Time("time", mc.timestamp),
+		logging.Payload(mc.message),
+	)
 }
@@ -13,6 +13,8 @@ import (
 )
 
 func Test_NewMessageCommand(t *testing.T) {
+	mockConn := net.TCPConn{}
+
 	tests := []struct {
 		name    string
 		body    string
@@ -28,6 +30,7 @@ func Test_NewMessageCommand(t *testing.T) {
 				from:      "usr",
 				to:        "rec",
 				timestamp: time.Unix(1735689600, 0),
+				conn:      &mockConn,
 			},
 			wantErr: nil,
 		},
@@ -79,7 +82,49 @@ func Test_NewMessageCommand(t *testing.T) {
 
 			buf := bufio.NewReader(bytes.NewBuffer([]byte(tt.body)))
 
-			res, err := NewMessageCommand(Metadata{}, buf)
+			res, err := NewMessageCommand(Metadata{}, buf, &mockConn)
+
+			assert.Equal(t, tt.wantRes, res)
+			assert.Equal(t, tt.wantErr, err)
+		})
+	}
+}
+
+func Test_NewMessageCommandV2(t *testing.T) {
+	mockConn := net.TCPConn{}
+
+	tests := []struct {
+		name    string
+		body    string
+		wantRes *MessageCommand
+		wantErr error
+	}{
+		{
+			name: "happy path: correct message packet without sender gets parsed",
+			body: "\x00\x03msg\x00\x03rec\x18\x16\x68\x7E\xC0\x57\x00\x00",
+			wantRes: &MessageCommand{
+				metadata:    Metadata{},
+				message:     "msg",
+				fromSession: true,
+				to:          "rec",
+				timestamp:   time.Unix(1735689600, 0),
+				conn:        &mockConn,
+			},
+			wantErr: nil,
+		},
+		{
+			name:    "error: malformed command, timestamp field too short",
+			body:    "\x00\x03msg\x00\x03rec\x18\x16\x68\x7E\xC0\x57",
+			wantRes: nil,
+			wantErr: io.ErrUnexpectedEOF,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			buf := bufio.NewReader(bytes.NewBuffer([]byte(tt.body)))
+
+			res, err := NewMessageCommandV2(Metadata{}, buf, &mockConn)
 
 			assert.Equal(t, tt.wantRes, res)
 			assert.Equal(t, tt.wantErr, err)
@@ -89,6 +134,7 @@ func Test_NewMessageCommand(t *testing.T) {
 
 func Test_MessageCommand_Process(t *testing.T) {
 	mockConn := net.TCPConn{}
+	senderConn := net.TCPConn{}
 	tests := []struct {
 		name    string
 		lc      *MessageCommand
@@ -105,6 +151,7 @@ func Test_MessageCommand_Process(t *testing.T) {
 					correlationId: 1,
 				},
 				from:      "sender",
+				conn:      &senderConn,
 				to:        "recipient",
 				timestamp: time.Time{},
 				message:   "message",
@@ -113,6 +160,7 @@ func Test_MessageCommand_Process(t *testing.T) {
 				s := state.NewState()
 
 				_ = s.Login(&mockConn, "recipient")
+				_ = s.Login(&senderConn, "sender")
 				return s
 			}(),
 			wantRes: &Response{
@@ -122,6 +170,61 @@ func Test_MessageCommand_Process(t *testing.T) {
 			},
 			wantErr: nil,
 		},
+		{
+			name: "happy path: the sender of a v2 message is the logged user",
+			lc: &MessageCommand{
+				metadata: Metadata{
+					version:       2,
+					cmdCode:       MessageCommandCode,
+					correlationId: 1,
+				},
+				fromSession: true,
+				conn:        &senderConn,
+				to:          "recipient",
+				timestamp:   time.Time{},
+				message:     "message",
+			},
+			state: func() *state.State {
+				s := state.NewState()
+
+				_ = s.Login(&mockConn, "recipient")
+				_ = s.Login(&senderConn, "sender")
+				return s
+			}(),
+			wantRes: &Response{
+				version:       2,
+				correlationID: 1,
+				statusCode:    1,
+			},
+			wantErr: nil,
+		},
+		{
+			name: "error: v2 message on a connection not logged in",
+			lc: &MessageCommand{
+				metadata: Metadata{
+					version:       2,
+					cmdCode:       MessageCommandCode,
+					correlationId: 1,
+				},
+				fromSession: true,
+				conn:        &senderConn,
+				to:          "recipient",
+				timestamp:   time.Time{},
+				message:     "message",
+			},
+			state: func() *state.State {
+				s := state.NewState()
+
+				_ = s.Login(&mockConn, "recipient")
+				return s
+			}(),
+			wantRes: &Response{
+				version:       2,
+				correlationID: 1,
+				statusCode:    ResponseStatusCodeForbidden,
+			},
+			wantErr: nil,
+		},
 		{
 			name: "error: recipient doesn't exist",
 			lc: &MessageCommand{
@@ -131,13 +234,78 @@ func Test_MessageCommand_Process(t *testing.T) {
 					correlationId: 1,
 				},
 				from:      "sender",
+				conn:      &senderConn,
 				to:        "recipient",
 				timestamp: time.Time{},
 				message:   "message",
 			},
-			state:   state.NewState(),
-			wantRes: nil,
-			wantErr: state.ErrRecipientNotExists,
+			state: func() *state.State {
+				s := state.NewState()
+
+				_ = s.Login(&senderConn, "sender")
+				return s
+			}(),
+			wantRes: &Response{
+				version:       1,
+				correlationID: 1,
+				statusCode:    ResponseStatusCodeUserNotFound,
+			},
+			wantErr: nil,
+		},
+		{
+			name: "error: connection not logged in",
+			lc: &MessageCommand{
+				metadata: Metadata{
+					version:       1,
+					cmdCode:       MessageCommandCode,
+					correlationId: 1,
+				},
+				from:      "sender",
+				conn:      &senderConn,
+				to:        "recipient",
+				timestamp: time.Time{},
+				message:   "message",
+			},
+			state: func() *state.State {
+				s := state.NewState()
+
+				_ = s.Login(&mockConn, "recipient")
+				return s
+			}(),
+			wantRes: &Response{
+				version:       1,
+				correlationID: 1,
+				statusCode:    ResponseStatusCodeForbidden,
+			},
+			wantErr: nil,
+		},
+		{
+			name: "error: sender doesn't match the logged user",
+			lc: &MessageCommand{
+				metadata: Metadata{
+					version:       1,
+					cmdCode:       MessageCommandCode,
+					correlationId: 1,
+				},
+				from:      "recipient",
+				conn:      &senderConn,
+				to:        "recipient",
+				timestamp: time.Time{},
+				message:   "message",
+			},
+			state: func() *state.State {
+				s := state.NewState()
+
+				_ = s.Login(&mockConn, "recipient")
+				_ = s.Login(&senderConn, "sender")
+				return s
+			}(),
+			wantRes: &Response{
+				version:       1,
+				correlationID: 1,
+				statusCode:    ResponseStatusCodeForbidden,
+			},
+			wantErr: nil,
 		},
 	}
 	for _, tt := range tests {
@@ -0,0 +1,125 @@
+package commands
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"net"
+	"slices"
+	"tcpserver/logging"
+	"tcpserver/protocol"
+	"time"
+)
+
+const (
+	MultiMessageCommandCode = protocol.CodeMultiMessage
+)
+
+// MultiMessageCommand sends the same message to a list of recipients.
+// Its response carries the list of the recipients that couldn't be reached,
+// because they don't exist or their mailbox is full.
+type MultiMessageCommand struct {
+	metadata  Metadata
+	message   string
+	from      string
+	to        []string
+	timestamp time.Time
+	conn      net.Conn
+}
+
+func NewMultiMessageCommand(
+	metadata Metadata,
+	stream io.Reader,
+	conn net.Conn,
+) (*MultiMessageCommand, error) {
+
+	var frame protocol.MultiMessage
+	err := frame.Decode(stream)
+	if err != nil {
+		return nil, err
+	}
+
+	mmc := &MultiMessageCommand{
+		metadata:  metadata,
+		message:   frame.Message,
+		from:      frame.From,
+		to:        frame.To,
+		timestamp: frame.Timestamp,
+		conn:      conn,
+	}
+
+	return mmc, nil
+}
+
+func (mmc *MultiMessageCommand) Process(state State) (Frame, error) {
+
+	from, err := sessionSender(state, mmc.conn, mmc.from)
+	if err != nil {
+		return newErrorResponse(mmc.metadata, err), nil
+	}
+
+	sent := 0
+	unreached := []string{}
+	var unreachedStatusCode uint16
+	for i, to := range mmc.to {
+
+		// the message is sent only once to the recipients listed more than once
+		if slices.Contains(mmc.to[:i], to) {
+			continue
+		}
+
+		err := state.EnqueueMessage(from, to, mmc.timestamp, mmc.message)
+		statusCode := StatusCode(err)
+		if statusCode == ResponseStatusCodeUserNotFound || statusCode == ResponseStatusCodeMailboxFull {
+			if len(unreached) == 0 {
+				unreachedStatusCode = statusCode
+			}
+			unreached = append(unreached, to)
+			continue
+		}
+		if err != nil {
+			return newErrorResponse(mmc.metadata, err), nil
+		}
+		sent++
+	}
+
+	var body bytes.Buffer
+	err = (&protocol.MultiMessageResult{Unreached: unreached}).Encode(&body)
+	if err != nil {
+		return newErrorResponse(mmc.metadata, err), nil
+	}
+
+	// when none of the recipients can be reached, the status tells why the first one couldn't
+	statusCode := ResponseStatusCodeOK
+	if len(unreached) > 0 {
+		statusCode = ResponseStatusCodePartialSuccess
+	}
+	if len(unreached) > 0 && sent == 0 {
+		statusCode = unreachedStatusCode
+	}
+
+	resp := newResponse(mmc.metadata, statusCode)
+	resp.body = body.Bytes()
+
+	return resp, nil
+}
+
+func (mmc *MultiMessageCommand) checkLimits(limits Limits) error {
+	err := limits.checkMessage(mmc.message)
+	if err != nil {
+		return err
+	}
+
+	return limits.checkUsernames(append([]string{mmc.from}, mmc.to...)...)
+}
+
+// LogValue describes the command in the logs
+func (mmc *MultiMessageCommand) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.String("name", "MultiMessage"),
+		slog.String("from", mmc.from),
+		slog.Any("to", mmc.to),
+		slog.Time("time", mmc.timestamp),
+		logging.Payload(mmc.message),
+	)
+}
@@ -0,0 +1,264 @@
+package commands
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net"
+	"tcpserver/state"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_NewMultiMessageCommand(t *testing.T) {
+	mockConn := net.TCPConn{}
+
+	tests := []struct {
+		name    string
+		body    string
+		wantRes *MultiMessageCommand
+		wantErr error
+	}{
+		{
+			name: "happy path: correct multi message packet gets parsed",
+			body: "\x00\x03msg\x00\x03usr\x00\x02\x00\x04rec1\x00\x04rec2\x18\x16\x68\x7E\xC0\x57\x00\x00",
+			wantRes: &MultiMessageCommand{
+				metadata:  Metadata{},
+				message:   "msg",
+				from:      "usr",
+				to:        []string{"rec1", "rec2"},
+				timestamp: time.Unix(1735689600, 0),
+				conn:      &mockConn,
+			},
+			wantErr: nil,
+		},
+		{
+			name: "happy path: empty recipients list",
+			body: "\x00\x03msg\x00\x03usr\x00\x00\x18\x16\x68\x7E\xC0\x57\x00\x00",
+			wantRes: &MultiMessageCommand{
+				metadata:  Metadata{},
+				message:   "msg",
+				from:      "usr",
+				to:        []string{},
+				timestamp: time.Unix(1735689600, 0),
+				conn:      &mockConn,
+			},
+			wantErr: nil,
+		},
+		{
+			name:    "error: malformed command, recipients count too short",
+			body:    "\x00\x03msg\x00\x03usr\x00",
+			wantRes: nil,
+			wantErr: io.ErrUnexpectedEOF,
+		},
+		{
+			name:    "error: malformed command, less recipients than declared",
+			body:    "\x00\x03msg\x00\x03usr\x00\x02\x00\x04rec1",
+			wantRes: nil,
+			wantErr: io.EOF,
+		},
+		{
+			name:    "error: malformed command, timestamp field too short",
+			body:    "\x00\x03msg\x00\x03usr\x00\x01\x00\x04rec1\x18\x16",
+			wantRes: nil,
+			wantErr: io.ErrUnexpectedEOF,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			buf := bufio.NewReader(bytes.NewBuffer([]byte(tt.body)))
+
+			res, err := NewMultiMessageCommand(Metadata{}, buf, &mockConn)
+
+			assert.Equal(t, tt.wantRes, res)
+			assert.Equal(t, tt.wantErr, err)
+		})
+	}
+}
+
+func Test_MultiMessageCommand_Process(t *testing.T) {
+	mockConn1 := net.TCPConn{}
+	mockConn2 := net.TCPConn{}
+	senderConn := net.TCPConn{}
+	anonymousConn := net.TCPConn{}
+	metadata := Metadata{
+		version:       1,
+		cmdCode:       MultiMessageCommandCode,
+		correlationId: 1,
+	}
+	tests := []struct {
+		name         string
+		mmc          *MultiMessageCommand
+		wantRes      *Response
+		wantMessages map[string]int
+	}{
+		{
+			name: "happy path: all the recipients exist",
+			mmc: &MultiMessageCommand{
+				metadata: metadata,
+				from:     "sender",
+				conn:     &senderConn,
+				to:       []string{"rec1", "rec2"},
+				message:  "message",
+			},
+			wantRes: &Response{
+				version:       1,
+				correlationID: 1,
+				statusCode:    ResponseStatusCodeOK,
+				body:          []byte("\x00\x00"),
+			},
+			wantMessages: map[string]int{"rec1": 1, "rec2": 1},
+		},
+		{
+			name: "happy path: duplicated recipients get the message once",
+			mmc: &MultiMessageCommand{
+				metadata: metadata,
+				from:     "sender",
+				conn:     &senderConn,
+				to:       []string{"rec1", "rec1"},
+				message:  "message",
+			},
+			wantRes: &Response{
+				version:       1,
+				correlationID: 1,
+				statusCode:    ResponseStatusCodeOK,
+				body:          []byte("\x00\x00"),
+			},
+			wantMessages: map[string]int{"rec1": 1, "rec2": 0},
+		},
+		{
+			name: "partial success: some recipients don't exist",
+			mmc: &MultiMessageCommand{
+				metadata: metadata,
+				from:     "sender",
+				conn:     &senderConn,
+				to:       []string{"rec1", "unknown", "rec2"},
+				message:  "message",
+			},
+			wantRes: &Response{
+				version:       1,
+				correlationID: 1,
+				statusCode:    ResponseStatusCodePartialSuccess,
+				body:          []byte("\x00\x01\x00\x07unknown"),
+			},
+			wantMessages: map[string]int{"rec1": 1, "rec2": 1},
+		},
+		{
+			name: "error: none of the recipients exist",
+			mmc: &MultiMessageCommand{
+				metadata: metadata,
+				from:     "sender",
+				conn:     &senderConn,
+				to:       []string{"unknown1", "unknown2"},
+				message:  "message",
+			},
+			wantRes: &Response{
+				version:       1,
+				correlationID: 1,
+				statusCode:    ResponseStatusCodeUserNotFound,
+				body:          []byte("\x00\x02\x00\x08unknown1\x00\x08unknown2"),
+			},
+			wantMessages: map[string]int{"rec1": 0, "rec2": 0},
+		},
+		{
+			name: "error: connection not logged in",
+			mmc: &MultiMessageCommand{
+				metadata: metadata,
+				from:     "sender",
+				conn:     &anonymousConn,
+				to:       []string{"rec1", "rec2"},
+				message:  "message",
+			},
+			wantRes: &Response{
+				version:       1,
+				correlationID: 1,
+				statusCode:    ResponseStatusCodeForbidden,
+			},
+			wantMessages: map[string]int{"rec1": 0, "rec2": 0},
+		},
+		{
+			name: "error: sender doesn't match the logged user",
+			mmc: &MultiMessageCommand{
+				metadata: metadata,
+				from:     "rec1",
+				conn:     &senderConn,
+				to:       []string{"rec2"},
+				message:  "message",
+			},
+			wantRes: &Response{
+				version:       1,
+				correlationID: 1,
+				statusCode:    ResponseStatusCodeForbidden,
+			},
+			wantMessages: map[string]int{"rec1": 0, "rec2": 0},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			s := state.NewState()
+			_ = s.Login(&mockConn1, "rec1")
+			_ = s.Login(&mockConn2, "rec2")
+			_ = s.Login(&senderConn, "sender")
+
+			res, err := tt.mmc.Process(s)
+
+			assert.Equal(t, tt.wantRes, res)
+			assert.Nil(t, err)
+			for username, count := range tt.wantMessages {
+				assert.Len(t, s.DrainMailbox(username), count)
+			}
+		})
+	}
+}
+
+func Test_MultiMessageCommand_Process_MailboxFull(t *testing.T) {
+	mockConn1 := net.TCPConn{}
+	mockConn2 := net.TCPConn{}
+	senderConn := net.TCPConn{}
+	metadata := Metadata{
+		version:       1,
+		cmdCode:       MultiMessageCommandCode,
+		correlationId: 1,
+	}
+
+	s := state.NewStateWithMailboxSize(1)
+	_ = s.Login(&mockConn1, "rec1")
+	_ = s.Login(&mockConn2, "rec2")
+	_ = s.Login(&senderConn, "sender")
+	_ = s.EnqueueMessage("sender", "rec1", time.Time{}, "filler")
+
+	mmc := &MultiMessageCommand{
+		metadata: metadata,
+		from:     "sender",
+		conn:     &senderConn,
+		to:       []string{"rec1", "rec2"},
+		message:  "message",
+	}
+
+	res, err := mmc.Process(s)
+
+	assert.Equal(t, &Response{
+		version:       1,
+		correlationID: 1,
+		statusCode:    ResponseStatusCodePartialSuccess,
+		body:          []byte("\x00\x01\x00\x04rec1"),
+	}, res)
+	assert.Nil(t, err)
+
+	// with no recipient reached, the status tells why
+	mmc.to = []string{"rec1"}
+
+	res, err = mmc.Process(s)
+
+	assert.Equal(t, &Response{
+		version:       1,
+		correlationID: 1,
+		statusCode:    ResponseStatusCodeMailboxFull,
+		body:          []byte("\x00\x01\x00\x04rec1"),
+	}, res)
+	assert.Nil(t, err)
+}
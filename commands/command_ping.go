@@ -0,0 +1,61 @@
+package commands
+
+import (
+	"io"
+	"log/slog"
+	"tcpserver/protocol"
+)
+
+const (
+	PingCommandCode = protocol.CodePing
+)
+
+// PingCommand is sent by the client to check that the server is alive.
+// The server answers with a Pong carrying the same correlationId.
+type PingCommand struct {
+	metadata Metadata
+}
+
+func NewPingCommand(
+	metadata Metadata,
+	stream io.Reader,
+) (*PingCommand, error) {
+
+	pc := &PingCommand{
+		metadata: metadata,
+	}
+
+	return pc, nil
+}
+
+func (pc *PingCommand) Process(_ State) (Frame, error) {
+	return &Pong{
+		version:       pc.metadata.version,
+		correlationID: pc.metadata.correlationId,
+	}, nil
+}
+
+// LogValue describes the command in the logs
+func (pc *PingCommand) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.String("name", "Ping"),
+	)
+}
+
+// Ping is the frame sent by the server to check that the client is alive,
+// the client must answer with a Pong carrying the same correlationId
+type Ping struct {
+	version       byte
+	correlationID uint32
+}
+
+func NewPing(correlationID uint32) *Ping {
+	return &Ping{
+		version:       ProtocolVersion,
+		correlationID: correlationID,
+	}
+}
+
+func (p *Ping) Write(out io.Writer) error {
+	return protocol.WriteFrame(out, p.version, p.correlationID, &protocol.Ping{})
+}
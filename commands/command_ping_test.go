@@ -0,0 +1,51 @@
+package commands
+
+import (
+	"bufio"
+	"bytes"
+	"tcpserver/state"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_NewPingCommand(t *testing.T) {
+
+	buf := bufio.NewReader(bytes.NewBuffer([]byte{}))
+
+	res, err := NewPingCommand(Metadata{version: 1, cmdCode: PingCommandCode, correlationId: 42}, buf)
+
+	assert.Equal(t, &PingCommand{
+		metadata: Metadata{version: 1, cmdCode: PingCommandCode, correlationId: 42},
+	}, res)
+	assert.Nil(t, err)
+}
+
+func Test_PingCommand_Process(t *testing.T) {
+
+	pc := &PingCommand{
+		metadata: Metadata{
+			version:       1,
+			cmdCode:       PingCommandCode,
+			correlationId: 42,
+		},
+	}
+
+	res, err := pc.Process(&state.State{})
+
+	assert.Equal(t, &Pong{
+		version:       1,
+		correlationID: 42,
+	}, res)
+	assert.Nil(t, err)
+}
+
+func Test_Ping_Write(t *testing.T) {
+
+	var buf bytes.Buffer
+
+	err := NewPing(3).Write(&buf)
+
+	assert.Equal(t, "\x00\x00\x00\x07\x01\x00\x0C\x00\x00\x00\x03", buf.String())
+	assert.Nil(t, err)
+}
@@ -0,0 +1,50 @@
+package commands
+
+import (
+	"io"
+	"log/slog"
+	"tcpserver/protocol"
+)
+
+const (
+	PongCommandCode = protocol.CodePong
+)
+
+// PongCommand is sent by the client to answer a Ping from the server.
+// Receiving it is enough to know that the client is alive, so it gets no answer.
+type PongCommand struct {
+	metadata Metadata
+}
+
+func NewPongCommand(
+	metadata Metadata,
+	stream io.Reader,
+) (*PongCommand, error) {
+
+	pc := &PongCommand{
+		metadata: metadata,
+	}
+
+	return pc, nil
+}
+
+func (pc *PongCommand) Process(_ State) (Frame, error) {
+	return nil, nil
+}
+
+// LogValue describes the command in the logs
+func (pc *PongCommand) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.String("name", "Pong"),
+	)
+}
+
+// Pong is the frame sent by the server to answer a Ping from the client
+type Pong struct {
+	version       byte
+	correlationID uint32
+}
+
+func (p *Pong) Write(out io.Writer) error {
+	return protocol.WriteFrame(out, p.version, p.correlationID, &protocol.Pong{})
+}
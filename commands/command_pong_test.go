@@ -0,0 +1,48 @@
+package commands
+
+import (
+	"bufio"
+	"bytes"
+	"tcpserver/state"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_NewPongCommand(t *testing.T) {
+
+	buf := bufio.NewReader(bytes.NewBuffer([]byte{}))
+
+	res, err := NewPongCommand(Metadata{version: 1, cmdCode: PongCommandCode, correlationId: 3}, buf)
+
+	assert.Equal(t, &PongCommand{
+		metadata: Metadata{version: 1, cmdCode: PongCommandCode, correlationId: 3},
+	}, res)
+	assert.Nil(t, err)
+}
+
+func Test_PongCommand_Process(t *testing.T) {
+
+	pc := &PongCommand{
+		metadata: Metadata{
+			version:       1,
+			cmdCode:       PongCommandCode,
+			correlationId: 3,
+		},
+	}
+
+	res, err := pc.Process(&state.State{})
+
+	assert.Nil(t, res)
+	assert.Nil(t, err)
+}
+
+func Test_Pong_Write(t *testing.T) {
+
+	var buf bytes.Buffer
+
+	err := (&Pong{version: 1, correlationID: 42}).Write(&buf)
+
+	assert.Equal(t, "\x00\x00\x00\x07\x01\x00\x0D\x00\x00\x00\x2A", buf.String())
+	assert.Nil(t, err)
+}
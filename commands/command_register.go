@@ -0,0 +1,65 @@
+package commands
+
+import (
+	"io"
+	"log/slog"
+	"tcpserver/protocol"
+)
+
+const (
+	RegisterCommandCode = protocol.CodeRegister
+)
+
+// RegisterCommand creates a user who logs in with a password (see LoginV2Command).
+// It doesn't log the user in.
+type RegisterCommand struct {
+	metadata Metadata
+	username string
+	password string
+}
+
+func NewRegisterCommand(
+	metadata Metadata,
+	stream io.Reader,
+) (*RegisterCommand, error) {
+
+	var frame protocol.Register
+	err := frame.Decode(stream)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(frame.Password) == 0 {
+		return nil, ErrEmptyPassword
+	}
+
+	rc := &RegisterCommand{
+		metadata: metadata,
+		username: frame.Username,
+		password: frame.Password,
+	}
+
+	return rc, nil
+}
+
+func (rc *RegisterCommand) Process(state State) (Frame, error) {
+
+	err := state.Register(rc.username, rc.password)
+	if err != nil {
+		return newErrorResponse(rc.metadata, err), nil
+	}
+
+	return newResponse(rc.metadata, ResponseStatusCodeOK), nil
+}
+
+func (rc *RegisterCommand) checkLimits(limits Limits) error {
+	return limits.checkUsernames(rc.username)
+}
+
+// LogValue describes the command in the logs, leaving the password out
+func (rc *RegisterCommand) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.String("name", "Register"),
+		slog.String("username", rc.username),
+	)
+}
@@ -0,0 +1,109 @@
+package commands
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"tcpserver/state"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_NewRegisterCommand(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		wantRes *RegisterCommand
+		wantErr error
+	}{
+		{
+			name: "happy path: correct register packet gets parsed",
+			body: "\x00\x05alice\x00\x06secret",
+			wantRes: &RegisterCommand{
+				metadata: Metadata{},
+				username: "alice",
+				password: "secret",
+			},
+			wantErr: nil,
+		},
+		{
+			name:    "error: malformed command, password missing",
+			body:    "\x00\x05alice",
+			wantRes: nil,
+			wantErr: io.EOF,
+		},
+		{
+			name:    "error: empty password",
+			body:    "\x00\x05alice\x00\x00",
+			wantRes: nil,
+			wantErr: ErrEmptyPassword,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			buf := bufio.NewReader(bytes.NewBuffer([]byte(tt.body)))
+
+			res, err := NewRegisterCommand(Metadata{}, buf)
+
+			assert.Equal(t, tt.wantRes, res)
+			assert.Equal(t, tt.wantErr, err)
+		})
+	}
+}
+
+func Test_RegisterCommand_Process(t *testing.T) {
+	fastPasswordHashing(t)
+	metadata := Metadata{
+		version:       1,
+		cmdCode:       RegisterCommandCode,
+		correlationId: 1,
+	}
+
+	tests := []struct {
+		name     string
+		username string
+		wantRes  *Response
+	}{
+		{
+			name:     "happy path: register command gets processed",
+			username: "alice",
+			wantRes: &Response{
+				version:       1,
+				correlationID: 1,
+				statusCode:    ResponseStatusCodeOK,
+			},
+		},
+		{
+			name:     "error: username taken",
+			username: "bob",
+			wantRes: &Response{
+				version:       1,
+				correlationID: 1,
+				statusCode:    ResponseStatusCodeUsernameTaken,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			s := state.NewState()
+			require.NoError(t, s.Register("bob", "other"))
+			rc := &RegisterCommand{metadata: metadata, username: tt.username, password: "secret"}
+
+			res, err := rc.Process(s)
+
+			assert.Equal(t, tt.wantRes, res)
+			assert.NoError(t, err)
+		})
+	}
+}
+
+// fastPasswordHashing lowers the iterations of the password hashes for the duration of the test
+func fastPasswordHashing(t *testing.T) {
+	iterations := state.PasswordIterations
+	state.PasswordIterations = 1
+	t.Cleanup(func() { state.PasswordIterations = iterations })
+}
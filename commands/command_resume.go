@@ -0,0 +1,72 @@
+package commands
+
+import (
+	"io"
+	"log/slog"
+	"net"
+	"tcpserver/protocol"
+)
+
+const (
+	ResumeCommandCode = protocol.CodeResume
+)
+
+// ResumeCommand logs the user back in on a new connection with the session token received at login,
+// after their previous connection dropped. The messages they didn't receive yet get delivered as after a login,
+// and a new session token replaces the one used. The deliveries up to the last one received, if any,
+// get acknowledged, while the ones after it get delivered again.
+type ResumeCommand struct {
+	metadata     Metadata
+	token        string
+	lastReceived uint64
+	conn         net.Conn
+	// tokens is set when the client asked for FeatureSessionTokens with HelloCommand
+	tokens bool
+}
+
+func NewResumeCommand(
+	metadata Metadata,
+	stream io.Reader,
+	conn net.Conn,
+	tokens bool,
+) (*ResumeCommand, error) {
+
+	var frame protocol.Resume
+	err := frame.Decode(stream)
+	if err != nil {
+		return nil, err
+	}
+
+	rc := &ResumeCommand{
+		metadata:     metadata,
+		token:        frame.Token,
+		lastReceived: frame.LastReceived,
+		conn:         conn,
+		tokens:       tokens,
+	}
+
+	return rc, nil
+}
+
+func (rc *ResumeCommand) Process(state State) (Frame, error) {
+
+	username, err := state.Resume(rc.conn, rc.token)
+	if err != nil {
+		return newErrorResponse(rc.metadata, err), nil
+	}
+
+	// the deliveries are replayed after the response, so they won't include the ones received already
+	if rc.lastReceived > 0 {
+		state.Acknowledge(username, rc.lastReceived)
+	}
+
+	return loggedIn(state, rc.metadata, username, rc.tokens)
+}
+
+// LogValue describes the command in the logs, leaving the token out
+func (rc *ResumeCommand) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.String("name", "Resume"),
+		slog.Uint64("last_received", rc.lastReceived),
+	)
+}
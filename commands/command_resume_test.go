@@ -0,0 +1,146 @@
+package commands
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"log/slog"
+	"net"
+	"strings"
+	"tcpserver/state"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_NewResumeCommand(t *testing.T) {
+	mockConn := net.TCPConn{}
+
+	tests := []struct {
+		name    string
+		body    string
+		wantRes *ResumeCommand
+		wantErr error
+	}{
+		{
+			name: "happy path: correct resume packet gets parsed",
+			body: "\x00\x05token",
+			wantRes: &ResumeCommand{
+				metadata: Metadata{},
+				token:    "token",
+				conn:     &mockConn,
+			},
+			wantErr: nil,
+		},
+		{
+			name: "happy path: resume packet with the last delivery received gets parsed",
+			body: "\x00\x05token\x00\x00\x00\x00\x00\x00\x00\x02",
+			wantRes: &ResumeCommand{
+				metadata:     Metadata{},
+				token:        "token",
+				lastReceived: 2,
+				conn:         &mockConn,
+			},
+			wantErr: nil,
+		},
+		{
+			name:    "error: malformed command, token length incorrect",
+			body:    "\x00\x06token",
+			wantRes: nil,
+			wantErr: io.ErrUnexpectedEOF,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			buf := bufio.NewReader(bytes.NewBuffer([]byte(tt.body)))
+
+			res, err := NewResumeCommand(Metadata{}, buf, &mockConn, false)
+
+			assert.Equal(t, tt.wantRes, res)
+			assert.Equal(t, tt.wantErr, err)
+		})
+	}
+}
+
+func Test_ResumeCommand_Process(t *testing.T) {
+	mockConn := net.TCPConn{}
+	metadata := Metadata{
+		version:       1,
+		cmdCode:       ResumeCommandCode,
+		correlationId: 1,
+	}
+
+	tests := []struct {
+		name           string
+		state          *state.State
+		token          string
+		wantStatusCode uint16
+	}{
+		{
+			name:           "error: invalid token",
+			state:          tokenState(),
+			token:          "invalid",
+			wantStatusCode: ResponseStatusCodeInvalidToken,
+		},
+		{
+			name:           "error: tokens disabled",
+			state:          state.NewState(),
+			token:          "invalid",
+			wantStatusCode: ResponseStatusCodeNotAllowed,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			rc := &ResumeCommand{metadata: metadata, token: tt.token, conn: &mockConn}
+
+			res, err := rc.Process(tt.state)
+
+			assert.Equal(t, &Response{version: 1, correlationID: 1, statusCode: tt.wantStatusCode}, res)
+			assert.NoError(t, err)
+			_, loggedIn := tt.state.Username(&mockConn)
+			assert.False(t, loggedIn)
+		})
+	}
+}
+
+func Test_ResumeCommand_Process_AcknowledgesLastReceived(t *testing.T) {
+	oldConn, newConn := net.TCPConn{}, net.TCPConn{}
+	msg := state.Message{From: "alice", Timestamp: time.Unix(1, 0), Payload: "Hi"}
+
+	s := tokenState()
+	require.NoError(t, s.Login(&oldConn, "bob"))
+	token, _, err := s.IssueToken("bob")
+	require.NoError(t, err)
+	for range 3 {
+		s.Deliver("bob", msg)
+	}
+	s.Logout(&oldConn)
+
+	rc := &ResumeCommand{
+		metadata:     Metadata{version: 1, cmdCode: ResumeCommandCode, correlationId: 1},
+		token:        token,
+		lastReceived: 2,
+		conn:         &newConn,
+	}
+
+	_, err = rc.Process(s)
+
+	require.NoError(t, err)
+	// the deliveries after the last one received are left to be delivered again
+	assert.Equal(t, []state.Delivery{{Sequence: 3, Message: msg}}, s.Unacknowledged("bob"))
+}
+
+func Test_ResumeCommand_LogValue(t *testing.T) {
+
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, nil))
+
+	logger.Info("received", "command", &ResumeCommand{token: "secret-token"})
+
+	require.Contains(t, buf.String(), "command.name=Resume")
+	assert.False(t, strings.Contains(buf.String(), "secret-token"))
+}
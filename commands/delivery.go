@@ -0,0 +1,61 @@
+package commands
+
+import (
+	"io"
+	"tcpserver/protocol"
+	"time"
+)
+
+const (
+	DeliveryMsgCode         = protocol.CodeDelivery
+	NumberedDeliveryMsgCode = protocol.CodeNumberedDelivery
+
+	// ProtocolVersion is the version written on the frames that the server
+	// pushes on its own initiative, without a client command to echo it from
+	ProtocolVersion = protocol.Version1
+)
+
+// Delivery is the frame pushed by the server to deliver a message to its recipient.
+// It is not a response to any client command, so its correlationId is always 0.
+type Delivery struct {
+	version   byte
+	message   string
+	from      string
+	to        string
+	timestamp time.Time
+	// sequence is written only if numbered, on the connections with FeatureDeliveryAcks
+	sequence uint64
+	numbered bool
+}
+
+func NewDelivery(from string, to string, timestamp time.Time, message string) *Delivery {
+	return &Delivery{
+		version:   ProtocolVersion,
+		message:   message,
+		from:      from,
+		to:        to,
+		timestamp: timestamp,
+	}
+}
+
+// NewNumberedDelivery creates the delivery of a message numbered by its sequence in the mailbox of its recipient
+func NewNumberedDelivery(sequence uint64, from string, to string, timestamp time.Time, message string) *Delivery {
+	d := NewDelivery(from, to, timestamp, message)
+	d.sequence = sequence
+	d.numbered = true
+	return d
+}
+
+func (d *Delivery) Write(out io.Writer) error {
+	delivery := protocol.Delivery{
+		Message:   d.message,
+		From:      d.from,
+		To:        d.to,
+		Timestamp: d.timestamp,
+	}
+
+	if d.numbered {
+		return protocol.WriteFrame(out, d.version, 0, &protocol.NumberedDelivery{Sequence: d.sequence, Delivery: delivery})
+	}
+	return protocol.WriteFrame(out, d.version, 0, &delivery)
+}
@@ -0,0 +1,46 @@
+package commands
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Delivery_Write(t *testing.T) {
+	tests := []struct {
+		name       string
+		delivery   *Delivery
+		wantOutput string
+		wantErr    error
+	}{
+		{
+			name:       "happy path: message gets delivered",
+			delivery:   NewDelivery("usr", "rec", time.Unix(1735689600, 0), "msg"),
+			wantOutput: "\x00\x00\x00\x1E\x01\x00\x04\x00\x00\x00\x00\x00\x03msg\x00\x03usr\x00\x03rec\x18\x16\x68\x7E\xC0\x57\x00\x00",
+		},
+		{
+			name:       "happy path: numbered message gets delivered",
+			delivery:   NewNumberedDelivery(3, "usr", "rec", time.Unix(1735689600, 0), "msg"),
+			wantOutput: "\x00\x00\x00\x26\x01\x00\x14\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x03\x00\x03msg\x00\x03usr\x00\x03rec\x18\x16\x68\x7E\xC0\x57\x00\x00",
+		},
+		{
+			name:       "error: message too long",
+			delivery:   NewDelivery("usr", "rec", time.Unix(1735689600, 0), string(make([]byte, 0x10000))),
+			wantOutput: "",
+			wantErr:    ErrFieldTooLong,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			var buf bytes.Buffer
+
+			err := tt.delivery.Write(&buf)
+
+			assert.Equal(t, tt.wantOutput, buf.String())
+			assert.Equal(t, tt.wantErr, err)
+		})
+	}
+}
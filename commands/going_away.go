@@ -0,0 +1,26 @@
+package commands
+
+import (
+	"io"
+	"tcpserver/protocol"
+)
+
+const (
+	GoingAwayMsgCode = protocol.CodeGoingAway
+)
+
+// GoingAway is the frame pushed by the server when it's shutting down:
+// the commands already sent still get their response, then the connection gets closed
+type GoingAway struct {
+	version byte
+}
+
+func NewGoingAway() *GoingAway {
+	return &GoingAway{
+		version: ProtocolVersion,
+	}
+}
+
+func (ga *GoingAway) Write(out io.Writer) error {
+	return protocol.WriteFrame(out, ga.version, 0, &protocol.GoingAway{})
+}
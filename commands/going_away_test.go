@@ -0,0 +1,18 @@
+package commands
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_GoingAway_Write(t *testing.T) {
+
+	var buf bytes.Buffer
+
+	err := NewGoingAway().Write(&buf)
+
+	assert.Equal(t, "\x00\x00\x00\x07\x01\x00\x0B\x00\x00\x00\x00", buf.String())
+	assert.Nil(t, err)
+}
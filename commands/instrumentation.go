@@ -0,0 +1,79 @@
+package commands
+
+import (
+	"errors"
+	"log/slog"
+	"time"
+)
+
+// Instrumentation gets notified of what goes through ParseCommand, e.g. to collect metrics.
+// It's shared by all the sessions, so it must be safe for concurrent use.
+type Instrumentation interface {
+	// ParseFailed is called with each *ParseError and *FrameError returned by ParseCommand
+	ParseFailed(err error)
+	// CommandProcessed is called each time a command returned by ParseCommand has been processed,
+	// with the status code of its response (0 if it answered with something else, or nothing)
+	CommandProcessed(cmdCode uint16, statusCode uint16, duration time.Duration)
+}
+
+// statusFrame is a frame carrying the status code of a response, e.g. *Response
+type statusFrame interface {
+	Frame
+	StatusCode() uint16
+}
+
+// instrumentedCommand reports the processing of the command it wraps to the instrumentation
+type instrumentedCommand struct {
+	Command
+	cmdCode         uint16
+	instrumentation Instrumentation
+}
+
+func (ic *instrumentedCommand) Process(state State) (Frame, error) {
+
+	start := time.Now()
+	frame, err := ic.Command.Process(state)
+	duration := time.Since(start)
+
+	statusCode := StatusCode(err)
+	if err == nil {
+		statusCode = 0
+		if resp, ok := frame.(statusFrame); ok {
+			statusCode = resp.StatusCode()
+		}
+	}
+	ic.instrumentation.CommandProcessed(ic.cmdCode, statusCode, duration)
+
+	return frame, err
+}
+
+// LogValue logs the wrapped command as if it wasn't wrapped
+func (ic *instrumentedCommand) LogValue() slog.Value {
+	return slog.AnyValue(ic.Command)
+}
+
+// instrument wraps the command parsed by ParseCommand, if the session is instrumented
+func (s *Session) instrument(cmdCode uint16, cmd Command) Command {
+	if s.instrumentation == nil {
+		return cmd
+	}
+
+	return &instrumentedCommand{
+		Command:         cmd,
+		cmdCode:         cmdCode,
+		instrumentation: s.instrumentation,
+	}
+}
+
+// parseFailed reports the errors of the frames that couldn't be parsed, if the session is instrumented
+func (s *Session) parseFailed(err error) {
+	if s.instrumentation == nil {
+		return
+	}
+
+	var parseErr *ParseError
+	var frameErr *FrameError
+	if errors.As(err, &parseErr) || errors.As(err, &frameErr) {
+		s.instrumentation.ParseFailed(err)
+	}
+}
@@ -0,0 +1,106 @@
+package commands
+
+import (
+	"io"
+	"net"
+	"sync"
+	"tcpserver/state"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type mockInstrumentation struct {
+	mutex       sync.Mutex
+	parseErrors []error
+	processed   [][2]uint16
+}
+
+func (mi *mockInstrumentation) ParseFailed(err error) {
+	mi.mutex.Lock()
+	mi.parseErrors = append(mi.parseErrors, err)
+	mi.mutex.Unlock()
+}
+
+func (mi *mockInstrumentation) CommandProcessed(cmdCode uint16, statusCode uint16, _ time.Duration) {
+	mi.mutex.Lock()
+	mi.processed = append(mi.processed, [2]uint16{cmdCode, statusCode})
+	mi.mutex.Unlock()
+}
+
+func Test_ParseCommand_Instrumentation(t *testing.T) {
+	tests := []struct {
+		name            string
+		stream          net.Conn
+		phase           Phase
+		wantErr         error
+		wantParseErrors int
+		wantProcessed   [][2]uint16
+	}{
+		{
+			name:          "happy path: the processed command is reported with its status",
+			stream:        generateStream("\x00\x00\x00\x11\x01\x00\x01\x00\x00\x00\x01\x00\x08TestUser"),
+			wantProcessed: [][2]uint16{{LoginCommandCode, ResponseStatusCodeOK}},
+		},
+		{
+			name:          "happy path: a command answered without a response has no status",
+			stream:        generateStream("\x00\x00\x00\x07\x01\x00\x0D\x00\x00\x00\x01"),
+			wantProcessed: [][2]uint16{{PongCommandCode, 0}},
+		},
+		{
+			name:            "error: unknown command is reported",
+			stream:          generateStream("\x00\x00\x00\x07\x01\x00\x99\x00\x00\x00\x01"),
+			wantErr:         ErrUnknownCommand,
+			wantParseErrors: 1,
+		},
+		{
+			name:            "error: truncated frame is reported",
+			stream:          generateStream("\x00\x00\x00\x11\x01"),
+			wantErr:         ErrTruncatedFrame,
+			wantParseErrors: 1,
+		},
+		{
+			name:    "error: end of the stream is not a parse error",
+			stream:  generateStream(""),
+			wantErr: io.EOF,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			instrumentation := &mockInstrumentation{}
+			session := &Session{conn: tt.stream, phase: tt.phase, policy: testPolicy, instrumentation: instrumentation}
+
+			cmd, err := ParseCommand(session, testLimits)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+			} else {
+				require.NoError(t, err)
+				_, pErr := cmd.Process(state.NewState())
+				require.NoError(t, pErr)
+			}
+
+			assert.Len(t, instrumentation.parseErrors, tt.wantParseErrors)
+			assert.Equal(t, tt.wantProcessed, instrumentation.processed)
+		})
+	}
+}
+
+func Test_instrumentedCommand_LoginResponse(t *testing.T) {
+	mockConn := net.TCPConn{}
+	instrumentation := &mockInstrumentation{}
+	ic := &instrumentedCommand{
+		Command:         &LoginCommand{username: "alice", conn: &mockConn, tokens: true},
+		cmdCode:         LoginCommandCode,
+		instrumentation: instrumentation,
+	}
+
+	res, err := ic.Process(tokenState())
+	require.NoError(t, err)
+
+	// the session token following the response doesn't hide its status
+	assert.IsType(t, &loginResponse{}, res)
+	assert.Equal(t, [][2]uint16{{LoginCommandCode, ResponseStatusCodeOK}}, instrumentation.processed)
+}
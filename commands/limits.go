@@ -0,0 +1,142 @@
+package commands
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+var (
+	ErrFrameTooLarge  = errors.New("frame too large")
+	ErrTruncatedFrame = errors.New("truncated frame")
+)
+
+// Limits bound the size of the frames sent by the clients, and of the fields in them
+type Limits struct {
+	// MaxFrameSize is the maximum value of the length prefixing each frame
+	MaxFrameSize      uint32
+	MaxUsernameLength int
+	MaxMessageLength  int
+	// SkipOversizedFrames makes the oversized frames get discarded, keeping the connection open.
+	// Otherwise, the stream can't be read any further.
+	SkipOversizedFrames bool
+}
+
+// limitedCommand is implemented by the commands carrying usernames or messages
+type limitedCommand interface {
+	checkLimits(limits Limits) error
+}
+
+func (l Limits) checkUsernames(usernames ...string) error {
+	for _, username := range usernames {
+		if len(username) > l.MaxUsernameLength {
+			return fmt.Errorf("%w: username longer than %d bytes", ErrFieldTooLong, l.MaxUsernameLength)
+		}
+	}
+	return nil
+}
+
+func (l Limits) checkMessage(message string) error {
+	if len(message) > l.MaxMessageLength {
+		return fmt.Errorf("%w: message longer than %d bytes", ErrFieldTooLong, l.MaxMessageLength)
+	}
+	return nil
+}
+
+// FrameError is returned when a frame couldn't be read as a whole from the stream,
+// because it's truncated or too large. The stream is out of sync, so after sending
+// the error response to the client the connection must be closed.
+type FrameError struct {
+	metadata Metadata
+	err      error
+}
+
+func (fe *FrameError) Error() string {
+	return fe.err.Error()
+}
+
+func (fe *FrameError) Unwrap() error {
+	return fe.err
+}
+
+// Response returns the error response to send back to the client
+func (fe *FrameError) Response() *Response {
+	return newErrorResponse(fe.metadata, fe.err)
+}
+
+// readFrame reads the body of the next frame, enforcing the maximum frame size
+func readFrame(stream io.Reader, limits Limits) ([]byte, error) {
+
+	var frameLen uint32
+	err := binary.Read(stream, binary.BigEndian, &frameLen)
+	if err != nil {
+		return nil, truncatedFrameError(Metadata{}, err)
+	}
+
+	if frameLen > limits.MaxFrameSize {
+		return nil, oversizedFrameError(stream, frameLen, limits)
+	}
+
+	body := make([]byte, frameLen)
+	_, err = io.ReadFull(stream, body)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return nil, truncatedFrameError(Metadata{}, err)
+	}
+
+	return body, nil
+}
+
+// truncatedFrameError reports the stream ending in the middle of a frame as a FrameError.
+// The other errors (including the stream ending cleanly between two frames) are returned as they are.
+func truncatedFrameError(metadata Metadata, err error) error {
+	if err != io.ErrUnexpectedEOF {
+		return err
+	}
+
+	return &FrameError{
+		metadata: metadata,
+		err:      fmt.Errorf("%w: %w", ErrTruncatedFrame, err),
+	}
+}
+
+// oversizedFrameError reads the metadata of the oversized frame, so that the error response
+// can be matched by the client, and discards the rest of it if the limits allow to do so
+func oversizedFrameError(stream io.Reader, frameLen uint32, limits Limits) error {
+
+	tooLarge := fmt.Errorf("%w: %d bytes, the maximum is %d", ErrFrameTooLarge, frameLen, limits.MaxFrameSize)
+
+	var metadata Metadata
+	header := make([]byte, min(frameLen, MetadataLength))
+	_, err := io.ReadFull(stream, header)
+	if err == nil && len(header) == int(MetadataLength) {
+		parsed, mErr := parseMetadata(bytes.NewReader(header))
+		if mErr == nil {
+			metadata = *parsed
+		}
+	}
+
+	if err != nil || !limits.SkipOversizedFrames {
+		return &FrameError{
+			metadata: metadata,
+			err:      tooLarge,
+		}
+	}
+
+	_, err = io.CopyN(io.Discard, stream, int64(frameLen)-int64(len(header)))
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return truncatedFrameError(metadata, err)
+	}
+
+	return &ParseError{
+		metadata: metadata,
+		err:      tooLarge,
+	}
+}
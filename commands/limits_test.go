@@ -0,0 +1,79 @@
+package commands
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_CheckLimits(t *testing.T) {
+	longUsername := strings.Repeat("u", testLimits.MaxUsernameLength+1)
+	longMessage := strings.Repeat("m", testLimits.MaxMessageLength+1)
+	errUsername := fmt.Errorf("%w: username longer than %d bytes", ErrFieldTooLong, testLimits.MaxUsernameLength)
+	errMessage := fmt.Errorf("%w: message longer than %d bytes", ErrFieldTooLong, testLimits.MaxMessageLength)
+
+	tests := []struct {
+		name    string
+		cmd     limitedCommand
+		wantErr error
+	}{
+		{
+			name:    "happy path: login within limits",
+			cmd:     &LoginCommand{username: "user"},
+			wantErr: nil,
+		},
+		{
+			name:    "error: login username too long",
+			cmd:     &LoginCommand{username: longUsername},
+			wantErr: errUsername,
+		},
+		{
+			name:    "happy path: register within limits",
+			cmd:     &RegisterCommand{username: "user", password: "secret"},
+			wantErr: nil,
+		},
+		{
+			name:    "error: loginV2 username too long",
+			cmd:     &LoginV2Command{username: longUsername, password: "secret"},
+			wantErr: errUsername,
+		},
+		{
+			name:    "happy path: message within limits",
+			cmd:     &MessageCommand{message: "msg", from: "usr", to: "rec"},
+			wantErr: nil,
+		},
+		{
+			name:    "error: message too long",
+			cmd:     &MessageCommand{message: longMessage, from: "usr", to: "rec"},
+			wantErr: errMessage,
+		},
+		{
+			name:    "error: message recipient too long",
+			cmd:     &MessageCommand{message: "msg", from: "usr", to: longUsername},
+			wantErr: errUsername,
+		},
+		{
+			name:    "error: multi message recipient too long",
+			cmd:     &MultiMessageCommand{message: "msg", from: "usr", to: []string{"rec", longUsername}},
+			wantErr: errUsername,
+		},
+		{
+			name:    "error: broadcast message too long",
+			cmd:     &BroadcastCommand{message: longMessage, from: "usr"},
+			wantErr: errMessage,
+		},
+		{
+			name:    "error: list users cursor too long",
+			cmd:     &ListUsersCommand{cursor: longUsername},
+			wantErr: errUsername,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			assert.Equal(t, tt.wantErr, tt.cmd.checkLimits(testLimits))
+		})
+	}
+}
@@ -0,0 +1,26 @@
+package commands
+
+import (
+	"errors"
+)
+
+var (
+	ErrPasswordlessLoginDisabled = errors.New("passwordless login disabled")
+)
+
+// Policy restricts the commands and the features the clients can use, regardless of the phase of their session
+type Policy struct {
+	// AllowPasswordlessLogin accepts LoginCommand, which authenticates on the username alone,
+	// for the clients that don't support passwords yet
+	AllowPasswordlessLogin bool
+	// Features lists the optional features that HelloCommand can enable, e.g. FeatureSessionTokens
+	Features []string
+}
+
+// checkAllowed returns an error if the command is disabled by the policy
+func (p Policy) checkAllowed(cmdCode uint16) error {
+	if cmdCode == LoginCommandCode && !p.AllowPasswordlessLogin {
+		return ErrPasswordlessLoginDisabled
+	}
+	return nil
+}
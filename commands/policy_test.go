@@ -0,0 +1,41 @@
+package commands
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Policy_checkAllowed(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  Policy
+		cmdCode uint16
+		wantErr error
+	}{
+		{
+			name:    "happy path: passwordless login allowed",
+			policy:  Policy{AllowPasswordlessLogin: true},
+			cmdCode: LoginCommandCode,
+			wantErr: nil,
+		},
+		{
+			name:    "happy path: login with password always allowed",
+			policy:  Policy{},
+			cmdCode: LoginV2CommandCode,
+			wantErr: nil,
+		},
+		{
+			name:    "error: passwordless login disabled",
+			policy:  Policy{},
+			cmdCode: LoginCommandCode,
+			wantErr: ErrPasswordlessLoginDisabled,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.wantErr, tt.policy.checkAllowed(tt.cmdCode))
+		})
+	}
+}
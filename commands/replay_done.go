@@ -0,0 +1,28 @@
+package commands
+
+import (
+	"io"
+	"tcpserver/protocol"
+)
+
+const (
+	ReplayDoneMsgCode = protocol.CodeReplayDone
+)
+
+// ReplayDone is the frame pushed by the server after the messages received
+// while the user was offline, to tell how many of them have been replayed
+type ReplayDone struct {
+	version byte
+	count   uint32
+}
+
+func NewReplayDone(count uint32) *ReplayDone {
+	return &ReplayDone{
+		version: ProtocolVersion,
+		count:   count,
+	}
+}
+
+func (rd *ReplayDone) Write(out io.Writer) error {
+	return protocol.WriteFrame(out, rd.version, 0, &protocol.ReplayDone{Count: rd.count})
+}
@@ -0,0 +1,39 @@
+package commands
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ReplayDone_Write(t *testing.T) {
+	tests := []struct {
+		name       string
+		replayDone *ReplayDone
+		wantOutput string
+		wantErr    error
+	}{
+		{
+			name:       "happy path: no messages replayed",
+			replayDone: NewReplayDone(0),
+			wantOutput: "\x00\x00\x00\x0B\x01\x00\x05\x00\x00\x00\x00\x00\x00\x00\x00",
+		},
+		{
+			name:       "happy path: some messages replayed",
+			replayDone: NewReplayDone(3),
+			wantOutput: "\x00\x00\x00\x0B\x01\x00\x05\x00\x00\x00\x00\x00\x00\x00\x03",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			var buf bytes.Buffer
+
+			err := tt.replayDone.Write(&buf)
+
+			assert.Equal(t, tt.wantOutput, buf.String())
+			assert.Equal(t, tt.wantErr, err)
+		})
+	}
+}
@@ -1,45 +1,62 @@
 package commands
 
 import (
-	"encoding/binary"
 	"io"
+	"tcpserver/protocol"
 )
 
 const (
-	ResponseMsgCode uint16 = 0x03
-	ResponseLength  uint32 = 0x0009
-
-	ResponseStatusCodeOK                uint16 = 0x01
-	ResponseStatusCodeUserNotFound      uint16 = 0x03
-	ResponseStatusCodeUserAlreadyLogged uint16 = 0x04
+	ResponseMsgCode = protocol.CodeResponse
+
+	ResponseStatusCodeOK                 = protocol.StatusOK
+	ResponseStatusCodeUserNotFound       = protocol.StatusUserNotFound
+	ResponseStatusCodeUserAlreadyLogged  = protocol.StatusUserAlreadyLogged
+	ResponseStatusCodeUnknownCommand     = protocol.StatusUnknownCommand
+	ResponseStatusCodeMalformedCommand   = protocol.StatusMalformedCommand
+	ResponseStatusCodeInternalError      = protocol.StatusInternalError
+	ResponseStatusCodePartialSuccess     = protocol.StatusPartialSuccess
+	ResponseStatusCodeFrameTooLarge      = protocol.StatusFrameTooLarge
+	ResponseStatusCodeFieldTooLong       = protocol.StatusFieldTooLong
+	ResponseStatusCodeTruncatedFrame     = protocol.StatusTruncatedFrame
+	ResponseStatusCodeForbidden          = protocol.StatusForbidden
+	ResponseStatusCodeNotAllowed         = protocol.StatusNotAllowed
+	ResponseStatusCodeMailboxFull        = protocol.StatusMailboxFull
+	ResponseStatusCodeBadCredentials     = protocol.StatusBadCredentials
+	ResponseStatusCodeUsernameTaken      = protocol.StatusUsernameTaken
+	ResponseStatusCodeInvalidToken       = protocol.StatusInvalidToken
+	ResponseStatusCodeUnsupportedVersion = protocol.StatusUnsupportedVersion
 )
 
+// Response is the frame answering a client command.
+// Some commands append a body to the status code: its content depends on the command,
+// and the client knows how to read it by matching the correlationID.
 type Response struct {
 	version       byte
 	correlationID uint32
 	statusCode    uint16
+	body          []byte
 }
 
-func (r *Response) Write(out io.Writer) error {
-	err := binary.Write(out, binary.BigEndian, ResponseLength)
-	if err != nil {
-		return err
-	}
-
-	err = binary.Write(out, binary.BigEndian, r.version)
-	if err != nil {
-		return err
+func newResponse(metadata Metadata, statusCode uint16) *Response {
+	return &Response{
+		version:       metadata.version,
+		correlationID: metadata.correlationId,
+		statusCode:    statusCode,
 	}
+}
 
-	err = binary.Write(out, binary.BigEndian, ResponseMsgCode)
-	if err != nil {
-		return err
-	}
+// newErrorResponse builds the response to a command that failed with the given error
+func newErrorResponse(metadata Metadata, err error) *Response {
+	return newResponse(metadata, StatusCode(err))
+}
 
-	err = binary.Write(out, binary.BigEndian, r.correlationID)
-	if err != nil {
-		return err
-	}
+func (r *Response) StatusCode() uint16 {
+	return r.statusCode
+}
 
-	return binary.Write(out, binary.BigEndian, r.statusCode)
+func (r *Response) Write(out io.Writer) error {
+	return protocol.WriteFrame(out, r.version, r.correlationID, &protocol.Response{
+		Status: r.statusCode,
+		Body:   r.body,
+	})
 }
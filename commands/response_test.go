@@ -23,6 +23,16 @@ func Test_Response_Write(t *testing.T) {
 			},
 			wantOutput: "\x00\x00\x00\x09\x01\x00\x03\x00\x00\x00\x01\x00\x01",
 		},
+		{
+			name: "happy path: response with body",
+			response: &Response{
+				version:       1,
+				correlationID: 2,
+				statusCode:    ResponseStatusCodePartialSuccess,
+				body:          []byte("\x00\x01\x00\x03usr"),
+			},
+			wantOutput: "\x00\x00\x00\x10\x01\x00\x03\x00\x00\x00\x02\x00\x08\x00\x01\x00\x03usr",
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -0,0 +1,245 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"slices"
+	"sync"
+)
+
+var (
+	ErrCommandNotAllowed = errors.New("command not allowed")
+)
+
+// Phase is the stage of the life of a connection, which decides the commands it can send
+type Phase int
+
+const (
+	// PhaseConnected is the phase of a connection without a logged user
+	PhaseConnected Phase = iota
+	// PhaseAuthenticated is the phase of a connection with a logged user
+	PhaseAuthenticated
+	// PhaseClosing is the phase of a connection being closed, which can't send commands anymore
+	PhaseClosing
+)
+
+// allowedCommands lists the command codes accepted in each phase.
+// A new command must be added here, otherwise it's never accepted.
+var allowedCommands = map[Phase][]uint16{
+	PhaseConnected: {
+		HelloCommandCode,
+		LoginCommandCode,
+		RegisterCommandCode,
+		LoginV2CommandCode,
+		ResumeCommandCode,
+		PingCommandCode,
+		PongCommandCode,
+		CorrelationIDTestCommandCode,
+	},
+	PhaseAuthenticated: {
+		MessageCommandCode,
+		LogoutCommandCode,
+		MultiMessageCommandCode,
+		BroadcastCommandCode,
+		ListUsersCommandCode,
+		AckCommandCode,
+		PingCommandCode,
+		PongCommandCode,
+		CorrelationIDTestCommandCode,
+	},
+	PhaseClosing: {},
+}
+
+func (p Phase) String() string {
+	switch p {
+	case PhaseConnected:
+		return "connected"
+	case PhaseAuthenticated:
+		return "authenticated"
+	case PhaseClosing:
+		return "closing"
+	default:
+		return fmt.Sprintf("Phase(%d)", int(p))
+	}
+}
+
+// Session tracks the phase of a connection:
+//
+//	connected ⇄ authenticated → closing
+//
+// Its phase follows the user logged in on the connection (see Sync),
+// until the connection starts closing.
+type Session struct {
+	mutex sync.Mutex
+	conn  net.Conn
+	phase Phase
+	// version is the version of the protocol negotiated with HelloCommand, 0 until then
+	version byte
+	// features are the optional features enabled with HelloCommand
+	features []string
+
+	// baseLogger describes the connection, logger the user logged in on it too
+	baseLogger *slog.Logger
+	logger     *slog.Logger
+	// correlationID is the one of the last frame read by ParseCommand, if hasCorrelationID
+	correlationID    uint32
+	hasCorrelationID bool
+
+	// policy restricts the commands on top of the phase
+	policy Policy
+
+	// instrumentation is optional
+	instrumentation Instrumentation
+}
+
+// NewSession creates the session of the connection, logging with the given logger
+// and accepting the commands allowed by the policy.
+// The commands parsed on it are reported to the instrumentation, unless it's nil.
+func NewSession(conn net.Conn, logger *slog.Logger, policy Policy, instrumentation Instrumentation) *Session {
+	return &Session{
+		conn:            conn,
+		phase:           PhaseConnected,
+		baseLogger:      logger,
+		logger:          logger,
+		policy:          policy,
+		instrumentation: instrumentation,
+	}
+}
+
+func (s *Session) Conn() net.Conn {
+	return s.conn
+}
+
+// Logger returns the logger of the session, which adds the username to the logs once logged in
+func (s *Session) Logger() *slog.Logger {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.logger == nil {
+		return slog.Default()
+	}
+	return s.logger
+}
+
+// CommandLogger returns the logger of the session, which adds the correlationId of the last frame
+// read by ParseCommand too, so that the logs about a command can be matched to its request
+func (s *Session) CommandLogger() *slog.Logger {
+	logger := s.Logger()
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if !s.hasCorrelationID {
+		return logger
+	}
+	return logger.With("correlation_id", s.correlationID)
+}
+
+// setCorrelationID records the correlationId of the frame being read, ok is false if it has none
+func (s *Session) setCorrelationID(correlationID uint32, ok bool) {
+	s.mutex.Lock()
+	s.correlationID = correlationID
+	s.hasCorrelationID = ok
+	s.mutex.Unlock()
+}
+
+func (s *Session) Phase() Phase {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.phase
+}
+
+// Version returns the version of the protocol spoken on the connection:
+// the one negotiated with HelloCommand, ProtocolVersion until then
+func (s *Session) Version() byte {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.version == 0 {
+		return ProtocolVersion
+	}
+	return s.version
+}
+
+func (s *Session) setVersion(version byte) {
+	s.mutex.Lock()
+	s.version = version
+	s.mutex.Unlock()
+}
+
+// HasFeature tells if the optional feature has been enabled with HelloCommand, e.g. FeatureDeliveryAcks
+func (s *Session) HasFeature(feature string) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return slices.Contains(s.features, feature)
+}
+
+func (s *Session) setFeatures(features []string) {
+	s.mutex.Lock()
+	s.features = features
+	s.mutex.Unlock()
+}
+
+// Sync moves the session to the authenticated phase if a user is logged in on its connection,
+// and back to the connected phase otherwise. A closing session stays closing.
+func (s *Session) Sync(state State) {
+	username, loggedIn := state.Username(s.conn)
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.baseLogger != nil {
+		s.logger = s.baseLogger
+		if loggedIn {
+			s.logger = s.baseLogger.With("username", username)
+		}
+	}
+
+	if s.phase == PhaseClosing {
+		return
+	}
+
+	s.phase = PhaseConnected
+	if loggedIn {
+		s.phase = PhaseAuthenticated
+	}
+}
+
+// Close moves the session to the closing phase, for good
+func (s *Session) Close() {
+	s.mutex.Lock()
+	s.phase = PhaseClosing
+	s.mutex.Unlock()
+}
+
+// checkAllowed returns an error if the command can't be sent in the current phase of the session
+func (s *Session) checkAllowed(cmdCode uint16) error {
+	phase := s.Phase()
+
+	if !slices.Contains(allowedCommands[phase], cmdCode) {
+		return fmt.Errorf("%w while %s: 0x%02X", ErrCommandNotAllowed, phase, cmdCode)
+	}
+
+	return nil
+}
+
+// checkVersion returns an error if the frame isn't written with the version of the session.
+// HelloCommand, which negotiates the version, can be written with any version the server supports.
+func (s *Session) checkVersion(metadata Metadata) error {
+
+	if metadata.cmdCode == HelloCommandCode {
+		if !slices.Contains(SupportedVersions, metadata.version) {
+			return fmt.Errorf("%w: 0x%02X", ErrUnsupportedVersion, metadata.version)
+		}
+		return nil
+	}
+
+	version := s.Version()
+	if metadata.version != version {
+		return fmt.Errorf("%w: 0x%02X, the session speaks 0x%02X", ErrUnsupportedVersion, metadata.version, version)
+	}
+
+	return nil
+}
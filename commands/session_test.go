@@ -0,0 +1,236 @@
+package commands
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"net"
+	"tcpserver/state"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Session_Sync(t *testing.T) {
+	mockConn := net.TCPConn{}
+	tests := []struct {
+		name      string
+		phase     Phase
+		loggedIn  bool
+		wantPhase Phase
+	}{
+		{
+			name:      "happy path: login authenticates the session",
+			phase:     PhaseConnected,
+			loggedIn:  true,
+			wantPhase: PhaseAuthenticated,
+		},
+		{
+			name:      "happy path: logout takes the session back to connected",
+			phase:     PhaseAuthenticated,
+			loggedIn:  false,
+			wantPhase: PhaseConnected,
+		},
+		{
+			name:      "happy path: a closing session stays closing",
+			phase:     PhaseClosing,
+			loggedIn:  true,
+			wantPhase: PhaseClosing,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			s := state.NewState()
+			if tt.loggedIn {
+				_ = s.Login(&mockConn, "user")
+			}
+			session := &Session{conn: &mockConn, phase: tt.phase}
+
+			session.Sync(s)
+
+			assert.Equal(t, tt.wantPhase, session.Phase())
+		})
+	}
+}
+
+func Test_Session_Logger(t *testing.T) {
+	mockConn := net.TCPConn{}
+
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{
+		ReplaceAttr: func(_ []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.TimeKey {
+				return slog.Attr{}
+			}
+			return a
+		},
+	}))
+
+	s := state.NewState()
+	session := NewSession(&mockConn, logger.With("conn_id", 1), testPolicy, nil)
+
+	// the username is added once logged in, and removed on logout
+	session.Logger().Info("connected")
+	_ = s.Login(&mockConn, "user")
+	session.Sync(s)
+	session.Logger().Info("logged in")
+	s.Logout(&mockConn)
+	session.Sync(s)
+	session.Logger().Info("logged out")
+
+	assert.Equal(t, "level=INFO msg=connected conn_id=1\n"+
+		"level=INFO msg=\"logged in\" conn_id=1 username=user\n"+
+		"level=INFO msg=\"logged out\" conn_id=1\n", buf.String())
+}
+
+func Test_Session_CommandLogger(t *testing.T) {
+	// a Ping with the correlationId 7, then a frame too large to be read
+	stream := generateStream("\x00\x00\x00\x07\x01\x00\x0C\x00\x00\x00\x07" + "\x00\x00\x10\x00")
+
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{
+		ReplaceAttr: func(_ []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.TimeKey {
+				return slog.Attr{}
+			}
+			return a
+		},
+	}))
+	session := NewSession(stream, logger.With("conn_id", 1), testPolicy, nil)
+
+	// the correlationId is added once a frame has been read, and removed when the next one has none
+	session.CommandLogger().Info("connected")
+	_, err := ParseCommand(session, testLimits)
+	assert.NoError(t, err)
+	session.CommandLogger().Info("processing")
+	_, err = ParseCommand(session, testLimits)
+	assert.Error(t, err)
+	session.CommandLogger().Info("frame too large")
+	session.Logger().Info("delivering")
+
+	assert.Equal(t, "level=INFO msg=connected conn_id=1\n"+
+		"level=INFO msg=processing conn_id=1 correlation_id=7\n"+
+		"level=INFO msg=\"frame too large\" conn_id=1\n"+
+		"level=INFO msg=delivering conn_id=1\n", buf.String())
+}
+
+func Test_Session_Close(t *testing.T) {
+	mockConn := net.TCPConn{}
+
+	session := NewSession(&mockConn, slog.New(slog.DiscardHandler), testPolicy, nil)
+	session.Close()
+
+	assert.Equal(t, PhaseClosing, session.Phase())
+	assert.ErrorIs(t, session.checkAllowed(PingCommandCode), ErrCommandNotAllowed)
+}
+
+func Test_Session_checkAllowed(t *testing.T) {
+	tests := []struct {
+		name    string
+		phase   Phase
+		cmdCode uint16
+		wantErr error
+	}{
+		{
+			name:    "happy path: login while connected",
+			phase:   PhaseConnected,
+			cmdCode: LoginCommandCode,
+			wantErr: nil,
+		},
+		{
+			name:    "happy path: ping while connected",
+			phase:   PhaseConnected,
+			cmdCode: PingCommandCode,
+			wantErr: nil,
+		},
+		{
+			name:    "happy path: message while authenticated",
+			phase:   PhaseAuthenticated,
+			cmdCode: MessageCommandCode,
+			wantErr: nil,
+		},
+		{
+			name:    "error: message while connected",
+			phase:   PhaseConnected,
+			cmdCode: MessageCommandCode,
+			wantErr: fmt.Errorf("%w while connected: 0x02", ErrCommandNotAllowed),
+		},
+		{
+			name:    "error: logout while connected",
+			phase:   PhaseConnected,
+			cmdCode: LogoutCommandCode,
+			wantErr: fmt.Errorf("%w while connected: 0x06", ErrCommandNotAllowed),
+		},
+		{
+			name:    "error: login while authenticated",
+			phase:   PhaseAuthenticated,
+			cmdCode: LoginCommandCode,
+			wantErr: fmt.Errorf("%w while authenticated: 0x01", ErrCommandNotAllowed),
+		},
+		{
+			name:    "error: anything while closing",
+			phase:   PhaseClosing,
+			cmdCode: PongCommandCode,
+			wantErr: fmt.Errorf("%w while closing: 0x0D", ErrCommandNotAllowed),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			session := &Session{phase: tt.phase}
+
+			assert.Equal(t, tt.wantErr, session.checkAllowed(tt.cmdCode))
+		})
+	}
+}
+
+func Test_Session_checkVersion(t *testing.T) {
+	tests := []struct {
+		name     string
+		version  byte
+		metadata Metadata
+		wantErr  error
+	}{
+		{
+			name:     "happy path: version 1 before negotiating",
+			metadata: Metadata{version: ProtocolVersion, cmdCode: LoginCommandCode},
+			wantErr:  nil,
+		},
+		{
+			name:     "happy path: negotiated version",
+			version:  ProtocolVersion2,
+			metadata: Metadata{version: ProtocolVersion2, cmdCode: MessageCommandCode},
+			wantErr:  nil,
+		},
+		{
+			name:     "happy path: hello with any supported version",
+			metadata: Metadata{version: ProtocolVersion2, cmdCode: HelloCommandCode},
+			wantErr:  nil,
+		},
+		{
+			name:     "error: version not negotiated",
+			metadata: Metadata{version: ProtocolVersion2, cmdCode: LoginCommandCode},
+			wantErr:  fmt.Errorf("%w: 0x02, the session speaks 0x01", ErrUnsupportedVersion),
+		},
+		{
+			name:     "error: previous version after negotiating",
+			version:  ProtocolVersion2,
+			metadata: Metadata{version: ProtocolVersion, cmdCode: MessageCommandCode},
+			wantErr:  fmt.Errorf("%w: 0x01, the session speaks 0x02", ErrUnsupportedVersion),
+		},
+		{
+			name:     "error: hello with an unknown version",
+			metadata: Metadata{version: 0x07, cmdCode: HelloCommandCode},
+			wantErr:  fmt.Errorf("%w: 0x07", ErrUnsupportedVersion),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			session := &Session{version: tt.version}
+
+			assert.Equal(t, tt.wantErr, session.checkVersion(tt.metadata))
+		})
+	}
+}
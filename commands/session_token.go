@@ -0,0 +1,77 @@
+package commands
+
+import (
+	"errors"
+	"io"
+	"tcpserver/protocol"
+	"tcpserver/state"
+	"time"
+)
+
+const (
+	SessionTokenMsgCode = protocol.CodeSessionToken
+)
+
+// SessionToken is the frame sent right after the response to a successful login,
+// with the token that resumes the session if the connection drops (see ResumeCommand).
+// It carries the correlationId of the login command.
+type SessionToken struct {
+	version       byte
+	correlationID uint32
+	token         string
+	expiresAt     time.Time
+}
+
+func (st *SessionToken) Write(out io.Writer) error {
+	return protocol.WriteFrame(out, st.version, st.correlationID, &protocol.SessionToken{
+		Token:     st.token,
+		ExpiresAt: st.expiresAt,
+	})
+}
+
+// loginResponse is the OK response to a login, followed by its session token
+type loginResponse struct {
+	*Response
+	token *SessionToken
+}
+
+func (lr *loginResponse) Write(out io.Writer) error {
+	err := lr.Response.Write(out)
+	if err != nil {
+		return err
+	}
+
+	return lr.token.Write(out)
+}
+
+// loggedIn builds the answer to a command that logged the user in: the OK response,
+// followed by a session token if the client asked for them and they are enabled.
+// A client that didn't ask for one, e.g. a v1 client, gets the response alone.
+func loggedIn(st State, metadata Metadata, username string, tokens bool) (Frame, error) {
+
+	resp := newResponse(metadata, ResponseStatusCodeOK)
+
+	if !tokens {
+		// the tokens issued to a previous session of the user must not resume this one
+		st.RevokeTokens(username)
+		return resp, nil
+	}
+
+	token, expiresAt, err := st.IssueToken(username)
+	if errors.Is(err, state.ErrTokensDisabled) {
+		return resp, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &loginResponse{
+		Response: resp,
+		token: &SessionToken{
+			version:       metadata.version,
+			correlationID: metadata.correlationId,
+			token:         token,
+			expiresAt:     expiresAt,
+		},
+	}, nil
+}
@@ -0,0 +1,102 @@
+package commands
+
+import (
+	"bytes"
+	"net"
+	"tcpserver/state"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// tokenState returns a state issuing session tokens
+func tokenState() *state.State {
+	s := state.NewState()
+	s.EnableTokens(state.TokenOptions{Key: []byte("key"), TTL: time.Hour, Grace: time.Minute})
+	return s
+}
+
+func Test_SessionToken_Write(t *testing.T) {
+
+	var buf bytes.Buffer
+	st := &SessionToken{
+		version:       1,
+		correlationID: 7,
+		token:         "token",
+		expiresAt:     time.Unix(0, 0x0102030405060708),
+	}
+
+	err := st.Write(&buf)
+
+	assert.Equal(t, "\x00\x00\x00\x16\x01\x00\x10\x00\x00\x00\x07\x00\x05token\x01\x02\x03\x04\x05\x06\x07\x08", buf.String())
+	assert.NoError(t, err)
+}
+
+func Test_loggedIn(t *testing.T) {
+	metadata := Metadata{
+		version:       1,
+		cmdCode:       LoginCommandCode,
+		correlationId: 7,
+	}
+
+	t.Run("happy path: the response is followed by a session token", func(t *testing.T) {
+
+		res, err := loggedIn(tokenState(), metadata, "alice", true)
+		require.NoError(t, err)
+
+		lr, ok := res.(*loginResponse)
+		require.True(t, ok)
+		assert.Equal(t, &Response{version: 1, correlationID: 7, statusCode: ResponseStatusCodeOK}, lr.Response)
+		assert.Equal(t, uint32(7), lr.token.correlationID)
+		assert.NotEmpty(t, lr.token.token)
+		assert.True(t, lr.token.expiresAt.After(time.Now()))
+
+		var buf bytes.Buffer
+		require.NoError(t, res.Write(&buf))
+		assert.Equal(t, "\x00\x00\x00\x09\x01\x00\x03\x00\x00\x00\x07\x00\x01", buf.String()[:13])
+		assert.Equal(t, "\x01\x00\x10\x00\x00\x00\x07", buf.String()[17:24])
+	})
+
+	t.Run("happy path: tokens disabled", func(t *testing.T) {
+
+		res, err := loggedIn(state.NewState(), metadata, "alice", true)
+
+		assert.Equal(t, &Response{version: 1, correlationID: 7, statusCode: ResponseStatusCodeOK}, res)
+		assert.NoError(t, err)
+	})
+
+	t.Run("happy path: the client didn't ask for a session token", func(t *testing.T) {
+		s := tokenState()
+		previous, _, err := s.IssueToken("alice")
+		require.NoError(t, err)
+
+		res, err := loggedIn(s, metadata, "alice", false)
+
+		assert.Equal(t, &Response{version: 1, correlationID: 7, statusCode: ResponseStatusCodeOK}, res)
+		assert.NoError(t, err)
+		// the token of the previous session can't resume this one
+		_, err = s.Resume(&net.TCPConn{}, previous)
+		assert.Error(t, err)
+	})
+}
+
+func Test_ResumeCommand_AfterLogin(t *testing.T) {
+	oldConn := net.TCPConn{}
+	newConn := net.TCPConn{}
+	s := tokenState()
+
+	res, err := (&LoginCommand{username: "alice", conn: &oldConn, tokens: true}).Process(s)
+	require.NoError(t, err)
+	token := res.(*loginResponse).token.token
+	s.Logout(&oldConn)
+
+	res, err = (&ResumeCommand{token: token, conn: &newConn, tokens: true}).Process(s)
+	require.NoError(t, err)
+
+	assert.Equal(t, ResponseStatusCodeOK, res.(statusFrame).StatusCode())
+	assert.NotEqual(t, token, res.(*loginResponse).token.token)
+	username, _ := s.Username(&newConn)
+	assert.Equal(t, "alice", username)
+}
@@ -0,0 +1,56 @@
+package commands
+
+import (
+	"errors"
+	"tcpserver/protocol"
+	"tcpserver/state"
+)
+
+// errorStatusCodes maps the errors that can occur while parsing and processing
+// the commands to the status code sent back to the client.
+// The first entry matching the error (see errors.Is) wins.
+var errorStatusCodes = []struct {
+	err        error
+	statusCode uint16
+}{
+	{state.ErrUserAlreadyOnline, ResponseStatusCodeUserAlreadyLogged},
+	{state.ErrRecipientNotExists, ResponseStatusCodeUserNotFound},
+	{state.ErrMailboxFull, ResponseStatusCodeMailboxFull},
+	{state.ErrBadCredentials, ResponseStatusCodeBadCredentials},
+	{state.ErrUsernameTaken, ResponseStatusCodeUsernameTaken},
+	{state.ErrInvalidToken, ResponseStatusCodeInvalidToken},
+	{state.ErrTokensDisabled, ResponseStatusCodeNotAllowed},
+	{ErrUnsupportedVersion, ResponseStatusCodeUnsupportedVersion},
+	{ErrUnknownCommand, ResponseStatusCodeUnknownCommand},
+	{ErrMalformedMetadata, ResponseStatusCodeMalformedCommand},
+	{ErrMalformedCommand, ResponseStatusCodeMalformedCommand},
+	{ErrFrameTooLarge, ResponseStatusCodeFrameTooLarge},
+	{ErrFieldTooLong, ResponseStatusCodeFieldTooLong},
+	{ErrTruncatedFrame, ResponseStatusCodeTruncatedFrame},
+	{ErrNotLoggedIn, ResponseStatusCodeForbidden},
+	{ErrSenderMismatch, ResponseStatusCodeForbidden},
+	{ErrCommandNotAllowed, ResponseStatusCodeNotAllowed},
+	{ErrPasswordlessLoginDisabled, ResponseStatusCodeNotAllowed},
+}
+
+// StatusName returns the name of the status code, or its hex value if it has none
+func StatusName(statusCode uint16) string {
+	return protocol.StatusName(statusCode)
+}
+
+// StatusCode returns the response status code describing the given error.
+// Errors without a specific status code are reported as internal errors.
+func StatusCode(err error) uint16 {
+
+	if err == nil {
+		return ResponseStatusCodeOK
+	}
+
+	for _, esc := range errorStatusCodes {
+		if errors.Is(err, esc.err) {
+			return esc.statusCode
+		}
+	}
+
+	return ResponseStatusCodeInternalError
+}
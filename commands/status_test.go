@@ -0,0 +1,154 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"tcpserver/state"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_StatusCode(t *testing.T) {
+	tests := []struct {
+		name           string
+		err            error
+		wantStatusCode uint16
+	}{
+		{
+			name:           "no error",
+			err:            nil,
+			wantStatusCode: ResponseStatusCodeOK,
+		},
+		{
+			name:           "user already online",
+			err:            state.ErrUserAlreadyOnline,
+			wantStatusCode: ResponseStatusCodeUserAlreadyLogged,
+		},
+		{
+			name:           "recipient doesn't exist",
+			err:            state.ErrRecipientNotExists,
+			wantStatusCode: ResponseStatusCodeUserNotFound,
+		},
+		{
+			name:           "mailbox full",
+			err:            state.ErrMailboxFull,
+			wantStatusCode: ResponseStatusCodeMailboxFull,
+		},
+		{
+			name:           "bad credentials",
+			err:            state.ErrBadCredentials,
+			wantStatusCode: ResponseStatusCodeBadCredentials,
+		},
+		{
+			name:           "username taken",
+			err:            state.ErrUsernameTaken,
+			wantStatusCode: ResponseStatusCodeUsernameTaken,
+		},
+		{
+			name:           "invalid token",
+			err:            state.ErrInvalidToken,
+			wantStatusCode: ResponseStatusCodeInvalidToken,
+		},
+		{
+			name:           "session tokens disabled",
+			err:            state.ErrTokensDisabled,
+			wantStatusCode: ResponseStatusCodeNotAllowed,
+		},
+		{
+			name:           "passwordless login disabled",
+			err:            &ParseError{err: ErrPasswordlessLoginDisabled},
+			wantStatusCode: ResponseStatusCodeNotAllowed,
+		},
+		{
+			name:           "unsupported version",
+			err:            &ParseError{err: fmt.Errorf("%w: 0x07", ErrUnsupportedVersion)},
+			wantStatusCode: ResponseStatusCodeUnsupportedVersion,
+		},
+		{
+			name:           "unknown command",
+			err:            &ParseError{err: ErrUnknownCommand},
+			wantStatusCode: ResponseStatusCodeUnknownCommand,
+		},
+		{
+			name:           "malformed metadata",
+			err:            &ParseError{err: fmt.Errorf("%w: %w", ErrMalformedMetadata, io.EOF)},
+			wantStatusCode: ResponseStatusCodeMalformedCommand,
+		},
+		{
+			name:           "malformed command",
+			err:            &ParseError{err: fmt.Errorf("%w: %w", ErrMalformedCommand, io.ErrUnexpectedEOF)},
+			wantStatusCode: ResponseStatusCodeMalformedCommand,
+		},
+		{
+			name:           "not logged in",
+			err:            ErrNotLoggedIn,
+			wantStatusCode: ResponseStatusCodeForbidden,
+		},
+		{
+			name:           "sender doesn't match the logged user",
+			err:            fmt.Errorf("%w: %q is logged in, not %q", ErrSenderMismatch, "alice", "bob"),
+			wantStatusCode: ResponseStatusCodeForbidden,
+		},
+		{
+			name:           "command not allowed",
+			err:            &ParseError{err: fmt.Errorf("%w while connected: 0x02", ErrCommandNotAllowed)},
+			wantStatusCode: ResponseStatusCodeNotAllowed,
+		},
+		{
+			name:           "unexpected error",
+			err:            errors.New("unexpected"),
+			wantStatusCode: ResponseStatusCodeInternalError,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			assert.Equal(t, tt.wantStatusCode, StatusCode(tt.err))
+		})
+	}
+}
+
+func Test_ParseError_Response(t *testing.T) {
+
+	pe := &ParseError{
+		metadata: Metadata{
+			version:       1,
+			cmdCode:       0x99,
+			correlationId: 7,
+		},
+		err: ErrUnknownCommand,
+	}
+
+	assert.Equal(t, &Response{
+		version:       1,
+		correlationID: 7,
+		statusCode:    ResponseStatusCodeUnknownCommand,
+	}, pe.Response())
+}
+
+func Test_StatusName(t *testing.T) {
+	tests := []struct {
+		name       string
+		statusCode uint16
+		wantName   string
+	}{
+		{
+			name:       "known status code",
+			statusCode: ResponseStatusCodeMalformedCommand,
+			wantName:   "malformed_command",
+		},
+		{
+			name:       "unknown status code",
+			statusCode: 0xAB,
+			wantName:   "0xAB",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			assert.Equal(t, tt.wantName, StatusName(tt.statusCode))
+		})
+	}
+}
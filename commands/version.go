@@ -0,0 +1,88 @@
+package commands
+
+import (
+	"errors"
+	"io"
+	"maps"
+	"tcpserver/protocol"
+)
+
+const (
+	// ProtocolVersion2 is the version of the protocol whose MessageCommand doesn't carry the sender.
+	// The clients opt in with HelloCommand: the sessions speak ProtocolVersion until then.
+	ProtocolVersion2 = protocol.Version2
+)
+
+var (
+	ErrUnsupportedVersion = errors.New("unsupported protocol version")
+)
+
+// SupportedVersions lists the versions of the protocol the server speaks, preferred first
+var SupportedVersions = []byte{ProtocolVersion2, ProtocolVersion}
+
+// decoder parses the body of a frame into its command
+type decoder func(metadata Metadata, stream io.Reader, session *Session, limits Limits) (Command, error)
+
+// decoders holds the decoder of each command code, for each version of the protocol.
+// A new command must be added here, to all the versions supporting it.
+var decoders = map[byte]map[uint16]decoder{
+	ProtocolVersion:  v1Decoders,
+	ProtocolVersion2: v2Decoders(),
+}
+
+var v1Decoders = map[uint16]decoder{
+	LoginCommandCode: func(metadata Metadata, stream io.Reader, session *Session, _ Limits) (Command, error) {
+		return NewLoginCommand(metadata, stream, session.Conn(), session.HasFeature(FeatureSessionTokens))
+	},
+	MessageCommandCode: func(metadata Metadata, stream io.Reader, session *Session, _ Limits) (Command, error) {
+		return NewMessageCommand(metadata, stream, session.Conn())
+	},
+	LogoutCommandCode: func(metadata Metadata, stream io.Reader, session *Session, _ Limits) (Command, error) {
+		return NewLogoutCommand(metadata, stream, session.Conn())
+	},
+	MultiMessageCommandCode: func(metadata Metadata, stream io.Reader, session *Session, _ Limits) (Command, error) {
+		return NewMultiMessageCommand(metadata, stream, session.Conn())
+	},
+	BroadcastCommandCode: func(metadata Metadata, stream io.Reader, session *Session, _ Limits) (Command, error) {
+		return NewBroadcastCommand(metadata, stream, session.Conn())
+	},
+	ListUsersCommandCode: func(metadata Metadata, stream io.Reader, _ *Session, _ Limits) (Command, error) {
+		return NewListUsersCommand(metadata, stream)
+	},
+	PingCommandCode: func(metadata Metadata, stream io.Reader, _ *Session, _ Limits) (Command, error) {
+		return NewPingCommand(metadata, stream)
+	},
+	PongCommandCode: func(metadata Metadata, stream io.Reader, _ *Session, _ Limits) (Command, error) {
+		return NewPongCommand(metadata, stream)
+	},
+	CorrelationIDTestCommandCode: func(metadata Metadata, stream io.Reader, _ *Session, _ Limits) (Command, error) {
+		return NewCorrelationIDTestCommand(metadata, stream)
+	},
+	RegisterCommandCode: func(metadata Metadata, stream io.Reader, _ *Session, _ Limits) (Command, error) {
+		return NewRegisterCommand(metadata, stream)
+	},
+	LoginV2CommandCode: func(metadata Metadata, stream io.Reader, session *Session, _ Limits) (Command, error) {
+		return NewLoginV2Command(metadata, stream, session.Conn(), session.HasFeature(FeatureSessionTokens))
+	},
+	ResumeCommandCode: func(metadata Metadata, stream io.Reader, session *Session, _ Limits) (Command, error) {
+		return NewResumeCommand(metadata, stream, session.Conn(), session.HasFeature(FeatureSessionTokens))
+	},
+	HelloCommandCode: func(metadata Metadata, stream io.Reader, session *Session, _ Limits) (Command, error) {
+		return NewHelloCommand(metadata, stream, session, session.policy.Features)
+	},
+	AckCommandCode: func(metadata Metadata, stream io.Reader, session *Session, _ Limits) (Command, error) {
+		return NewAckCommand(metadata, stream, session.Conn())
+	},
+}
+
+// v2Decoders returns the decoders of ProtocolVersion2: the ones of ProtocolVersion,
+// except for the commands whose wire format changed
+func v2Decoders() map[uint16]decoder {
+	v2 := maps.Clone(v1Decoders)
+
+	v2[MessageCommandCode] = func(metadata Metadata, stream io.Reader, session *Session, _ Limits) (Command, error) {
+		return NewMessageCommandV2(metadata, stream, session.Conn())
+	}
+
+	return v2
+}
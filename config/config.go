@@ -0,0 +1,336 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"os"
+	"slices"
+	"strings"
+	"tcpserver/logging"
+	"time"
+)
+
+const (
+	EnvPrefix = "TCPSERVER_"
+
+	configFlagName = "config"
+)
+
+const (
+	// OversizedFramePolicySkip discards the oversized frames, keeping the connection open
+	OversizedFramePolicySkip = "skip"
+	// OversizedFramePolicyDisconnect closes the connection after an oversized frame
+	OversizedFramePolicyDisconnect = "disconnect"
+)
+
+const (
+	// MailboxOverflowPolicyReject refuses the messages addressed to a full mailbox
+	MailboxOverflowPolicyReject = "reject"
+	// MailboxOverflowPolicyDropOldest drops the oldest message of a full mailbox to make room
+	MailboxOverflowPolicyDropOldest = "drop-oldest"
+	// MailboxOverflowPolicySpill keeps the messages overflowing a full mailbox in the store of data-dir alone
+	MailboxOverflowPolicySpill = "spill"
+)
+
+var (
+	LogLevels               = []string{"debug", "info", "warn", "error"}
+	LogFormats              = []string{logging.FormatText, logging.FormatJSON}
+	OversizedFramePolicies  = []string{OversizedFramePolicySkip, OversizedFramePolicyDisconnect}
+	MailboxOverflowPolicies = []string{MailboxOverflowPolicyReject, MailboxOverflowPolicyDropOldest, MailboxOverflowPolicySpill}
+)
+
+// Config holds the settings of the server.
+// Each setting can come from (in order of precedence):
+//   - a command line flag, e.g. -listen-address
+//   - an environment variable, e.g. TCPSERVER_LISTEN_ADDRESS
+//   - a JSON config file, e.g. {"listen-address": ":5555"}
+//   - its default value
+//
+// The config file is optional, and its path is set with -config (or TCPSERVER_CONFIG).
+type Config struct {
+	ListenAddress          string
+	DataDir                string
+	MailboxSize            int
+	MailboxOverflowPolicy  string
+	CompactionInterval     time.Duration
+	ShutdownTimeout        time.Duration
+	IdleTimeout            time.Duration
+	WriteTimeout           time.Duration
+	MaxFrameSize           int
+	MaxUsernameLength      int
+	MaxMessageLength       int
+	OversizedFramePolicy   string
+	AllowPasswordlessLogin bool
+	LogLevel               string
+	LogFormat              string
+	LogRedactPayloads      bool
+	MetricsAddress         string
+	TLSCertFile            string
+	TLSKeyFile             string
+	TLSClientCAFile        string
+	SessionTokenKey        string
+	SessionTokenTTL        time.Duration
+	SessionResumeGrace     time.Duration
+}
+
+func Default() Config {
+	return Config{
+		ListenAddress:          ":5555",
+		DataDir:                "data",
+		MailboxSize:            100,
+		MailboxOverflowPolicy:  MailboxOverflowPolicyReject,
+		CompactionInterval:     5 * time.Minute,
+		ShutdownTimeout:        10 * time.Second,
+		IdleTimeout:            5 * time.Minute,
+		WriteTimeout:           10 * time.Second,
+		MaxFrameSize:           1 << 20,
+		MaxUsernameLength:      64,
+		MaxMessageLength:       0xFFFF,
+		OversizedFramePolicy:   OversizedFramePolicyDisconnect,
+		AllowPasswordlessLogin: false,
+		LogLevel:               "info",
+		LogFormat:              logging.FormatText,
+		LogRedactPayloads:      true,
+		MetricsAddress:         "",
+		TLSCertFile:            "",
+		TLSKeyFile:             "",
+		TLSClientCAFile:        "",
+		SessionTokenKey:        "",
+		SessionTokenTTL:        24 * time.Hour,
+		SessionResumeGrace:     5 * time.Minute,
+	}
+}
+
+// Load builds the config from the command line arguments (without the program name),
+// the environment variables (looked up with lookupEnv, usually os.LookupEnv)
+// and the config file, and validates it
+func Load(args []string, lookupEnv func(string) (string, bool)) (*Config, error) {
+
+	// the flags get parsed a first time only to find the config file,
+	// since they have to override the values coming from it
+	scratch := Default()
+	var configPath string
+	fs := newFlagSet(&scratch, &configPath)
+	err := fs.Parse(args)
+	if err != nil {
+		return nil, err
+	}
+	if configPath == "" {
+		configPath, _ = lookupEnv(envName(configFlagName))
+	}
+
+	cfg := Default()
+	fs = newFlagSet(&cfg, &configPath)
+
+	if configPath != "" {
+		err = loadFile(fs, configPath)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = loadEnv(fs, lookupEnv)
+	if err != nil {
+		return nil, err
+	}
+
+	err = fs.Parse(args)
+	if err != nil {
+		return nil, err
+	}
+
+	err = cfg.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	return &cfg, nil
+}
+
+// Validate checks that the settings make sense, reporting all the invalid ones at once
+func (c *Config) Validate() error {
+
+	var errs []error
+
+	_, _, err := net.SplitHostPort(c.ListenAddress)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("invalid listen-address %q: %w", c.ListenAddress, err))
+	}
+
+	if c.MailboxSize <= 0 {
+		errs = append(errs, fmt.Errorf("invalid mailbox-size %d: must be positive", c.MailboxSize))
+	}
+
+	if !slices.Contains(MailboxOverflowPolicies, c.MailboxOverflowPolicy) {
+		errs = append(errs, fmt.Errorf("invalid mailbox-overflow-policy %q: must be one of %s", c.MailboxOverflowPolicy, strings.Join(MailboxOverflowPolicies, ", ")))
+	}
+	if c.MailboxOverflowPolicy == MailboxOverflowPolicySpill && c.DataDir == "" {
+		errs = append(errs, fmt.Errorf("invalid mailbox-overflow-policy %q: requires a data-dir", c.MailboxOverflowPolicy))
+	}
+
+	for _, d := range []struct {
+		name  string
+		value time.Duration
+	}{
+		{"compaction-interval", c.CompactionInterval},
+		{"idle-timeout", c.IdleTimeout},
+		{"write-timeout", c.WriteTimeout},
+		{"session-resume-grace", c.SessionResumeGrace},
+	} {
+		if d.value < 0 {
+			errs = append(errs, fmt.Errorf("invalid %s %s: must not be negative", d.name, d.value))
+		}
+	}
+
+	if c.ShutdownTimeout <= 0 {
+		errs = append(errs, fmt.Errorf("invalid shutdown-timeout %s: must be positive", c.ShutdownTimeout))
+	}
+
+	// the smallest frame holds the metadata: version, command code and correlationId
+	if c.MaxFrameSize < 7 || int64(c.MaxFrameSize) > math.MaxUint32 {
+		errs = append(errs, fmt.Errorf("invalid max-frame-size %d: must be between 7 and %d bytes", c.MaxFrameSize, uint32(math.MaxUint32)))
+	}
+
+	// the fields are prefixed by their length as a uint16
+	if c.MaxUsernameLength <= 0 || c.MaxUsernameLength > 0xFFFF {
+		errs = append(errs, fmt.Errorf("invalid max-username-length %d: must be between 1 and 65535", c.MaxUsernameLength))
+	}
+	if c.MaxMessageLength <= 0 || c.MaxMessageLength > 0xFFFF {
+		errs = append(errs, fmt.Errorf("invalid max-message-length %d: must be between 1 and 65535", c.MaxMessageLength))
+	}
+
+	if !slices.Contains(OversizedFramePolicies, c.OversizedFramePolicy) {
+		errs = append(errs, fmt.Errorf("invalid oversized-frame-policy %q: must be one of %s", c.OversizedFramePolicy, strings.Join(OversizedFramePolicies, ", ")))
+	}
+
+	if !slices.Contains(LogLevels, c.LogLevel) {
+		errs = append(errs, fmt.Errorf("invalid log-level %q: must be one of %s", c.LogLevel, strings.Join(LogLevels, ", ")))
+	}
+	if !slices.Contains(LogFormats, c.LogFormat) {
+		errs = append(errs, fmt.Errorf("invalid log-format %q: must be one of %s", c.LogFormat, strings.Join(LogFormats, ", ")))
+	}
+
+	if c.MetricsAddress != "" {
+		_, _, err = net.SplitHostPort(c.MetricsAddress)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid metrics-address %q: %w", c.MetricsAddress, err))
+		}
+	}
+
+	if (c.TLSCertFile == "") != (c.TLSKeyFile == "") {
+		errs = append(errs, errors.New("invalid tls-cert-file and tls-key-file: must be set together"))
+	}
+	if c.TLSClientCAFile != "" && c.TLSCertFile == "" {
+		errs = append(errs, fmt.Errorf("invalid tls-client-ca-file %q: requires tls-cert-file and tls-key-file", c.TLSClientCAFile))
+	}
+
+	if c.SessionResumeGrace > 0 && c.SessionTokenTTL <= 0 {
+		errs = append(errs, fmt.Errorf("invalid session-token-ttl %s: must be positive", c.SessionTokenTTL))
+	}
+	// the key signs the tokens with HMAC-SHA256, whose own size is 32 bytes
+	if c.SessionTokenKey != "" && len(c.SessionTokenKey) < 32 {
+		errs = append(errs, errors.New("invalid session-token-key: must be at least 32 bytes long"))
+	}
+
+	return errors.Join(errs...)
+}
+
+func newFlagSet(cfg *Config, configPath *string) *flag.FlagSet {
+
+	fs := flag.NewFlagSet("tcpserver", flag.ContinueOnError)
+
+	fs.StringVar(configPath, configFlagName, *configPath, "path of the JSON config file")
+	fs.StringVar(&cfg.ListenAddress, "listen-address", cfg.ListenAddress, "address to listen on for incoming connections")
+	fs.StringVar(&cfg.DataDir, "data-dir", cfg.DataDir, "directory where users and messages are persisted, empty to keep them in memory only")
+	fs.IntVar(&cfg.MailboxSize, "mailbox-size", cfg.MailboxSize, "maximum number of messages kept in the mailbox of each user, undelivered or not acknowledged")
+	fs.StringVar(&cfg.MailboxOverflowPolicy, "mailbox-overflow-policy", cfg.MailboxOverflowPolicy, "what to do with the messages addressed to a full mailbox: "+strings.Join(MailboxOverflowPolicies, ", "))
+	fs.DurationVar(&cfg.CompactionInterval, "compaction-interval", cfg.CompactionInterval, "interval between the compactions of the persisted data, 0 to disable them")
+	fs.DurationVar(&cfg.ShutdownTimeout, "shutdown-timeout", cfg.ShutdownTimeout, "maximum time to wait for the connections to drain on shutdown")
+	fs.DurationVar(&cfg.IdleTimeout, "idle-timeout", cfg.IdleTimeout, "time after which a silent connection gets closed, 0 to disable it")
+	fs.DurationVar(&cfg.WriteTimeout, "write-timeout", cfg.WriteTimeout, "maximum time to write a frame on a connection, 0 to disable it")
+	fs.IntVar(&cfg.MaxFrameSize, "max-frame-size", cfg.MaxFrameSize, "maximum size in bytes of a frame sent by a client")
+	fs.IntVar(&cfg.MaxUsernameLength, "max-username-length", cfg.MaxUsernameLength, "maximum length in bytes of a username")
+	fs.IntVar(&cfg.MaxMessageLength, "max-message-length", cfg.MaxMessageLength, "maximum length in bytes of a message")
+	fs.StringVar(&cfg.OversizedFramePolicy, "oversized-frame-policy", cfg.OversizedFramePolicy, "what to do with the connection sending an oversized frame: "+strings.Join(OversizedFramePolicies, ", "))
+	fs.BoolVar(&cfg.AllowPasswordlessLogin, "allow-passwordless-login", cfg.AllowPasswordlessLogin, "accept the Login command, which authenticates on the username alone, for the clients that don't support passwords")
+	fs.StringVar(&cfg.LogLevel, "log-level", cfg.LogLevel, "minimum level of the logs: "+strings.Join(LogLevels, ", "))
+	fs.StringVar(&cfg.LogFormat, "log-format", cfg.LogFormat, "format of the logs: "+strings.Join(LogFormats, ", "))
+	fs.BoolVar(&cfg.LogRedactPayloads, "log-redact-payloads", cfg.LogRedactPayloads, "replace the content of the messages with their length in the logs")
+	fs.StringVar(&cfg.MetricsAddress, "metrics-address", cfg.MetricsAddress, "address of the HTTP listener serving the Prometheus metrics on /metrics, empty to disable it")
+	fs.StringVar(&cfg.TLSCertFile, "tls-cert-file", cfg.TLSCertFile, "PEM certificate to serve the connections over TLS, empty to accept them in clear text")
+	fs.StringVar(&cfg.TLSKeyFile, "tls-key-file", cfg.TLSKeyFile, "PEM private key of tls-cert-file")
+	fs.StringVar(&cfg.TLSClientCAFile, "tls-client-ca-file", cfg.TLSClientCAFile, "PEM CAs the clients must present a certificate from, empty to not ask for client certificates")
+	fs.StringVar(&cfg.SessionTokenKey, "session-token-key", cfg.SessionTokenKey, "secret signing the session tokens, empty to generate a random one on start")
+	fs.DurationVar(&cfg.SessionTokenTTL, "session-token-ttl", cfg.SessionTokenTTL, "time after which a session token expires")
+	fs.DurationVar(&cfg.SessionResumeGrace, "session-resume-grace", cfg.SessionResumeGrace, "time after a connection drops during which its session can be resumed with its token, 0 to not issue session tokens")
+
+	return fs
+}
+
+// loadFile sets the flags with the values in the config file, whose keys are the flag names
+func loadFile(fs *flag.FlagSet, path string) error {
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("reading config file: %w", err)
+	}
+
+	// numbers are kept as they are written, so that they can be parsed by the flags
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.UseNumber()
+
+	var values map[string]any
+	err = decoder.Decode(&values)
+	if err != nil {
+		return fmt.Errorf("parsing config file %s: %w", path, err)
+	}
+	if _, err = decoder.Token(); err != io.EOF {
+		return fmt.Errorf("parsing config file %s: unexpected content after the JSON object", path)
+	}
+
+	for name, value := range values {
+
+		f := fs.Lookup(name)
+		if f == nil || name == configFlagName {
+			return fmt.Errorf("invalid config file %s: unknown setting %q", path, name)
+		}
+
+		err = f.Value.Set(fmt.Sprint(value))
+		if err != nil {
+			return fmt.Errorf("invalid config file %s: setting %q: %w", path, name, err)
+		}
+	}
+
+	return nil
+}
+
+// loadEnv sets the flags with the values of the matching environment variables
+func loadEnv(fs *flag.FlagSet, lookupEnv func(string) (string, bool)) error {
+
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+
+		value, ok := lookupEnv(envName(f.Name))
+		if !ok || f.Name == configFlagName || err != nil {
+			return
+		}
+
+		sErr := f.Value.Set(value)
+		if sErr != nil {
+			err = fmt.Errorf("invalid environment variable %s: %w", envName(f.Name), sErr)
+		}
+	})
+
+	return err
+}
+
+// envName returns the environment variable matching the flag, e.g. TCPSERVER_LISTEN_ADDRESS for -listen-address
+func envName(flagName string) string {
+	return EnvPrefix + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
@@ -0,0 +1,269 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Load(t *testing.T) {
+	configFile := filepath.Join(t.TempDir(), "config.json")
+	require.NoError(t, os.WriteFile(configFile, []byte(`{
+		"listen-address": ":6000",
+		"mailbox-size": 10,
+		"idle-timeout": "1m",
+		"log-level": "warn"
+	}`), 0o600))
+
+	tests := []struct {
+		name    string
+		args    []string
+		env     map[string]string
+		wantCfg func(cfg *Config)
+		wantErr string
+	}{
+		{
+			name:    "happy path: defaults",
+			wantCfg: func(cfg *Config) {},
+		},
+		{
+			name: "happy path: config file",
+			args: []string{"-config", configFile},
+			wantCfg: func(cfg *Config) {
+				cfg.ListenAddress = ":6000"
+				cfg.MailboxSize = 10
+				cfg.IdleTimeout = time.Minute
+				cfg.LogLevel = "warn"
+			},
+		},
+		{
+			name: "happy path: config file from environment",
+			env: map[string]string{
+				"TCPSERVER_CONFIG": configFile,
+			},
+			wantCfg: func(cfg *Config) {
+				cfg.ListenAddress = ":6000"
+				cfg.MailboxSize = 10
+				cfg.IdleTimeout = time.Minute
+				cfg.LogLevel = "warn"
+			},
+		},
+		{
+			name: "happy path: environment overrides config file",
+			args: []string{"-config", configFile},
+			env: map[string]string{
+				"TCPSERVER_MAILBOX_SIZE": "20",
+				"TCPSERVER_DATA_DIR":     "",
+			},
+			wantCfg: func(cfg *Config) {
+				cfg.ListenAddress = ":6000"
+				cfg.MailboxSize = 20
+				cfg.IdleTimeout = time.Minute
+				cfg.LogLevel = "warn"
+				cfg.DataDir = ""
+			},
+		},
+		{
+			name: "happy path: flags override environment and config file",
+			args: []string{"-config", configFile, "-mailbox-size", "30", "-listen-address", "127.0.0.1:7000"},
+			env: map[string]string{
+				"TCPSERVER_MAILBOX_SIZE": "20",
+			},
+			wantCfg: func(cfg *Config) {
+				cfg.ListenAddress = "127.0.0.1:7000"
+				cfg.MailboxSize = 30
+				cfg.IdleTimeout = time.Minute
+				cfg.LogLevel = "warn"
+			},
+		},
+		{
+			name: "happy path: mailbox overflow policy",
+			args: []string{"-mailbox-overflow-policy", "drop-oldest"},
+			wantCfg: func(cfg *Config) {
+				cfg.MailboxOverflowPolicy = MailboxOverflowPolicyDropOldest
+			},
+		},
+		{
+			name: "happy path: log settings",
+			args: []string{"-log-format", "json", "-log-redact-payloads=false"},
+			env: map[string]string{
+				"TCPSERVER_LOG_LEVEL": "debug",
+			},
+			wantCfg: func(cfg *Config) {
+				cfg.LogLevel = "debug"
+				cfg.LogFormat = "json"
+				cfg.LogRedactPayloads = false
+			},
+		},
+		{
+			name: "happy path: passwordless login",
+			args: []string{"-allow-passwordless-login"},
+			wantCfg: func(cfg *Config) {
+				cfg.AllowPasswordlessLogin = true
+			},
+		},
+		{
+			name: "happy path: metrics address",
+			env: map[string]string{
+				"TCPSERVER_METRICS_ADDRESS": "localhost:9090",
+			},
+			wantCfg: func(cfg *Config) {
+				cfg.MetricsAddress = "localhost:9090"
+			},
+		},
+		{
+			name: "happy path: tls",
+			args: []string{"-tls-cert-file", "server.crt", "-tls-key-file", "server.key", "-tls-client-ca-file", "ca.crt"},
+			wantCfg: func(cfg *Config) {
+				cfg.TLSCertFile = "server.crt"
+				cfg.TLSKeyFile = "server.key"
+				cfg.TLSClientCAFile = "ca.crt"
+			},
+		},
+		{
+			name: "happy path: session tokens",
+			env: map[string]string{
+				"TCPSERVER_SESSION_TOKEN_KEY": "0123456789abcdef0123456789abcdef",
+			},
+			args: []string{"-session-token-ttl", "1h", "-session-resume-grace", "30s"},
+			wantCfg: func(cfg *Config) {
+				cfg.SessionTokenKey = "0123456789abcdef0123456789abcdef"
+				cfg.SessionTokenTTL = time.Hour
+				cfg.SessionResumeGrace = 30 * time.Second
+			},
+		},
+		{
+			name: "happy path: session tokens disabled",
+			args: []string{"-session-resume-grace", "0", "-session-token-ttl", "0"},
+			wantCfg: func(cfg *Config) {
+				cfg.SessionTokenTTL = 0
+				cfg.SessionResumeGrace = 0
+			},
+		},
+		{
+			name:    "error: unknown flag",
+			args:    []string{"-unknown"},
+			wantErr: "flag provided but not defined: -unknown",
+		},
+		{
+			name: "error: invalid environment variable",
+			env: map[string]string{
+				"TCPSERVER_IDLE_TIMEOUT": "soon",
+			},
+			wantErr: "invalid environment variable TCPSERVER_IDLE_TIMEOUT",
+		},
+		{
+			name:    "error: missing config file",
+			args:    []string{"-config", filepath.Join(t.TempDir(), "missing.json")},
+			wantErr: "reading config file",
+		},
+		{
+			name:    "error: invalid values",
+			args:    []string{"-listen-address", "nowhere", "-max-frame-size", "4"},
+			wantErr: "invalid listen-address \"nowhere\": address nowhere: missing port in address\ninvalid max-frame-size 4: must be between 7 and 4294967295 bytes",
+		},
+		{
+			name:    "error: unknown log format",
+			args:    []string{"-log-format", "xml"},
+			wantErr: "invalid log-format \"xml\": must be one of text, json",
+		},
+		{
+			name:    "error: unknown mailbox overflow policy",
+			args:    []string{"-mailbox-overflow-policy", "block"},
+			wantErr: "invalid mailbox-overflow-policy \"block\": must be one of reject, drop-oldest, spill",
+		},
+		{
+			name:    "error: spilling without data directory",
+			args:    []string{"-mailbox-overflow-policy", "spill", "-data-dir", ""},
+			wantErr: "invalid mailbox-overflow-policy \"spill\": requires a data-dir",
+		},
+		{
+			name:    "error: invalid metrics address",
+			args:    []string{"-metrics-address", "9090"},
+			wantErr: "invalid metrics-address \"9090\"",
+		},
+		{
+			name:    "error: tls certificate without key",
+			args:    []string{"-tls-cert-file", "server.crt"},
+			wantErr: "invalid tls-cert-file and tls-key-file: must be set together",
+		},
+		{
+			name:    "error: tls client CAs without certificate",
+			args:    []string{"-tls-client-ca-file", "ca.crt"},
+			wantErr: "invalid tls-client-ca-file \"ca.crt\": requires tls-cert-file and tls-key-file",
+		},
+		{
+			name:    "error: session token key too short",
+			args:    []string{"-session-token-key", "secret"},
+			wantErr: "invalid session-token-key: must be at least 32 bytes long",
+		},
+		{
+			name:    "error: session tokens without ttl",
+			args:    []string{"-session-token-ttl", "0"},
+			wantErr: "invalid session-token-ttl 0s: must be positive",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			lookupEnv := func(name string) (string, bool) {
+				value, ok := tt.env[name]
+				return value, ok
+			}
+
+			cfg, err := Load(tt.args, lookupEnv)
+
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				assert.Nil(t, cfg)
+				return
+			}
+
+			wantCfg := Default()
+			tt.wantCfg(&wantCfg)
+			assert.Equal(t, &wantCfg, cfg)
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func Test_LoadFile_Errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{
+			name:    "error: not JSON",
+			content: "listen-address: :6000",
+			wantErr: "parsing config file",
+		},
+		{
+			name:    "error: unknown setting",
+			content: `{"port": 5555}`,
+			wantErr: `unknown setting "port"`,
+		},
+		{
+			name:    "error: invalid value",
+			content: `{"mailbox-size": "many"}`,
+			wantErr: `setting "mailbox-size"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			configFile := filepath.Join(t.TempDir(), "config.json")
+			require.NoError(t, os.WriteFile(configFile, []byte(tt.content), 0o600))
+
+			noEnv := func(string) (string, bool) { return "", false }
+
+			_, err := Load([]string{"-config", configFile}, noEnv)
+
+			assert.ErrorContains(t, err, tt.wantErr)
+		})
+	}
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"errors"
+	"log/slog"
+	"tcpserver/commands"
+	"tcpserver/state"
+)
+
+// errDeliveryStopped is returned when the delivery stops before all the messages have been delivered
+var errDeliveryStopped = errors.New("delivery stopped")
+
+// delivery tracks the goroutine pushing the queued messages of a user
+// to the connection they are logged in on
+type delivery struct {
+	username string
+	// acks is set when the client acknowledges the deliveries itself, see commands.FeatureDeliveryAcks
+	acks   bool
+	logger *slog.Logger
+	// interrupt is closed when the user logs out of the connection, see state.State.Interrupt
+	interrupt <-chan struct{}
+	stop      chan struct{}
+	done      chan struct{}
+}
+
+// syncDelivery makes sure that the messages are being delivered to the user
+// currently logged in on the connection (if any), stopping the delivery
+// to the previous one when it changes
+func (s *Server) syncDelivery(session *commands.Session, out *frameWriter, current *delivery) *delivery {
+
+	username, loggedIn := s.state.Username(session.Conn())
+	if current != nil && loggedIn && current.username == username {
+		return current
+	}
+
+	if current != nil {
+		close(current.stop)
+		<-current.done
+	}
+
+	if !loggedIn {
+		return nil
+	}
+
+	d := &delivery{
+		username:  username,
+		acks:      session.HasFeature(commands.FeatureDeliveryAcks),
+		logger:    session.Logger(),
+		interrupt: s.state.Interrupt(session.Conn()),
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+	go s.deliverMessages(out, d)
+
+	return d
+}
+
+func (s *Server) deliverMessages(out *frameWriter, d *delivery) {
+	defer close(d.done)
+
+	notify := s.state.Mailbox(d.username)
+
+	// the deliveries that weren't acknowledged get replayed first, then the messages received
+	// while the user was offline, followed by a frame telling the client that the backlog is over
+	unacknowledged := s.state.Unacknowledged(d.username)
+	err := s.replayUnacknowledged(out, d, unacknowledged)
+	if err == errDeliveryStopped {
+		return
+	}
+	if err != nil {
+		d.logger.Warn("replaying unacknowledged message", "error", err)
+		return
+	}
+
+	offline := s.state.DrainMailbox(d.username)
+	err = s.deliverBatch(out, d, offline)
+	if err == errDeliveryStopped {
+		return
+	}
+	if err != nil {
+		d.logger.Warn("replaying offline message", "error", err)
+		return
+	}
+
+	err = out.WriteFrame(commands.NewReplayDone(uint32(len(unacknowledged) + len(offline))))
+	if err != nil {
+		d.logger.Warn("completing offline messages replay", "error", err)
+		return
+	}
+
+	for {
+		select {
+		case <-d.stop:
+			return
+		case <-d.interrupt:
+			return
+		case <-notify:
+			err := s.deliverBatch(out, d, s.state.DrainMailbox(d.username))
+			if err == errDeliveryStopped {
+				return
+			}
+			if err != nil {
+				d.logger.Warn("delivering message", "error", err)
+				return
+			}
+		}
+	}
+}
+
+// replayUnacknowledged delivers again, with their sequence, the deliveries that weren't acknowledged.
+// They stay in the mailbox until they are, so nothing needs to be put back when the delivery stops.
+func (s *Server) replayUnacknowledged(out *frameWriter, d *delivery, deliveries []state.Delivery) error {
+
+	for _, delivery := range deliveries {
+
+		select {
+		case <-d.stop:
+			return errDeliveryStopped
+		case <-d.interrupt:
+			return errDeliveryStopped
+		default:
+		}
+
+		err := s.deliverMessage(out, d, delivery)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// deliverBatch delivers the messages taken from the mailbox one by one, until the delivery
+// gets stopped or fails: the messages not numbered yet are put back in the mailbox, for the next delivery,
+// while the one that failed stays unacknowledged
+func (s *Server) deliverBatch(out *frameWriter, d *delivery, msgs []state.Message) error {
+
+	for i, msg := range msgs {
+
+		select {
+		case <-d.stop:
+			s.state.PutBack(d.username, msgs[i:])
+			return errDeliveryStopped
+		case <-d.interrupt:
+			s.state.PutBack(d.username, msgs[i:])
+			return errDeliveryStopped
+		default:
+		}
+
+		err := s.deliverMessage(out, d, s.state.Deliver(d.username, msg))
+		if err != nil {
+			s.state.PutBack(d.username, msgs[i+1:])
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *Server) deliverMessage(out *frameWriter, d *delivery, delivery state.Delivery) error {
+
+	msg := delivery.Message
+	frame := commands.NewDelivery(msg.From, d.username, msg.Timestamp, msg.Payload)
+	if d.acks {
+		frame = commands.NewNumberedDelivery(delivery.Sequence, msg.From, d.username, msg.Timestamp, msg.Payload)
+	}
+
+	err := out.WriteFrame(frame)
+	if err != nil {
+		return err
+	}
+
+	d.logger.Debug("message delivered", "sequence", delivery.Sequence, "message", msg)
+
+	// without the acknowledgements of the client, the message counts as received once written
+	if !d.acks {
+		s.state.Acknowledge(d.username, delivery.Sequence)
+	}
+
+	return nil
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"os"
+	"tcpserver/commands"
+	"tcpserver/config"
+	"tcpserver/protocol"
+	"tcpserver/state"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// sendMessage sends a message on the connection of the sender, waiting for its response
+func sendMessage(t *testing.T, conn net.Conn, correlationID uint32, msg protocol.Message) {
+	send(t, conn, correlationID, &msg)
+
+	header, body := receive(t, conn)
+	require.Equal(t, correlationID, header.CorrelationID)
+	require.Equal(t, protocol.StatusOK, body.(*protocol.Response).Status)
+}
+
+// assertNothingReceived checks that the server doesn't write anything on the connection for a while
+func assertNothingReceived(t *testing.T, conn net.Conn) {
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(100*time.Millisecond)))
+
+	_, _, err := protocol.ReadFrame(conn, 1<<20)
+	assert.True(t, isTimeout(err), "expected nothing, got %v", err)
+}
+
+func isTimeout(err error) bool {
+	return errors.Is(err, os.ErrDeadlineExceeded)
+}
+
+func Test_Server_Delivery_Online(t *testing.T) {
+	s := newTestServer(t, nil)
+	alice := connect(t, s)
+	login(t, alice, "alice")
+	bob := connect(t, s)
+	login(t, bob, "bob")
+
+	sendMessage(t, alice, 2, protocol.Message{Message: "Hi", From: "alice", To: "bob", Timestamp: time.Unix(1, 0)})
+
+	header, body := receive(t, bob)
+	assert.Equal(t, uint32(0), header.CorrelationID)
+	assert.Equal(t, &protocol.Delivery{Message: "Hi", From: "alice", To: "bob", Timestamp: time.Unix(1, 0)}, body)
+
+	// without acknowledgements, the message counts as received once written
+	assert.Eventually(t, func() bool {
+		return s.state.QueuedMessages()["bob"] == 0
+	}, time.Second, time.Millisecond)
+}
+
+func Test_Server_Delivery_OfflineReplay(t *testing.T) {
+	s := newTestServer(t, nil)
+	alice := connect(t, s)
+	login(t, alice, "alice")
+
+	// bob is known, but offline
+	offline := &net.TCPConn{}
+	require.NoError(t, s.state.Login(offline, "bob"))
+	s.state.Logout(offline)
+
+	sendMessage(t, alice, 2, protocol.Message{Message: "second", From: "alice", To: "bob", Timestamp: time.Unix(2, 0)})
+	sendMessage(t, alice, 3, protocol.Message{Message: "first", From: "alice", To: "bob", Timestamp: time.Unix(1, 0)})
+
+	bob := connect(t, s)
+	send(t, bob, 1, &protocol.Login{Username: "bob"})
+
+	// the response comes first, then the messages oldest first, then the end of the replay
+	_, body := receive(t, bob)
+	assert.Equal(t, protocol.StatusOK, body.(*protocol.Response).Status)
+	_, body = receive(t, bob)
+	assert.Equal(t, &protocol.Delivery{Message: "first", From: "alice", To: "bob", Timestamp: time.Unix(1, 0)}, body)
+	_, body = receive(t, bob)
+	assert.Equal(t, &protocol.Delivery{Message: "second", From: "alice", To: "bob", Timestamp: time.Unix(2, 0)}, body)
+	_, body = receive(t, bob)
+	assert.Equal(t, &protocol.ReplayDone{Count: 2}, body)
+
+	// the messages received from now on are delivered as they come
+	sendMessage(t, alice, 4, protocol.Message{Message: "third", From: "alice", To: "bob", Timestamp: time.Unix(3, 0)})
+	_, body = receive(t, bob)
+	assert.Equal(t, &protocol.Delivery{Message: "third", From: "alice", To: "bob", Timestamp: time.Unix(3, 0)}, body)
+}
+
+func Test_Server_Delivery_StopsOnLogout(t *testing.T) {
+	s := newTestServer(t, nil)
+	alice := connect(t, s)
+	login(t, alice, "alice")
+	bob := connect(t, s)
+	login(t, bob, "bob")
+
+	send(t, bob, 2, &protocol.Logout{})
+	_, body := receive(t, bob)
+	require.Equal(t, protocol.StatusOK, body.(*protocol.Response).Status)
+
+	sendMessage(t, alice, 2, protocol.Message{Message: "Hi", From: "alice", To: "bob", Timestamp: time.Unix(1, 0)})
+
+	// the message waits for bob to log in again, on any connection
+	assertNothingReceived(t, bob)
+	assert.Equal(t, 1, s.state.QueuedMessages()["bob"])
+}
+
+func Test_Server_Delivery_KeptOnFailedWrite(t *testing.T) {
+	s := newTestServer(t, func(cfg *config.Config) {
+		cfg.WriteTimeout = 50 * time.Millisecond
+	})
+	alice := connect(t, s)
+	login(t, alice, "alice")
+	bob := connect(t, s)
+	login(t, bob, "bob")
+
+	// bob doesn't read anymore, so the delivery can't be written
+	sendMessage(t, alice, 2, protocol.Message{Message: "Hi", From: "alice", To: "bob", Timestamp: time.Unix(1, 0)})
+
+	// once the write timed out, the message is kept unacknowledged, for the next session of bob
+	time.Sleep(200 * time.Millisecond)
+	assert.Equal(t, 1, s.state.QueuedMessages()["bob"])
+	assert.Equal(t, []state.Delivery{
+		{Sequence: 1, Message: state.Message{From: "alice", Timestamp: time.Unix(1, 0), Payload: "Hi"}},
+	}, s.state.Unacknowledged("bob"))
+}
+
+// hello negotiates the features on the connection, all of them having to be accepted
+func hello(t *testing.T, conn net.Conn, features ...string) {
+	send(t, conn, 1, &protocol.Hello{Versions: []byte{protocol.Version1}, Features: features})
+
+	_, body := receive(t, conn)
+	require.Equal(t, protocol.StatusOK, body.(*protocol.Response).Status)
+	var result protocol.HelloResult
+	require.NoError(t, result.Decode(bytes.NewReader(body.(*protocol.Response).Body)))
+	require.ElementsMatch(t, features, result.Features)
+}
+
+func numbered(sequence uint64, message string, timestamp time.Time) *protocol.NumberedDelivery {
+	return &protocol.NumberedDelivery{
+		Sequence: sequence,
+		Delivery: protocol.Delivery{Message: message, From: "alice", To: "bob", Timestamp: timestamp},
+	}
+}
+
+func Test_Server_Delivery_Acks(t *testing.T) {
+	s := newTestServer(t, nil)
+	alice := connect(t, s)
+	login(t, alice, "alice")
+	bob := connect(t, s)
+	hello(t, bob, commands.FeatureDeliveryAcks)
+	login(t, bob, "bob")
+
+	sendMessage(t, alice, 2, protocol.Message{Message: "first", From: "alice", To: "bob", Timestamp: time.Unix(1, 0)})
+	sendMessage(t, alice, 3, protocol.Message{Message: "second", From: "alice", To: "bob", Timestamp: time.Unix(2, 0)})
+
+	_, body := receive(t, bob)
+	assert.Equal(t, numbered(1, "first", time.Unix(1, 0)), body)
+	_, body = receive(t, bob)
+	assert.Equal(t, numbered(2, "second", time.Unix(2, 0)), body)
+
+	// the messages are kept until acknowledged, which gets no answer
+	assert.Equal(t, 2, s.state.QueuedMessages()["bob"])
+	send(t, bob, 4, &protocol.Ack{Sequence: 1})
+	assertNothingReceived(t, bob)
+	assert.Equal(t, 1, s.state.QueuedMessages()["bob"])
+
+	// the next session gets the ones not acknowledged again, with their sequence
+	send(t, bob, 5, &protocol.Logout{})
+	_, body = receive(t, bob)
+	require.Equal(t, protocol.StatusOK, body.(*protocol.Response).Status)
+	send(t, bob, 6, &protocol.Login{Username: "bob"})
+
+	_, body = receive(t, bob)
+	assert.Equal(t, protocol.StatusOK, body.(*protocol.Response).Status)
+	_, body = receive(t, bob)
+	assert.Equal(t, numbered(2, "second", time.Unix(2, 0)), body)
+	_, body = receive(t, bob)
+	assert.Equal(t, &protocol.ReplayDone{Count: 1}, body)
+}
+
+func Test_Server_Delivery_ResumeFromLastReceived(t *testing.T) {
+	s := newTestServer(t, func(cfg *config.Config) {
+		cfg.SessionResumeGrace = time.Minute
+	})
+	alice := connect(t, s)
+	login(t, alice, "alice")
+
+	bob := connect(t, s)
+	hello(t, bob, commands.FeatureDeliveryAcks, commands.FeatureSessionTokens)
+	send(t, bob, 2, &protocol.Login{Username: "bob"})
+	_, body := receive(t, bob)
+	require.Equal(t, protocol.StatusOK, body.(*protocol.Response).Status)
+	_, body = receive(t, bob)
+	token := body.(*protocol.SessionToken).Token
+	_, body = receive(t, bob)
+	require.Equal(t, &protocol.ReplayDone{}, body)
+
+	for i, message := range []string{"first", "second", "third"} {
+		sendMessage(t, alice, uint32(3+i), protocol.Message{Message: message, From: "alice", To: "bob", Timestamp: time.Unix(int64(i+1), 0)})
+	}
+
+	// the connection drops before the last one is read, and before any gets acknowledged
+	for range 2 {
+		receive(t, bob)
+	}
+	require.NoError(t, bob.Close())
+	require.Eventually(t, func() bool {
+		return !s.state.Users()["bob"]
+	}, time.Second, time.Millisecond)
+
+	resumed := connect(t, s)
+	hello(t, resumed, commands.FeatureDeliveryAcks, commands.FeatureSessionTokens)
+	send(t, resumed, 2, &protocol.Resume{Token: token, LastReceived: 2})
+
+	_, body = receive(t, resumed)
+	assert.Equal(t, protocol.StatusOK, body.(*protocol.Response).Status)
+	_, body = receive(t, resumed)
+	assert.IsType(t, &protocol.SessionToken{}, body)
+	_, body = receive(t, resumed)
+	assert.Equal(t, numbered(3, "third", time.Unix(3, 0)), body)
+	_, body = receive(t, resumed)
+	assert.Equal(t, &protocol.ReplayDone{Count: 1}, body)
+	assert.Equal(t, 1, s.state.QueuedMessages()["bob"])
+}
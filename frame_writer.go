@@ -0,0 +1,49 @@
+package main
+
+import (
+	"bytes"
+	"net"
+	"sync"
+	"tcpserver/commands"
+	"time"
+)
+
+// frameWriter serializes the frames written on a connection, so that the
+// responses and the messages pushed by the server never get interleaved
+type frameWriter struct {
+	mutex   sync.Mutex
+	conn    net.Conn
+	timeout time.Duration
+}
+
+// newFrameWriter creates a writer giving up on each frame after the timeout, if not 0
+func newFrameWriter(conn net.Conn, timeout time.Duration) *frameWriter {
+	return &frameWriter{
+		conn:    conn,
+		timeout: timeout,
+	}
+}
+
+func (fw *frameWriter) WriteFrame(f commands.Frame) error {
+
+	// the frame gets fully encoded before taking the lock,
+	// so that it ends up on the socket with a single write
+	var buf bytes.Buffer
+	err := f.Write(&buf)
+	if err != nil {
+		return err
+	}
+
+	fw.mutex.Lock()
+	defer fw.mutex.Unlock()
+
+	if fw.timeout > 0 {
+		err = fw.conn.SetWriteDeadline(time.Now().Add(fw.timeout))
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = fw.conn.Write(buf.Bytes())
+	return err
+}
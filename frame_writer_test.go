@@ -0,0 +1,58 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"os"
+	"sync"
+	"tcpserver/commands"
+	"tcpserver/protocol"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_frameWriter_WriteFrame_Concurrent(t *testing.T) {
+	clientConn, serverConn := net.Pipe()
+	defer clientConn.Close()
+	defer serverConn.Close()
+
+	out := newFrameWriter(serverConn, time.Second)
+
+	// the frames written concurrently never get interleaved
+	var wg sync.WaitGroup
+	for i := range 50 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, out.WriteFrame(commands.NewPing(uint32(i))))
+		}()
+	}
+
+	seen := map[uint32]bool{}
+	for range 50 {
+		header, body, err := protocol.ReadFrame(clientConn, 1<<20)
+		require.NoError(t, err)
+		assert.Equal(t, &protocol.Ping{}, body)
+		seen[header.CorrelationID] = true
+	}
+	wg.Wait()
+	assert.Len(t, seen, 50)
+}
+
+func Test_frameWriter_WriteFrame_Timeout(t *testing.T) {
+	clientConn, serverConn := net.Pipe()
+	defer clientConn.Close()
+	defer serverConn.Close()
+
+	out := newFrameWriter(serverConn, 50*time.Millisecond)
+
+	// the client never reads
+	start := time.Now()
+	err := out.WriteFrame(commands.NewGoingAway())
+
+	assert.True(t, errors.Is(err, os.ErrDeadlineExceeded), "expected a timeout, got %v", err)
+	assert.Less(t, time.Since(start), time.Second)
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"log/slog"
+	"tcpserver/commands"
+	"time"
+)
+
+// heartbeat pings the client when it's been silent for half of the idle timeout,
+// so that a live client gets the chance to answer before the connection gets closed.
+// Each frame received from the client must be signaled on activity.
+func (s *Server) heartbeat(out *frameWriter, logger *slog.Logger, activity <-chan struct{}, stop <-chan struct{}) {
+
+	interval := s.cfg.IdleTimeout / 2
+	timer := time.NewTimer(interval)
+	defer timer.Stop()
+
+	var correlationID uint32
+	for {
+		select {
+		case <-stop:
+			return
+		case <-activity:
+			timer.Reset(interval)
+		case <-timer.C:
+			correlationID++
+			err := out.WriteFrame(commands.NewPing(correlationID))
+			if err != nil {
+				logger.Warn("pinging client", "error", err)
+				return
+			}
+			timer.Reset(interval)
+		}
+	}
+}
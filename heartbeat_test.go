@@ -0,0 +1,61 @@
+package main
+
+import (
+	"tcpserver/config"
+	"tcpserver/protocol"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Server_Heartbeat(t *testing.T) {
+	tests := []struct {
+		name       string
+		answer     bool
+		wantClosed bool
+	}{
+		{
+			name:       "happy path: a client answering the pings stays connected",
+			answer:     true,
+			wantClosed: false,
+		},
+		{
+			name:       "error: a silent client gets disconnected",
+			answer:     false,
+			wantClosed: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			s := newTestServer(t, func(cfg *config.Config) {
+				cfg.IdleTimeout = 100 * time.Millisecond
+			})
+			conn := connect(t, s)
+
+			// the client only reads for a few idle timeouts, answering the pings or not
+			pings := 0
+			closed := false
+			deadline := time.Now().Add(400 * time.Millisecond)
+			for time.Now().Before(deadline) {
+				require.NoError(t, conn.SetReadDeadline(deadline))
+				header, body, err := protocol.ReadFrame(conn, 1<<20)
+				if err != nil {
+					closed = !isTimeout(err)
+					break
+				}
+
+				require.IsType(t, &protocol.Ping{}, body)
+				pings++
+				if tt.answer {
+					send(t, conn, header.CorrelationID, &protocol.Pong{})
+				}
+			}
+
+			assert.Equal(t, tt.wantClosed, closed)
+			assert.GreaterOrEqual(t, pings, 1)
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package logging
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+)
+
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+
+	// PayloadKey is the key of the attributes holding the content of the messages,
+	// which gets redacted when the logger is asked to
+	PayloadKey = "payload"
+)
+
+// Options configures the logger created by New
+type Options struct {
+	// Level is one of debug, info, warn, error
+	Level string
+	// Format is FormatText or FormatJSON
+	Format string
+	// RedactPayloads replaces the content of the messages with its length
+	RedactPayloads bool
+}
+
+// New creates a logger writing on w
+func New(w io.Writer, opts Options) (*slog.Logger, error) {
+
+	var level slog.Level
+	err := level.UnmarshalText([]byte(opts.Level))
+	if err != nil {
+		return nil, fmt.Errorf("invalid log level %q: %w", opts.Level, err)
+	}
+
+	handlerOpts := &slog.HandlerOptions{Level: level}
+	if opts.RedactPayloads {
+		handlerOpts.ReplaceAttr = redactPayload
+	}
+
+	switch strings.ToLower(opts.Format) {
+	case FormatText:
+		return slog.New(slog.NewTextHandler(w, handlerOpts)), nil
+	case FormatJSON:
+		return slog.New(slog.NewJSONHandler(w, handlerOpts)), nil
+	default:
+		return nil, fmt.Errorf("invalid log format %q", opts.Format)
+	}
+}
+
+// Payload returns the attribute holding the content of a message
+func Payload(payload string) slog.Attr {
+	return slog.String(PayloadKey, payload)
+}
+
+// redactPayload replaces the content of the messages with its length, wherever they appear
+func redactPayload(_ []string, a slog.Attr) slog.Attr {
+	if a.Key != PayloadKey || a.Value.Kind() != slog.KindString {
+		return a
+	}
+
+	return slog.String(PayloadKey, fmt.Sprintf("[redacted %d bytes]", len(a.Value.String())))
+}
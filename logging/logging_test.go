@@ -0,0 +1,101 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type mockMessage struct {
+	from    string
+	payload string
+}
+
+func (m mockMessage) LogValue() slog.Value {
+	return slog.GroupValue(slog.String("from", m.from), Payload(m.payload))
+}
+
+func Test_New(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    Options
+		wantLog string
+	}{
+		{
+			name:    "happy path: text",
+			opts:    Options{Level: "info", Format: FormatText},
+			wantLog: "level=INFO msg=delivered message.from=alice message.payload=hello\n",
+		},
+		{
+			name:    "happy path: json",
+			opts:    Options{Level: "info", Format: FormatJSON},
+			wantLog: `{"level":"INFO","msg":"delivered","message":{"from":"alice","payload":"hello"}}` + "\n",
+		},
+		{
+			name:    "happy path: payloads redacted, even in groups",
+			opts:    Options{Level: "info", Format: FormatJSON, RedactPayloads: true},
+			wantLog: `{"level":"INFO","msg":"delivered","message":{"from":"alice","payload":"[redacted 5 bytes]"}}` + "\n",
+		},
+		{
+			name:    "happy path: below the level",
+			opts:    Options{Level: "warn", Format: FormatText},
+			wantLog: "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			var buf bytes.Buffer
+			logger, err := New(&buf, tt.opts)
+			require.NoError(t, err)
+
+			// the time is left out, so that the output is predictable
+			logger = slog.New(withoutTime{logger.Handler()})
+			logger.Info("delivered", "message", mockMessage{from: "alice", payload: "hello"})
+
+			assert.Equal(t, tt.wantLog, buf.String())
+		})
+	}
+}
+
+func Test_New_Errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    Options
+		wantErr string
+	}{
+		{
+			name:    "error: invalid level",
+			opts:    Options{Level: "verbose", Format: FormatText},
+			wantErr: `invalid log level "verbose"`,
+		},
+		{
+			name:    "error: invalid format",
+			opts:    Options{Level: "info", Format: "xml"},
+			wantErr: `invalid log format "xml"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			_, err := New(&bytes.Buffer{}, tt.opts)
+
+			assert.ErrorContains(t, err, tt.wantErr)
+		})
+	}
+}
+
+// withoutTime drops the time of the records before handling them
+type withoutTime struct {
+	slog.Handler
+}
+
+func (h withoutTime) Handle(ctx context.Context, r slog.Record) error {
+	r.Time = time.Time{}
+	return h.Handler.Handle(ctx, r)
+}
@@ -1,9 +1,93 @@
 package main
 
+import (
+	"context"
+	"errors"
+	"flag"
+	"log"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+	"tcpserver/config"
+	"tcpserver/logging"
+)
+
 func main() {
 
-	port := 5555
-	server := NewServer(port)
+	cfg, err := config.Load(os.Args[1:], os.LookupEnv)
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	logger, err := logging.New(os.Stderr, logging.Options{
+		Level:          cfg.LogLevel,
+		Format:         cfg.LogFormat,
+		RedactPayloads: cfg.LogRedactPayloads,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	slog.SetDefault(logger)
+
+	server, err := NewServer(cfg, logger)
+	if err != nil {
+		fatal(err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	// SIGHUP reloads the TLS certificate, without interrupting the connections
+	reload := make(chan os.Signal, 1)
+	signal.Notify(reload, syscall.SIGHUP)
+	defer signal.Stop(reload)
+
+	startErr := make(chan error, 1)
+	go func() {
+		startErr <- server.Start()
+	}()
+
+	running := true
+	for running {
+		select {
+		case err := <-startErr:
+			fatal(err)
+		case <-reload:
+			if cfg.TLSCertFile == "" {
+				slog.Info("TLS is not enabled, nothing to reload")
+				continue
+			}
+			err = server.ReloadTLS()
+			if err != nil {
+				slog.Error("reloading TLS certificate", "error", err)
+			} else {
+				slog.Info("TLS certificate reloaded")
+			}
+		case <-ctx.Done():
+			running = false
+		}
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+
+	err = server.Shutdown(shutdownCtx)
+	if err != nil {
+		fatal(err)
+	}
+
+	// Start returns as soon as the listener gets closed
+	err = <-startErr
+	if !errors.Is(err, ErrServerClosed) {
+		fatal(err)
+	}
+}
 
-	server.Start()
+func fatal(err error) {
+	slog.Error(err.Error())
+	os.Exit(1)
 }
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"tcpserver/commands"
+	"tcpserver/metrics"
+	"time"
+)
+
+// serverMetrics collects the metrics of the server, served on /metrics when cfg.MetricsAddress is set
+type serverMetrics struct {
+	registry    *metrics.Registry
+	commands    *metrics.CounterVec
+	parseErrors *metrics.CounterVec
+	latency     *metrics.HistogramVec
+}
+
+func newServerMetrics(s *Server) *serverMetrics {
+
+	registry := metrics.NewRegistry()
+
+	registry.NewGaugeFunc("tcpserver_active_connections", "Number of open client connections.", func() float64 {
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+		return float64(len(s.conns))
+	})
+
+	registry.NewGaugeFunc("tcpserver_logged_in_users", "Number of users logged in.", func() float64 {
+		var online int
+		for _, isOnline := range s.state.Users() {
+			if isOnline {
+				online++
+			}
+		}
+		return float64(online)
+	})
+
+	registry.NewGaugeVecFunc("tcpserver_queued_messages", "Number of messages waiting in the mailbox of each user.", "username", func() map[string]float64 {
+		queued := map[string]float64{}
+		for username, count := range s.state.QueuedMessages() {
+			queued[username] = float64(count)
+		}
+		return queued
+	})
+
+	return &serverMetrics{
+		registry: registry,
+		commands: registry.NewCounterVec("tcpserver_commands_processed_total",
+			"Number of commands processed, by command code and status code of the response (0x00 without a response).",
+			"command", "status"),
+		parseErrors: registry.NewCounterVec("tcpserver_parse_errors_total",
+			"Number of frames that couldn't be parsed, by type of error.",
+			"type"),
+		latency: registry.NewHistogramVec("tcpserver_command_duration_seconds",
+			"Time taken to process the commands, by command code.",
+			metrics.DefaultBuckets, "command"),
+	}
+}
+
+func (m *serverMetrics) ParseFailed(err error) {
+	m.parseErrors.Inc(commands.StatusName(commands.StatusCode(err)))
+}
+
+func (m *serverMetrics) CommandProcessed(cmdCode uint16, statusCode uint16, duration time.Duration) {
+	command := fmt.Sprintf("0x%02X", cmdCode)
+
+	m.commands.Inc(command, fmt.Sprintf("0x%02X", statusCode))
+	m.latency.Observe(duration.Seconds(), command)
+}
+
+// serveMetrics starts serving the metrics on cfg.MetricsAddress, until the server gets shut down
+func (s *Server) serveMetrics() error {
+
+	ln, err := net.Listen("tcp", s.cfg.MetricsAddress)
+	if err != nil {
+		return fmt.Errorf("listening for metrics: %w", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", s.metrics.registry.Handler())
+	srv := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+
+	s.mutex.Lock()
+	if s.shuttingDown {
+		s.mutex.Unlock()
+		ln.Close()
+		return ErrServerClosed
+	}
+	s.metricsServer = srv
+	s.mutex.Unlock()
+
+	s.logger.Info("serving metrics", "address", ln.Addr().String())
+	go func() {
+		err := srv.Serve(ln)
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			s.logger.Error("serving metrics", "error", err)
+		}
+	}()
+
+	return nil
+}
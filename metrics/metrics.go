@@ -0,0 +1,337 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ContentType is the content type of the Prometheus text exposition format
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// DefaultBuckets are the upper bounds, in seconds, of the buckets of the latency histograms
+var DefaultBuckets = []float64{0.0001, 0.0005, 0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1, 5}
+
+// collector is a metric family, able to write its samples in the text exposition format
+type collector interface {
+	write(w *bufio.Writer)
+}
+
+// Registry holds the metrics exposed by the server
+type Registry struct {
+	mutex      sync.Mutex
+	collectors []collector
+}
+
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+func (r *Registry) register(c collector) {
+	r.mutex.Lock()
+	r.collectors = append(r.collectors, c)
+	r.mutex.Unlock()
+}
+
+// WriteTo writes all the metrics in the Prometheus text exposition format
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.mutex.Lock()
+	collectors := slices.Clone(r.collectors)
+	r.mutex.Unlock()
+
+	cw := &countingWriter{w: w}
+	bw := bufio.NewWriter(cw)
+	for _, c := range collectors {
+		c.write(bw)
+	}
+	err := bw.Flush()
+
+	return cw.n, err
+}
+
+// Handler serves the metrics over HTTP
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", ContentType)
+		_, _ = r.WriteTo(w)
+	})
+}
+
+// CounterVec is a family of counters, one per combination of label values
+type CounterVec struct {
+	name   string
+	help   string
+	labels []string
+
+	mutex  sync.Mutex
+	values map[string]*counterSample
+}
+
+type counterSample struct {
+	labelValues []string
+	value       float64
+}
+
+// NewCounterVec registers a family of counters with the given labels
+func (r *Registry) NewCounterVec(name string, help string, labels ...string) *CounterVec {
+	c := &CounterVec{
+		name:   name,
+		help:   help,
+		labels: labels,
+		values: map[string]*counterSample{},
+	}
+	r.register(c)
+	return c
+}
+
+// Inc adds 1 to the counter with the given label values, which must match the labels in number
+func (c *CounterVec) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+func (c *CounterVec) Add(delta float64, labelValues ...string) {
+	key := seriesKey(labelValues)
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	sample, ok := c.values[key]
+	if !ok {
+		sample = &counterSample{labelValues: slices.Clone(labelValues)}
+		c.values[key] = sample
+	}
+	sample.value += delta
+}
+
+// Value returns the value of the counter with the given label values
+func (c *CounterVec) Value(labelValues ...string) float64 {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	sample, ok := c.values[seriesKey(labelValues)]
+	if !ok {
+		return 0
+	}
+	return sample.value
+}
+
+func (c *CounterVec) write(w *bufio.Writer) {
+	writeHeader(w, c.name, c.help, "counter")
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for _, key := range sortedKeys(c.values) {
+		sample := c.values[key]
+		writeSample(w, c.name, c.labels, sample.labelValues, sample.value)
+	}
+}
+
+// GaugeFunc is a gauge whose value is computed when the metrics get collected
+type GaugeFunc struct {
+	name string
+	help string
+	fn   func() float64
+}
+
+// NewGaugeFunc registers a gauge computed by fn
+func (r *Registry) NewGaugeFunc(name string, help string, fn func() float64) *GaugeFunc {
+	g := &GaugeFunc{
+		name: name,
+		help: help,
+		fn:   fn,
+	}
+	r.register(g)
+	return g
+}
+
+func (g *GaugeFunc) write(w *bufio.Writer) {
+	writeHeader(w, g.name, g.help, "gauge")
+	writeSample(w, g.name, nil, nil, g.fn())
+}
+
+// GaugeVecFunc is a family of gauges with a single label, computed when the metrics get collected
+type GaugeVecFunc struct {
+	name  string
+	help  string
+	label string
+	fn    func() map[string]float64
+}
+
+// NewGaugeVecFunc registers a family of gauges computed by fn, which returns the value of each label value
+func (r *Registry) NewGaugeVecFunc(name string, help string, label string, fn func() map[string]float64) *GaugeVecFunc {
+	g := &GaugeVecFunc{
+		name:  name,
+		help:  help,
+		label: label,
+		fn:    fn,
+	}
+	r.register(g)
+	return g
+}
+
+func (g *GaugeVecFunc) write(w *bufio.Writer) {
+	writeHeader(w, g.name, g.help, "gauge")
+
+	values := g.fn()
+	for _, labelValue := range sortedKeys(values) {
+		writeSample(w, g.name, []string{g.label}, []string{labelValue}, values[labelValue])
+	}
+}
+
+// HistogramVec is a family of histograms, one per combination of label values
+type HistogramVec struct {
+	name    string
+	help    string
+	labels  []string
+	buckets []float64
+
+	mutex  sync.Mutex
+	values map[string]*histogramSample
+}
+
+type histogramSample struct {
+	labelValues []string
+	// counts holds the number of observations of each bucket, not cumulated
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+// NewHistogramVec registers a family of histograms with the given bucket upper bounds and labels
+func (r *Registry) NewHistogramVec(name string, help string, buckets []float64, labels ...string) *HistogramVec {
+	h := &HistogramVec{
+		name:    name,
+		help:    help,
+		labels:  labels,
+		buckets: slices.Sorted(slices.Values(buckets)),
+		values:  map[string]*histogramSample{},
+	}
+	r.register(h)
+	return h
+}
+
+// Observe adds the value to the histogram with the given label values
+func (h *HistogramVec) Observe(value float64, labelValues ...string) {
+	key := seriesKey(labelValues)
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	sample, ok := h.values[key]
+	if !ok {
+		sample = &histogramSample{
+			labelValues: slices.Clone(labelValues),
+			counts:      make([]uint64, len(h.buckets)),
+		}
+		h.values[key] = sample
+	}
+
+	i := sort.SearchFloat64s(h.buckets, value)
+	if i < len(h.buckets) {
+		sample.counts[i]++
+	}
+	sample.count++
+	sample.sum += value
+}
+
+func (h *HistogramVec) write(w *bufio.Writer) {
+	writeHeader(w, h.name, h.help, "histogram")
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	labels := append(slices.Clone(h.labels), "le")
+	for _, key := range sortedKeys(h.values) {
+		sample := h.values[key]
+
+		var cumulated uint64
+		for i, upperBound := range h.buckets {
+			cumulated += sample.counts[i]
+			writeSample(w, h.name+"_bucket", labels, append(slices.Clone(sample.labelValues), formatFloat(upperBound)), float64(cumulated))
+		}
+		writeSample(w, h.name+"_bucket", labels, append(slices.Clone(sample.labelValues), "+Inf"), float64(sample.count))
+		writeSample(w, h.name+"_sum", h.labels, sample.labelValues, sample.sum)
+		writeSample(w, h.name+"_count", h.labels, sample.labelValues, float64(sample.count))
+	}
+}
+
+func writeHeader(w *bufio.Writer, name string, help string, metricType string) {
+	fmt.Fprintf(w, "# HELP %s %s\n", name, escapeHelp(help))
+	fmt.Fprintf(w, "# TYPE %s %s\n", name, metricType)
+}
+
+func writeSample(w *bufio.Writer, name string, labels []string, labelValues []string, value float64) {
+	w.WriteString(name)
+
+	if len(labels) > 0 {
+		w.WriteByte('{')
+		for i, label := range labels {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			fmt.Fprintf(w, "%s=\"%s\"", label, escapeLabelValue(labelValues[i]))
+		}
+		w.WriteByte('}')
+	}
+
+	w.WriteByte(' ')
+	w.WriteString(formatFloat(value))
+	w.WriteByte('\n')
+}
+
+func formatFloat(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	default:
+		return strconv.FormatFloat(value, 'g', -1, 64)
+	}
+}
+
+var (
+	helpEscaper       = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelValueEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(help string) string {
+	return helpEscaper.Replace(help)
+}
+
+func escapeLabelValue(value string) string {
+	return labelValueEscaper.Replace(value)
+}
+
+// seriesKey identifies a combination of label values: the separator can't appear in a valid UTF-8 string
+func seriesKey(labelValues []string) string {
+	return strings.Join(labelValues, "\xff")
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,78 @@
+package metrics
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Registry_WriteTo(t *testing.T) {
+
+	r := NewRegistry()
+
+	counter := r.NewCounterVec("commands_total", "Commands processed.", "command", "status")
+	counter.Inc("0x02", "0x01")
+	counter.Inc("0x02", "0x01")
+	counter.Inc("0x01", "0x04")
+
+	r.NewGaugeFunc("connections_active", "Connections open.", func() float64 { return 3 })
+
+	r.NewGaugeVecFunc("queued_messages", "Messages waiting.", "user", func() map[string]float64 {
+		return map[string]float64{"bob": 2, `a"\b`: 1}
+	})
+
+	histogram := r.NewHistogramVec("duration_seconds", "Latency.\nIn seconds.", []float64{1, 0.1}, "command")
+	histogram.Observe(0.05, "0x02")
+	histogram.Observe(0.5, "0x02")
+	histogram.Observe(7, "0x02")
+
+	var buf bytes.Buffer
+	n, err := r.WriteTo(&buf)
+	require.NoError(t, err)
+
+	assert.Equal(t, `# HELP commands_total Commands processed.
+# TYPE commands_total counter
+commands_total{command="0x01",status="0x04"} 1
+commands_total{command="0x02",status="0x01"} 2
+# HELP connections_active Connections open.
+# TYPE connections_active gauge
+connections_active 3
+# HELP queued_messages Messages waiting.
+# TYPE queued_messages gauge
+queued_messages{user="a\"\\b"} 1
+queued_messages{user="bob"} 2
+# HELP duration_seconds Latency.\nIn seconds.
+# TYPE duration_seconds histogram
+duration_seconds_bucket{command="0x02",le="0.1"} 1
+duration_seconds_bucket{command="0x02",le="1"} 2
+duration_seconds_bucket{command="0x02",le="+Inf"} 3
+duration_seconds_sum{command="0x02"} 7.55
+duration_seconds_count{command="0x02"} 3
+`, buf.String())
+	assert.Equal(t, int64(buf.Len()), n)
+}
+
+func Test_CounterVec_Value(t *testing.T) {
+
+	counter := NewRegistry().NewCounterVec("errors_total", "Errors.", "type")
+	counter.Inc("malformed")
+	counter.Add(2, "malformed")
+
+	assert.Equal(t, float64(3), counter.Value("malformed"))
+	assert.Equal(t, float64(0), counter.Value("unknown"))
+}
+
+func Test_Registry_Handler(t *testing.T) {
+
+	r := NewRegistry()
+	r.NewGaugeFunc("up", "Up.", func() float64 { return 1 })
+
+	rec := httptest.NewRecorder()
+	r.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+
+	assert.Equal(t, ContentType, rec.Header().Get("Content-Type"))
+	assert.Equal(t, "# HELP up Up.\n# TYPE up gauge\nup 1\n", rec.Body.String())
+}
@@ -0,0 +1,432 @@
+package protocol
+
+import (
+	"io"
+	"time"
+)
+
+// The codes of the frames sent by the clients
+const (
+	CodeLogin             uint16 = 0x01
+	CodeMessage           uint16 = 0x02
+	CodeLogout            uint16 = 0x06
+	CodeMultiMessage      uint16 = 0x07
+	CodeBroadcast         uint16 = 0x08
+	CodeCorrelationIDTest uint16 = 0x09
+	CodeListUsers         uint16 = 0x0A
+	CodePing              uint16 = 0x0C
+	CodePong              uint16 = 0x0D
+	CodeRegister          uint16 = 0x0E
+	CodeLoginV2           uint16 = 0x0F
+	CodeResume            uint16 = 0x11
+	CodeHello             uint16 = 0x12
+	CodeAck               uint16 = 0x13
+)
+
+const (
+	// BroadcastFlagOnlineOnly restricts the broadcast to the users currently online
+	BroadcastFlagOnlineOnly byte = 0x01
+)
+
+// Login logs in a user on their username alone
+type Login struct {
+	Username string
+}
+
+func (f *Login) Code() uint16 { return CodeLogin }
+
+func (f *Login) Encode(w io.Writer) error {
+	return WriteString(w, f.Username)
+}
+
+func (f *Login) Decode(r io.Reader) error {
+	var err error
+	f.Username, err = ReadString(r)
+	return err
+}
+
+// Message sends a message to a user
+type Message struct {
+	Message   string
+	From      string
+	To        string
+	Timestamp time.Time
+}
+
+func (f *Message) Code() uint16 { return CodeMessage }
+
+func (f *Message) Encode(w io.Writer) error {
+	for _, field := range []string{f.Message, f.From, f.To} {
+		err := WriteString(w, field)
+		if err != nil {
+			return err
+		}
+	}
+
+	return WriteTimestamp(w, f.Timestamp)
+}
+
+func (f *Message) Decode(r io.Reader) error {
+	var err error
+
+	for _, field := range []*string{&f.Message, &f.From, &f.To} {
+		*field, err = ReadString(r)
+		if err != nil {
+			return err
+		}
+	}
+
+	f.Timestamp, err = ReadTimestamp(r)
+	return err
+}
+
+// MessageV2 is the Message of Version2, which doesn't carry the sender:
+// it's the user logged in on the connection
+type MessageV2 struct {
+	Message   string
+	To        string
+	Timestamp time.Time
+}
+
+func (f *MessageV2) Code() uint16 { return CodeMessage }
+
+func (f *MessageV2) Encode(w io.Writer) error {
+	for _, field := range []string{f.Message, f.To} {
+		err := WriteString(w, field)
+		if err != nil {
+			return err
+		}
+	}
+
+	return WriteTimestamp(w, f.Timestamp)
+}
+
+func (f *MessageV2) Decode(r io.Reader) error {
+	var err error
+
+	for _, field := range []*string{&f.Message, &f.To} {
+		*field, err = ReadString(r)
+		if err != nil {
+			return err
+		}
+	}
+
+	f.Timestamp, err = ReadTimestamp(r)
+	return err
+}
+
+// Logout logs out the user logged in on the connection, which stays open
+type Logout struct{}
+
+func (f *Logout) Code() uint16             { return CodeLogout }
+func (f *Logout) Encode(_ io.Writer) error { return nil }
+func (f *Logout) Decode(_ io.Reader) error { return nil }
+
+// MultiMessage sends a message to several users at once
+type MultiMessage struct {
+	Message   string
+	From      string
+	To        []string
+	Timestamp time.Time
+}
+
+func (f *MultiMessage) Code() uint16 { return CodeMultiMessage }
+
+func (f *MultiMessage) Encode(w io.Writer) error {
+	err := WriteString(w, f.Message)
+	if err != nil {
+		return err
+	}
+
+	err = WriteString(w, f.From)
+	if err != nil {
+		return err
+	}
+
+	err = WriteStringList(w, f.To)
+	if err != nil {
+		return err
+	}
+
+	return WriteTimestamp(w, f.Timestamp)
+}
+
+func (f *MultiMessage) Decode(r io.Reader) error {
+	var err error
+
+	f.Message, err = ReadString(r)
+	if err != nil {
+		return err
+	}
+
+	f.From, err = ReadString(r)
+	if err != nil {
+		return err
+	}
+
+	f.To, err = ReadStringList(r)
+	if err != nil {
+		return err
+	}
+
+	f.Timestamp, err = ReadTimestamp(r)
+	return err
+}
+
+// Broadcast sends a message to all the known users, except the sender
+type Broadcast struct {
+	Message string
+	From    string
+	// Flags is a combination of BroadcastFlagOnlineOnly and the future flags
+	Flags     byte
+	Timestamp time.Time
+}
+
+func (f *Broadcast) Code() uint16 { return CodeBroadcast }
+
+func (f *Broadcast) Encode(w io.Writer) error {
+	err := WriteString(w, f.Message)
+	if err != nil {
+		return err
+	}
+
+	err = WriteString(w, f.From)
+	if err != nil {
+		return err
+	}
+
+	err = WriteByte(w, f.Flags)
+	if err != nil {
+		return err
+	}
+
+	return WriteTimestamp(w, f.Timestamp)
+}
+
+func (f *Broadcast) Decode(r io.Reader) error {
+	var err error
+
+	f.Message, err = ReadString(r)
+	if err != nil {
+		return err
+	}
+
+	f.From, err = ReadString(r)
+	if err != nil {
+		return err
+	}
+
+	f.Flags, err = ReadByte(r)
+	if err != nil {
+		return err
+	}
+
+	f.Timestamp, err = ReadTimestamp(r)
+	return err
+}
+
+// CorrelationIDTest gets an OK response with the same correlationId
+type CorrelationIDTest struct{}
+
+func (f *CorrelationIDTest) Code() uint16             { return CodeCorrelationIDTest }
+func (f *CorrelationIDTest) Encode(_ io.Writer) error { return nil }
+func (f *CorrelationIDTest) Decode(_ io.Reader) error { return nil }
+
+// ListUsers asks for a page of the known users, whose response body is a ListUsersResult
+type ListUsers struct {
+	// Prefix filters the users by username
+	Prefix string
+	// Cursor is the NextCursor of the previous page, empty for the first one
+	Cursor string
+	// Limit is the maximum number of users in the page, 0 for the default one
+	Limit uint16
+}
+
+func (f *ListUsers) Code() uint16 { return CodeListUsers }
+
+func (f *ListUsers) Encode(w io.Writer) error {
+	err := WriteString(w, f.Prefix)
+	if err != nil {
+		return err
+	}
+
+	err = WriteString(w, f.Cursor)
+	if err != nil {
+		return err
+	}
+
+	return WriteUint16(w, f.Limit)
+}
+
+func (f *ListUsers) Decode(r io.Reader) error {
+	var err error
+
+	f.Prefix, err = ReadString(r)
+	if err != nil {
+		return err
+	}
+
+	f.Cursor, err = ReadString(r)
+	if err != nil {
+		return err
+	}
+
+	f.Limit, err = ReadUint16(r)
+	return err
+}
+
+// Ping checks that the other end of the connection is alive, which answers with a Pong
+// carrying the same correlationId. Both the clients and the server send it.
+type Ping struct{}
+
+func (f *Ping) Code() uint16             { return CodePing }
+func (f *Ping) Encode(_ io.Writer) error { return nil }
+func (f *Ping) Decode(_ io.Reader) error { return nil }
+
+// Pong answers a Ping. Both the clients and the server send it.
+type Pong struct{}
+
+func (f *Pong) Code() uint16             { return CodePong }
+func (f *Pong) Encode(_ io.Writer) error { return nil }
+func (f *Pong) Decode(_ io.Reader) error { return nil }
+
+// Register creates a user who logs in with LoginV2 and the given password
+type Register struct {
+	Username string
+	Password string
+}
+
+func (f *Register) Code() uint16 { return CodeRegister }
+
+func (f *Register) Encode(w io.Writer) error {
+	err := WriteString(w, f.Username)
+	if err != nil {
+		return err
+	}
+
+	return WriteString(w, f.Password)
+}
+
+func (f *Register) Decode(r io.Reader) error {
+	var err error
+
+	f.Username, err = ReadString(r)
+	if err != nil {
+		return err
+	}
+
+	f.Password, err = ReadString(r)
+	return err
+}
+
+// LoginV2 logs in a user created by Register
+type LoginV2 struct {
+	Username string
+	Password string
+}
+
+func (f *LoginV2) Code() uint16 { return CodeLoginV2 }
+
+func (f *LoginV2) Encode(w io.Writer) error {
+	err := WriteString(w, f.Username)
+	if err != nil {
+		return err
+	}
+
+	return WriteString(w, f.Password)
+}
+
+func (f *LoginV2) Decode(r io.Reader) error {
+	var err error
+
+	f.Username, err = ReadString(r)
+	if err != nil {
+		return err
+	}
+
+	f.Password, err = ReadString(r)
+	return err
+}
+
+// Resume logs the user back in on a new connection, with the token of a SessionToken.
+// LastReceived is the sequence of the last NumberedDelivery received, 0 if none:
+// the clients that don't number their deliveries can leave it out of the frame.
+type Resume struct {
+	Token        string
+	LastReceived uint64
+}
+
+func (f *Resume) Code() uint16 { return CodeResume }
+
+func (f *Resume) Encode(w io.Writer) error {
+	err := WriteString(w, f.Token)
+	if err != nil {
+		return err
+	}
+
+	return WriteUint64(w, f.LastReceived)
+}
+
+// Decode reads LastReceived only if the frame carries it: r must end with the frame
+func (f *Resume) Decode(r io.Reader) error {
+	var err error
+
+	f.Token, err = ReadString(r)
+	if err != nil {
+		return err
+	}
+
+	f.LastReceived, err = ReadUint64(r)
+	if err == io.EOF {
+		f.LastReceived, err = 0, nil
+	}
+	return err
+}
+
+// Hello negotiates the version of the protocol and the optional features of the connection.
+// Its response body is a HelloResult.
+type Hello struct {
+	Versions []byte
+	Features []string
+}
+
+func (f *Hello) Code() uint16 { return CodeHello }
+
+func (f *Hello) Encode(w io.Writer) error {
+	err := WriteBytes(w, f.Versions)
+	if err != nil {
+		return err
+	}
+
+	return WriteStringList(w, f.Features)
+}
+
+func (f *Hello) Decode(r io.Reader) error {
+	var err error
+
+	f.Versions, err = ReadBytes(r)
+	if err != nil {
+		return err
+	}
+
+	f.Features, err = ReadStringList(r)
+	return err
+}
+
+// Ack acknowledges the NumberedDelivery frames received, up to the one with the given sequence.
+// The server gets no answer to it.
+type Ack struct {
+	Sequence uint64
+}
+
+func (f *Ack) Code() uint16 { return CodeAck }
+
+func (f *Ack) Encode(w io.Writer) error {
+	return WriteUint64(w, f.Sequence)
+}
+
+func (f *Ack) Decode(r io.Reader) error {
+	var err error
+	f.Sequence, err = ReadUint64(r)
+	return err
+}
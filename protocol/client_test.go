@@ -0,0 +1,159 @@
+package protocol
+
+import (
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_ClientFrames_RoundTrip(t *testing.T) {
+	timestamp := time.Unix(1735689600, 0)
+	// timestampBytes is the encoding of timestamp
+	timestampBytes := "\x18\x16\x68\x7E\xC0\x57\x00\x00"
+
+	tests := []struct {
+		name     string
+		version  byte
+		body     Body
+		wantBody string
+	}{
+		{
+			name:     "login",
+			version:  Version1,
+			body:     &Login{Username: "TestUser"},
+			wantBody: "\x00\x08TestUser",
+		},
+		{
+			name:     "message",
+			version:  Version1,
+			body:     &Message{Message: "Hi", From: "alice", To: "bob", Timestamp: timestamp},
+			wantBody: "\x00\x02Hi\x00\x05alice\x00\x03bob" + timestampBytes,
+		},
+		{
+			name:     "message v2",
+			version:  Version2,
+			body:     &MessageV2{Message: "Hi", To: "bob", Timestamp: timestamp},
+			wantBody: "\x00\x02Hi\x00\x03bob" + timestampBytes,
+		},
+		{
+			name:     "logout",
+			version:  Version1,
+			body:     &Logout{},
+			wantBody: "",
+		},
+		{
+			name:     "multi message",
+			version:  Version1,
+			body:     &MultiMessage{Message: "Hi", From: "alice", To: []string{"bob", "carol"}, Timestamp: timestamp},
+			wantBody: "\x00\x02Hi\x00\x05alice\x00\x02\x00\x03bob\x00\x05carol" + timestampBytes,
+		},
+		{
+			name:     "broadcast",
+			version:  Version1,
+			body:     &Broadcast{Message: "Hi", From: "alice", Flags: BroadcastFlagOnlineOnly, Timestamp: timestamp},
+			wantBody: "\x00\x02Hi\x00\x05alice\x01" + timestampBytes,
+		},
+		{
+			name:     "correlationId test",
+			version:  Version1,
+			body:     &CorrelationIDTest{},
+			wantBody: "",
+		},
+		{
+			name:     "list users",
+			version:  Version1,
+			body:     &ListUsers{Prefix: "a", Cursor: "alice", Limit: 10},
+			wantBody: "\x00\x01a\x00\x05alice\x00\x0A",
+		},
+		{
+			name:     "ping",
+			version:  Version1,
+			body:     &Ping{},
+			wantBody: "",
+		},
+		{
+			name:     "pong",
+			version:  Version2,
+			body:     &Pong{},
+			wantBody: "",
+		},
+		{
+			name:     "register",
+			version:  Version1,
+			body:     &Register{Username: "alice", Password: "secret"},
+			wantBody: "\x00\x05alice\x00\x06secret",
+		},
+		{
+			name:     "login v2",
+			version:  Version1,
+			body:     &LoginV2{Username: "alice", Password: "secret"},
+			wantBody: "\x00\x05alice\x00\x06secret",
+		},
+		{
+			name:     "resume",
+			version:  Version1,
+			body:     &Resume{Token: "token", LastReceived: 3},
+			wantBody: "\x00\x05token\x00\x00\x00\x00\x00\x00\x00\x03",
+		},
+		{
+			name:     "hello",
+			version:  Version1,
+			body:     &Hello{Versions: []byte{Version1, Version2}, Features: []string{"session-tokens"}},
+			wantBody: "\x00\x02\x01\x02\x00\x01\x00\x0Esession-tokens",
+		},
+		{
+			name:     "ack",
+			version:  Version1,
+			body:     &Ack{Sequence: 0x0102},
+			wantBody: "\x00\x00\x00\x00\x00\x00\x01\x02",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			roundTrip(t, tt.version, tt.body, tt.wantBody)
+		})
+	}
+}
+
+func Test_Resume_Decode(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		want    Resume
+		wantErr error
+	}{
+		{
+			name: "with the last sequence received",
+			body: "\x00\x05token\x00\x00\x00\x00\x00\x00\x00\x03",
+			want: Resume{Token: "token", LastReceived: 3},
+		},
+		{
+			name: "without the last sequence received",
+			body: "\x00\x05token",
+			want: Resume{Token: "token"},
+		},
+		{
+			name:    "truncated last sequence received",
+			body:    "\x00\x05token\x00\x00\x00",
+			wantErr: io.ErrUnexpectedEOF,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			var got Resume
+			err := got.Decode(strings.NewReader(tt.body))
+
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
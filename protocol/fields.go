@@ -0,0 +1,156 @@
+package protocol
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"time"
+)
+
+var (
+	ErrFieldTooLong = errors.New("field too long")
+)
+
+// The numbers are written in big endian. The strings and the byte slices are prefixed by their length
+// as a uint16, the lists of strings by their count as a uint16, and the timestamps are written
+// as the number of nanoseconds since the unix epoch, as an int64.
+
+func ReadByte(r io.Reader) (byte, error) {
+	var v byte
+	err := binary.Read(r, binary.BigEndian, &v)
+	return v, err
+}
+
+func WriteByte(w io.Writer, v byte) error {
+	return binary.Write(w, binary.BigEndian, v)
+}
+
+func ReadBool(r io.Reader) (bool, error) {
+	var v bool
+	err := binary.Read(r, binary.BigEndian, &v)
+	return v, err
+}
+
+func WriteBool(w io.Writer, v bool) error {
+	return binary.Write(w, binary.BigEndian, v)
+}
+
+func ReadUint16(r io.Reader) (uint16, error) {
+	var v uint16
+	err := binary.Read(r, binary.BigEndian, &v)
+	return v, err
+}
+
+func WriteUint16(w io.Writer, v uint16) error {
+	return binary.Write(w, binary.BigEndian, v)
+}
+
+func ReadUint32(r io.Reader) (uint32, error) {
+	var v uint32
+	err := binary.Read(r, binary.BigEndian, &v)
+	return v, err
+}
+
+func WriteUint32(w io.Writer, v uint32) error {
+	return binary.Write(w, binary.BigEndian, v)
+}
+
+func ReadUint64(r io.Reader) (uint64, error) {
+	var v uint64
+	err := binary.Read(r, binary.BigEndian, &v)
+	return v, err
+}
+
+func WriteUint64(w io.Writer, v uint64) error {
+	return binary.Write(w, binary.BigEndian, v)
+}
+
+func ReadTimestamp(r io.Reader) (time.Time, error) {
+	var v int64
+	err := binary.Read(r, binary.BigEndian, &v)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(0, v), nil
+}
+
+func WriteTimestamp(w io.Writer, v time.Time) error {
+	return binary.Write(w, binary.BigEndian, v.UnixNano())
+}
+
+func ReadBytes(r io.Reader) ([]byte, error) {
+	length, err := ReadUint16(r)
+	if err != nil {
+		return nil, err
+	}
+
+	v := make([]byte, length)
+	_, err = io.ReadFull(r, v)
+	if err != nil {
+		return nil, err
+	}
+
+	return v, nil
+}
+
+func WriteBytes(w io.Writer, v []byte) error {
+	if len(v) > math.MaxUint16 {
+		return ErrFieldTooLong
+	}
+
+	err := WriteUint16(w, uint16(len(v)))
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(v)
+	return err
+}
+
+func ReadString(r io.Reader) (string, error) {
+	v, err := ReadBytes(r)
+	return string(v), err
+}
+
+func WriteString(w io.Writer, v string) error {
+	return WriteBytes(w, []byte(v))
+}
+
+func ReadStringList(r io.Reader) ([]string, error) {
+	count, err := ReadUint16(r)
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]string, 0, count)
+	for range count {
+		v, sErr := ReadString(r)
+		if sErr != nil {
+			return nil, sErr
+		}
+		list = append(list, v)
+	}
+
+	return list, nil
+}
+
+func WriteStringList(w io.Writer, list []string) error {
+	if len(list) > math.MaxUint16 {
+		return ErrFieldTooLong
+	}
+
+	err := WriteUint16(w, uint16(len(list)))
+	if err != nil {
+		return err
+	}
+
+	for _, v := range list {
+		err = WriteString(w, v)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
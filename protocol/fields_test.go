@@ -0,0 +1,120 @@
+package protocol
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Fields_RoundTrip(t *testing.T) {
+	timestamp := time.Unix(1735689600, 0)
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteByte(&buf, 0x01))
+	require.NoError(t, WriteBool(&buf, true))
+	require.NoError(t, WriteUint16(&buf, 0x0203))
+	require.NoError(t, WriteUint32(&buf, 0x04050607))
+	require.NoError(t, WriteUint64(&buf, 0x08090A0B0C0D0E0F))
+	require.NoError(t, WriteTimestamp(&buf, timestamp))
+	require.NoError(t, WriteBytes(&buf, []byte{0xFF}))
+	require.NoError(t, WriteString(&buf, "str"))
+	require.NoError(t, WriteStringList(&buf, []string{"a", "bc"}))
+
+	assert.Equal(t, "\x01\x01\x02\x03\x04\x05\x06\x07\x08\x09\x0A\x0B\x0C\x0D\x0E\x0F"+
+		"\x18\x16\x68\x7E\xC0\x57\x00\x00\x00\x01\xFF\x00\x03str\x00\x02\x00\x01a\x00\x02bc", buf.String())
+
+	b, err := ReadByte(&buf)
+	assert.Equal(t, byte(0x01), b)
+	assert.NoError(t, err)
+	bo, err := ReadBool(&buf)
+	assert.True(t, bo)
+	assert.NoError(t, err)
+	u16, err := ReadUint16(&buf)
+	assert.Equal(t, uint16(0x0203), u16)
+	assert.NoError(t, err)
+	u32, err := ReadUint32(&buf)
+	assert.Equal(t, uint32(0x04050607), u32)
+	assert.NoError(t, err)
+	u64, err := ReadUint64(&buf)
+	assert.Equal(t, uint64(0x08090A0B0C0D0E0F), u64)
+	assert.NoError(t, err)
+	ts, err := ReadTimestamp(&buf)
+	assert.Equal(t, timestamp, ts)
+	assert.NoError(t, err)
+	bs, err := ReadBytes(&buf)
+	assert.Equal(t, []byte{0xFF}, bs)
+	assert.NoError(t, err)
+	s, err := ReadString(&buf)
+	assert.Equal(t, "str", s)
+	assert.NoError(t, err)
+	list, err := ReadStringList(&buf)
+	assert.Equal(t, []string{"a", "bc"}, list)
+	assert.NoError(t, err)
+
+	assert.Zero(t, buf.Len())
+}
+
+func Test_ReadString(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    string
+		wantErr error
+	}{
+		{
+			name:    "happy path: empty string",
+			input:   "\x00\x00",
+			want:    "",
+			wantErr: nil,
+		},
+		{
+			name:    "error: nothing to read",
+			input:   "",
+			wantErr: io.EOF,
+		},
+		{
+			name:    "error: length field too short",
+			input:   "\x00",
+			wantErr: io.ErrUnexpectedEOF,
+		},
+		{
+			name:    "error: string shorter than its length",
+			input:   "\x00\x08short",
+			wantErr: io.ErrUnexpectedEOF,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			got, err := ReadString(strings.NewReader(tt.input))
+
+			assert.Equal(t, tt.want, got)
+			assert.Equal(t, tt.wantErr, err)
+		})
+	}
+}
+
+func Test_WriteString_TooLong(t *testing.T) {
+
+	var buf bytes.Buffer
+
+	err := WriteString(&buf, strings.Repeat("x", 0x10000))
+
+	assert.Equal(t, ErrFieldTooLong, err)
+	assert.Zero(t, buf.Len())
+}
+
+func Test_WriteStringList_TooLong(t *testing.T) {
+
+	var buf bytes.Buffer
+
+	err := WriteStringList(&buf, make([]string, 0x10000))
+
+	assert.Equal(t, ErrFieldTooLong, err)
+	assert.Zero(t, buf.Len())
+}
@@ -0,0 +1,198 @@
+package protocol
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+)
+
+const (
+	// Version1 is the version of the original protocol, spoken by the clients that don't negotiate one
+	Version1 byte = 0x01
+	// Version2 is the same as Version1, except for Message, which doesn't carry the sender (see MessageV2)
+	Version2 byte = 0x02
+)
+
+// HeaderLength is the size of the header at the beginning of each frame, after its length
+const HeaderLength uint32 = 7
+
+var (
+	ErrUnknownFrame  = errors.New("unknown frame")
+	ErrFrameTooLarge = errors.New("frame too large")
+)
+
+// Header is written at the beginning of each frame, after its length
+type Header struct {
+	Version       byte
+	Code          uint16
+	CorrelationID uint32
+}
+
+func (h *Header) Encode(w io.Writer) error {
+	err := WriteByte(w, h.Version)
+	if err != nil {
+		return err
+	}
+
+	err = WriteUint16(w, h.Code)
+	if err != nil {
+		return err
+	}
+
+	return WriteUint32(w, h.CorrelationID)
+}
+
+func (h *Header) Decode(r io.Reader) error {
+	var err error
+
+	h.Version, err = ReadByte(r)
+	if err != nil {
+		return err
+	}
+
+	h.Code, err = ReadUint16(r)
+	if err != nil {
+		return err
+	}
+
+	h.CorrelationID, err = ReadUint32(r)
+	return err
+}
+
+// Body is the content of a frame, after its header
+type Body interface {
+	// Code is the code written in the header of the frame
+	Code() uint16
+	Encode(w io.Writer) error
+	Decode(r io.Reader) error
+}
+
+// WriteFrame writes the body as a whole frame: its length, its header and itself
+func WriteFrame(w io.Writer, version byte, correlationID uint32, body Body) error {
+
+	// the frame is built in memory first, since its length must be written before it
+	var frame bytes.Buffer
+
+	header := Header{Version: version, Code: body.Code(), CorrelationID: correlationID}
+	err := header.Encode(&frame)
+	if err != nil {
+		return err
+	}
+
+	err = body.Encode(&frame)
+	if err != nil {
+		return err
+	}
+
+	err = WriteUint32(w, uint32(frame.Len()))
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(frame.Bytes())
+	return err
+}
+
+// ReadFrame reads the next frame, refusing the ones longer than maxSize (not counting their length)
+func ReadFrame(r io.Reader, maxSize uint32) (Header, Body, error) {
+
+	length, err := ReadUint32(r)
+	if err != nil {
+		return Header{}, nil, err
+	}
+	if length > maxSize {
+		return Header{}, nil, fmt.Errorf("%w: %d bytes, the maximum is %d", ErrFrameTooLarge, length, maxSize)
+	}
+
+	frame := make([]byte, length)
+	_, err = io.ReadFull(r, frame)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return Header{}, nil, err
+	}
+
+	return DecodeFrame(frame)
+}
+
+// DecodeFrame decodes a frame read as a whole, without its length
+func DecodeFrame(frame []byte) (Header, Body, error) {
+
+	r := bytes.NewReader(frame)
+
+	var header Header
+	err := header.Decode(r)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return Header{}, nil, err
+	}
+
+	body, err := NewBody(header.Version, header.Code)
+	if err != nil {
+		return header, nil, err
+	}
+
+	err = body.Decode(r)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return header, nil, err
+	}
+
+	return header, body, nil
+}
+
+// bodies creates an empty body for each frame code, for each version.
+// Ping and Pong are sent in both directions; the other codes are specific to one of them.
+var bodies = map[byte]map[uint16]func() Body{
+	Version1: v1Bodies,
+	Version2: v2Bodies(),
+}
+
+var v1Bodies = map[uint16]func() Body{
+	CodeLogin:             func() Body { return &Login{} },
+	CodeMessage:           func() Body { return &Message{} },
+	CodeResponse:          func() Body { return &Response{} },
+	CodeDelivery:          func() Body { return &Delivery{} },
+	CodeReplayDone:        func() Body { return &ReplayDone{} },
+	CodeLogout:            func() Body { return &Logout{} },
+	CodeMultiMessage:      func() Body { return &MultiMessage{} },
+	CodeBroadcast:         func() Body { return &Broadcast{} },
+	CodeCorrelationIDTest: func() Body { return &CorrelationIDTest{} },
+	CodeListUsers:         func() Body { return &ListUsers{} },
+	CodeGoingAway:         func() Body { return &GoingAway{} },
+	CodePing:              func() Body { return &Ping{} },
+	CodePong:              func() Body { return &Pong{} },
+	CodeRegister:          func() Body { return &Register{} },
+	CodeLoginV2:           func() Body { return &LoginV2{} },
+	CodeSessionToken:      func() Body { return &SessionToken{} },
+	CodeResume:            func() Body { return &Resume{} },
+	CodeHello:             func() Body { return &Hello{} },
+	CodeAck:               func() Body { return &Ack{} },
+	CodeNumberedDelivery:  func() Body { return &NumberedDelivery{} },
+}
+
+func v2Bodies() map[uint16]func() Body {
+	v2 := maps.Clone(v1Bodies)
+
+	v2[CodeMessage] = func() Body { return &MessageV2{} }
+
+	return v2
+}
+
+// NewBody returns an empty body for the frames with the given version and code, ready to be decoded
+func NewBody(version byte, code uint16) (Body, error) {
+
+	newBody, ok := bodies[version][code]
+	if !ok {
+		return nil, fmt.Errorf("%w: version 0x%02X, code 0x%02X", ErrUnknownFrame, version, code)
+	}
+
+	return newBody(), nil
+}
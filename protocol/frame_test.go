@@ -0,0 +1,128 @@
+package protocol
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// roundTrip writes the body as a frame, checks that its encoding after the header is wantBody,
+// then reads it back and checks that it decodes to the same body
+func roundTrip(t *testing.T, version byte, body Body, wantBody string) {
+	t.Helper()
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteFrame(&buf, version, 7, body))
+
+	frame := buf.Bytes()
+	require.GreaterOrEqual(t, len(frame), 4+int(HeaderLength))
+	assert.Equal(t, wantBody, string(frame[4+HeaderLength:]))
+
+	header, decoded, err := ReadFrame(&buf, 0x1000)
+	require.NoError(t, err)
+
+	assert.Equal(t, Header{Version: version, Code: body.Code(), CorrelationID: 7}, header)
+	assert.Equal(t, body, decoded)
+	assert.Zero(t, buf.Len())
+}
+
+func Test_WriteFrame(t *testing.T) {
+
+	var buf bytes.Buffer
+
+	err := WriteFrame(&buf, Version1, 0x01020304, &Login{Username: "TestUser"})
+
+	assert.Equal(t, "\x00\x00\x00\x11\x01\x00\x01\x01\x02\x03\x04\x00\x08TestUser", buf.String())
+	assert.NoError(t, err)
+}
+
+func Test_ReadFrame(t *testing.T) {
+	tests := []struct {
+		name       string
+		input      string
+		maxSize    uint32
+		wantHeader Header
+		wantBody   Body
+		wantErr    string
+	}{
+		{
+			name:       "happy path: login",
+			input:      "\x00\x00\x00\x11\x01\x00\x01\x00\x00\x00\x01\x00\x08TestUser",
+			maxSize:    0x100,
+			wantHeader: Header{Version: Version1, Code: CodeLogin, CorrelationID: 1},
+			wantBody:   &Login{Username: "TestUser"},
+		},
+		{
+			name:    "error: nothing to read",
+			input:   "",
+			maxSize: 0x100,
+			wantErr: io.EOF.Error(),
+		},
+		{
+			name:    "error: frame too large",
+			input:   "\x00\x00\x01\x01\x01",
+			maxSize: 0x100,
+			wantErr: "frame too large: 257 bytes, the maximum is 256",
+		},
+		{
+			name:    "error: truncated frame",
+			input:   "\x00\x00\x00\x11\x01\x00\x01",
+			maxSize: 0x100,
+			wantErr: io.ErrUnexpectedEOF.Error(),
+		},
+		{
+			name:       "error: body shorter than its fields",
+			input:      "\x00\x00\x00\x0A\x01\x00\x01\x00\x00\x00\x01\x00\x08T",
+			maxSize:    0x100,
+			wantHeader: Header{Version: Version1, Code: CodeLogin, CorrelationID: 1},
+			wantErr:    io.ErrUnexpectedEOF.Error(),
+		},
+		{
+			name:       "error: unknown code",
+			input:      "\x00\x00\x00\x07\x01\x00\x99\x00\x00\x00\x01",
+			maxSize:    0x100,
+			wantHeader: Header{Version: Version1, Code: 0x99, CorrelationID: 1},
+			wantErr:    "unknown frame: version 0x01, code 0x99",
+		},
+		{
+			name:       "error: unknown version",
+			input:      "\x00\x00\x00\x07\x07\x00\x01\x00\x00\x00\x01",
+			maxSize:    0x100,
+			wantHeader: Header{Version: 0x07, Code: CodeLogin, CorrelationID: 1},
+			wantErr:    "unknown frame: version 0x07, code 0x01",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			header, body, err := ReadFrame(bytes.NewBufferString(tt.input), tt.maxSize)
+
+			assert.Equal(t, tt.wantHeader, header)
+			assert.Equal(t, tt.wantBody, body)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func Test_NewBody(t *testing.T) {
+
+	v1, err := NewBody(Version1, CodeMessage)
+	require.NoError(t, err)
+	v2, err := NewBody(Version2, CodeMessage)
+	require.NoError(t, err)
+
+	// the other frames are the same in both versions
+	ping, err := NewBody(Version2, CodePing)
+	require.NoError(t, err)
+
+	assert.IsType(t, &Message{}, v1)
+	assert.IsType(t, &MessageV2{}, v2)
+	assert.IsType(t, &Ping{}, ping)
+}
@@ -0,0 +1,134 @@
+package protocol
+
+import (
+	"io"
+	"math"
+)
+
+// The results are the bodies following the status in the responses to some frames
+
+// MultiMessageResult is the body of the response to MultiMessage
+type MultiMessageResult struct {
+	// Unreached lists the recipients who didn't get the message
+	Unreached []string
+}
+
+func (r *MultiMessageResult) Encode(w io.Writer) error {
+	return WriteStringList(w, r.Unreached)
+}
+
+func (r *MultiMessageResult) Decode(rd io.Reader) error {
+	var err error
+	r.Unreached, err = ReadStringList(rd)
+	return err
+}
+
+// BroadcastResult is the body of the response to Broadcast
+type BroadcastResult struct {
+	// Sent is the number of users the message has been sent to
+	Sent uint32
+}
+
+func (r *BroadcastResult) Encode(w io.Writer) error {
+	return WriteUint32(w, r.Sent)
+}
+
+func (r *BroadcastResult) Decode(rd io.Reader) error {
+	var err error
+	r.Sent, err = ReadUint32(rd)
+	return err
+}
+
+// UserStatus is a user listed in a ListUsersResult
+type UserStatus struct {
+	Username string
+	Online   bool
+}
+
+// ListUsersResult is the body of the response to ListUsers
+type ListUsersResult struct {
+	Users []UserStatus
+	// NextCursor is the Cursor of the next page, empty on the last page
+	NextCursor string
+}
+
+func (r *ListUsersResult) Encode(w io.Writer) error {
+	if len(r.Users) > math.MaxUint16 {
+		return ErrFieldTooLong
+	}
+
+	err := WriteUint16(w, uint16(len(r.Users)))
+	if err != nil {
+		return err
+	}
+
+	for _, user := range r.Users {
+		err = WriteString(w, user.Username)
+		if err != nil {
+			return err
+		}
+
+		err = WriteBool(w, user.Online)
+		if err != nil {
+			return err
+		}
+	}
+
+	return WriteString(w, r.NextCursor)
+}
+
+func (r *ListUsersResult) Decode(rd io.Reader) error {
+	count, err := ReadUint16(rd)
+	if err != nil {
+		return err
+	}
+
+	r.Users = make([]UserStatus, 0, count)
+	for range count {
+		var user UserStatus
+
+		user.Username, err = ReadString(rd)
+		if err != nil {
+			return err
+		}
+
+		user.Online, err = ReadBool(rd)
+		if err != nil {
+			return err
+		}
+
+		r.Users = append(r.Users, user)
+	}
+
+	r.NextCursor, err = ReadString(rd)
+	return err
+}
+
+// HelloResult is the body of the response to Hello
+type HelloResult struct {
+	// Version is the version chosen by the server
+	Version byte
+	// Features lists the features enabled, among the ones asked by the client
+	Features []string
+}
+
+func (r *HelloResult) Encode(w io.Writer) error {
+	err := WriteByte(w, r.Version)
+	if err != nil {
+		return err
+	}
+
+	return WriteStringList(w, r.Features)
+}
+
+func (r *HelloResult) Decode(rd io.Reader) error {
+	var err error
+
+	r.Version, err = ReadByte(rd)
+	if err != nil {
+		return err
+	}
+
+	r.Features, err = ReadStringList(rd)
+	return err
+}
@@ -0,0 +1,83 @@
+package protocol
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// result is implemented by the bodies of the responses
+type result interface {
+	Encode(w io.Writer) error
+	Decode(rd io.Reader) error
+}
+
+func Test_Results_RoundTrip(t *testing.T) {
+	tests := []struct {
+		name      string
+		result    result
+		newResult func() result
+		want      string
+	}{
+		{
+			name:      "multi message",
+			result:    &MultiMessageResult{Unreached: []string{"bob"}},
+			newResult: func() result { return &MultiMessageResult{} },
+			want:      "\x00\x01\x00\x03bob",
+		},
+		{
+			name:      "broadcast",
+			result:    &BroadcastResult{Sent: 2},
+			newResult: func() result { return &BroadcastResult{} },
+			want:      "\x00\x00\x00\x02",
+		},
+		{
+			name: "list users",
+			result: &ListUsersResult{
+				Users:      []UserStatus{{Username: "alice", Online: true}, {Username: "bob", Online: false}},
+				NextCursor: "bob",
+			},
+			newResult: func() result { return &ListUsersResult{} },
+			want:      "\x00\x02\x00\x05alice\x01\x00\x03bob\x00\x00\x03bob",
+		},
+		{
+			name:      "list users: last empty page",
+			result:    &ListUsersResult{Users: []UserStatus{}},
+			newResult: func() result { return &ListUsersResult{} },
+			want:      "\x00\x00\x00\x00",
+		},
+		{
+			name:      "hello",
+			result:    &HelloResult{Version: Version2, Features: []string{}},
+			newResult: func() result { return &HelloResult{} },
+			want:      "\x02\x00\x00",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			var buf bytes.Buffer
+			require.NoError(t, tt.result.Encode(&buf))
+			assert.Equal(t, tt.want, buf.String())
+
+			decoded := tt.newResult()
+			err := decoded.Decode(&buf)
+
+			assert.Equal(t, tt.result, decoded)
+			assert.NoError(t, err)
+			assert.Zero(t, buf.Len())
+		})
+	}
+}
+
+func Test_ListUsersResult_Decode_Truncated(t *testing.T) {
+
+	var result ListUsersResult
+
+	err := result.Decode(bytes.NewBufferString("\x00\x02\x00\x05alice\x01"))
+
+	assert.Equal(t, io.EOF, err)
+}
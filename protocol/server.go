@@ -0,0 +1,168 @@
+package protocol
+
+import (
+	"io"
+	"time"
+)
+
+// The codes of the frames sent by the server, besides Ping and Pong
+const (
+	CodeResponse         uint16 = 0x03
+	CodeDelivery         uint16 = 0x04
+	CodeReplayDone       uint16 = 0x05
+	CodeGoingAway        uint16 = 0x0B
+	CodeSessionToken     uint16 = 0x10
+	CodeNumberedDelivery uint16 = 0x14
+)
+
+// Response answers a client frame, carrying its correlationId.
+// Some frames get a body after the status: its content depends on the frame answered,
+// e.g. ListUsersResult for ListUsers.
+type Response struct {
+	Status uint16
+	Body   []byte
+}
+
+func (f *Response) Code() uint16 { return CodeResponse }
+
+func (f *Response) Encode(w io.Writer) error {
+	err := WriteUint16(w, f.Status)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(f.Body)
+	return err
+}
+
+// Decode reads the status and keeps the rest of the frame as the body: r must end with the frame
+func (f *Response) Decode(r io.Reader) error {
+	var err error
+
+	f.Status, err = ReadUint16(r)
+	if err != nil {
+		return err
+	}
+
+	f.Body, err = io.ReadAll(r)
+	return err
+}
+
+// Delivery pushes a message to its recipient. Its correlationId is always 0.
+type Delivery struct {
+	Message   string
+	From      string
+	To        string
+	Timestamp time.Time
+}
+
+func (f *Delivery) Code() uint16 { return CodeDelivery }
+
+func (f *Delivery) Encode(w io.Writer) error {
+	for _, field := range []string{f.Message, f.From, f.To} {
+		err := WriteString(w, field)
+		if err != nil {
+			return err
+		}
+	}
+
+	return WriteTimestamp(w, f.Timestamp)
+}
+
+func (f *Delivery) Decode(r io.Reader) error {
+	var err error
+
+	for _, field := range []*string{&f.Message, &f.From, &f.To} {
+		*field, err = ReadString(r)
+		if err != nil {
+			return err
+		}
+	}
+
+	f.Timestamp, err = ReadTimestamp(r)
+	return err
+}
+
+// NumberedDelivery replaces Delivery on the connections that enabled the acknowledgements of the deliveries.
+// Its sequence numbers the deliveries of the mailbox of the recipient: the message is delivered again
+// until an Ack, or a Resume, carries its sequence or a later one. Its correlationId is always 0.
+type NumberedDelivery struct {
+	Sequence uint64
+	Delivery
+}
+
+func (f *NumberedDelivery) Code() uint16 { return CodeNumberedDelivery }
+
+func (f *NumberedDelivery) Encode(w io.Writer) error {
+	err := WriteUint64(w, f.Sequence)
+	if err != nil {
+		return err
+	}
+
+	return f.Delivery.Encode(w)
+}
+
+func (f *NumberedDelivery) Decode(r io.Reader) error {
+	var err error
+
+	f.Sequence, err = ReadUint64(r)
+	if err != nil {
+		return err
+	}
+
+	return f.Delivery.Decode(r)
+}
+
+// ReplayDone follows the messages received while the user was offline, delivered after their login
+type ReplayDone struct {
+	Count uint32
+}
+
+func (f *ReplayDone) Code() uint16 { return CodeReplayDone }
+
+func (f *ReplayDone) Encode(w io.Writer) error {
+	return WriteUint32(w, f.Count)
+}
+
+func (f *ReplayDone) Decode(r io.Reader) error {
+	var err error
+	f.Count, err = ReadUint32(r)
+	return err
+}
+
+// GoingAway tells that the server is shutting down, and will close the connection
+type GoingAway struct{}
+
+func (f *GoingAway) Code() uint16             { return CodeGoingAway }
+func (f *GoingAway) Encode(_ io.Writer) error { return nil }
+func (f *GoingAway) Decode(_ io.Reader) error { return nil }
+
+// SessionToken follows the response to a successful login, carrying its correlationId.
+// Its token resumes the session with Resume if the connection drops.
+type SessionToken struct {
+	Token     string
+	ExpiresAt time.Time
+}
+
+func (f *SessionToken) Code() uint16 { return CodeSessionToken }
+
+func (f *SessionToken) Encode(w io.Writer) error {
+	err := WriteString(w, f.Token)
+	if err != nil {
+		return err
+	}
+
+	return WriteTimestamp(w, f.ExpiresAt)
+}
+
+func (f *SessionToken) Decode(r io.Reader) error {
+	var err error
+
+	f.Token, err = ReadString(r)
+	if err != nil {
+		return err
+	}
+
+	f.ExpiresAt, err = ReadTimestamp(r)
+	return err
+}
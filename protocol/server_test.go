@@ -0,0 +1,62 @@
+package protocol
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_ServerFrames_RoundTrip(t *testing.T) {
+	timestamp := time.Unix(1735689600, 0)
+	// timestampBytes is the encoding of timestamp
+	timestampBytes := "\x18\x16\x68\x7E\xC0\x57\x00\x00"
+
+	tests := []struct {
+		name     string
+		body     Body
+		wantBody string
+	}{
+		{
+			name:     "response",
+			body:     &Response{Status: StatusOK, Body: []byte{}},
+			wantBody: "\x00\x01",
+		},
+		{
+			name:     "response with a body",
+			body:     &Response{Status: StatusPartialSuccess, Body: []byte("\x00\x01\x00\x03bob")},
+			wantBody: "\x00\x08\x00\x01\x00\x03bob",
+		},
+		{
+			name:     "delivery",
+			body:     &Delivery{Message: "Hi", From: "alice", To: "bob", Timestamp: timestamp},
+			wantBody: "\x00\x02Hi\x00\x05alice\x00\x03bob" + timestampBytes,
+		},
+		{
+			name: "numbered delivery",
+			body: &NumberedDelivery{
+				Sequence: 3,
+				Delivery: Delivery{Message: "Hi", From: "alice", To: "bob", Timestamp: timestamp},
+			},
+			wantBody: "\x00\x00\x00\x00\x00\x00\x00\x03\x00\x02Hi\x00\x05alice\x00\x03bob" + timestampBytes,
+		},
+		{
+			name:     "replay done",
+			body:     &ReplayDone{Count: 3},
+			wantBody: "\x00\x00\x00\x03",
+		},
+		{
+			name:     "going away",
+			body:     &GoingAway{},
+			wantBody: "",
+		},
+		{
+			name:     "session token",
+			body:     &SessionToken{Token: "token", ExpiresAt: timestamp},
+			wantBody: "\x00\x05token" + timestampBytes,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			roundTrip(t, Version1, tt.body, tt.wantBody)
+		})
+	}
+}
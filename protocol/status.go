@@ -0,0 +1,56 @@
+package protocol
+
+import "fmt"
+
+// The status codes of the responses
+const (
+	StatusOK                 uint16 = 0x01
+	StatusUserNotFound       uint16 = 0x03
+	StatusUserAlreadyLogged  uint16 = 0x04
+	StatusUnknownCommand     uint16 = 0x05
+	StatusMalformedCommand   uint16 = 0x06
+	StatusInternalError      uint16 = 0x07
+	StatusPartialSuccess     uint16 = 0x08
+	StatusFrameTooLarge      uint16 = 0x09
+	StatusFieldTooLong       uint16 = 0x0A
+	StatusTruncatedFrame     uint16 = 0x0B
+	StatusForbidden          uint16 = 0x0C
+	StatusNotAllowed         uint16 = 0x0D
+	StatusMailboxFull        uint16 = 0x0E
+	StatusBadCredentials     uint16 = 0x0F
+	StatusUsernameTaken      uint16 = 0x10
+	StatusInvalidToken       uint16 = 0x11
+	StatusUnsupportedVersion uint16 = 0x12
+)
+
+// statusNames names the status codes where a number is not readable enough, e.g. in the metrics
+var statusNames = map[uint16]string{
+	StatusOK:                 "ok",
+	StatusUserNotFound:       "user_not_found",
+	StatusUserAlreadyLogged:  "user_already_logged",
+	StatusUnknownCommand:     "unknown_command",
+	StatusMalformedCommand:   "malformed_command",
+	StatusInternalError:      "internal_error",
+	StatusPartialSuccess:     "partial_success",
+	StatusFrameTooLarge:      "frame_too_large",
+	StatusFieldTooLong:       "field_too_long",
+	StatusTruncatedFrame:     "truncated_frame",
+	StatusForbidden:          "forbidden",
+	StatusNotAllowed:         "not_allowed",
+	StatusMailboxFull:        "mailbox_full",
+	StatusBadCredentials:     "bad_credentials",
+	StatusUsernameTaken:      "username_taken",
+	StatusInvalidToken:       "invalid_token",
+	StatusUnsupportedVersion: "unsupported_version",
+}
+
+// StatusName returns the name of the status code, or its hex value if it has none
+func StatusName(statusCode uint16) string {
+
+	name, ok := statusNames[statusCode]
+	if !ok {
+		return fmt.Sprintf("0x%02X", statusCode)
+	}
+
+	return name
+}
@@ -0,0 +1,36 @@
+package protocol
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_StatusName(t *testing.T) {
+	tests := []struct {
+		name       string
+		statusCode uint16
+		want       string
+	}{
+		{
+			name:       "ok",
+			statusCode: StatusOK,
+			want:       "ok",
+		},
+		{
+			name:       "unsupported version",
+			statusCode: StatusUnsupportedVersion,
+			want:       "unsupported_version",
+		},
+		{
+			name:       "unknown status code",
+			statusCode: 0xAB,
+			want:       "0xAB",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, StatusName(tt.statusCode))
+		})
+	}
+}
@@ -1,73 +1,457 @@
 package main
 
 import (
-	"fmt"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"errors"
 	"io"
-	"log"
+	"log/slog"
+	"maps"
 	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
 	"tcpserver/commands"
+	"tcpserver/config"
 	"tcpserver/state"
+	"tcpserver/storage"
+	"tcpserver/tlsconfig"
+	"time"
 )
 
+var (
+	ErrServerClosed = errors.New("server closed")
+)
+
+var overflowPolicies = map[string]state.OverflowPolicy{
+	config.MailboxOverflowPolicyReject:     state.OverflowReject,
+	config.MailboxOverflowPolicyDropOldest: state.OverflowDropOldest,
+	config.MailboxOverflowPolicySpill:      state.OverflowSpill,
+}
+
 type Server struct {
-	port  int
-	state *state.State
+	cfg     *config.Config
+	state   *state.State
+	logger  *slog.Logger
+	metrics *serverMetrics
+	// tls is nil unless the connections are served over TLS
+	tls *tlsconfig.Reloader
+
+	// lastConnID numbers the connections, to tell them apart in the logs
+	lastConnID atomic.Uint64
+
+	mutex    sync.Mutex
+	listener net.Listener
+	// metricsServer is nil unless cfg.MetricsAddress is set
+	metricsServer *http.Server
+	conns         map[net.Conn]*connection
+	handlers      sync.WaitGroup
+	shuttingDown  bool
+}
+
+// connection is a client connection being handled: its session and the writer of its frames
+// are tracked by the server, so that Shutdown can reach them
+type connection struct {
+	session *commands.Session
+	out     *frameWriter
 }
 
-func NewServer(port int) *Server {
-	return &Server{
-		port:  port,
-		state: state.NewState(),
+// NewServer creates a server with the given config, logging with the given logger.
+// The users and their undelivered messages are persisted in cfg.DataDir,
+// unless it's empty: in that case, they live in memory only.
+// The connections are served over TLS when cfg.TLSCertFile is set.
+func NewServer(cfg *config.Config, logger *slog.Logger) (*Server, error) {
+
+	tokens, err := sessionTokenOptions(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	var tlsReloader *tlsconfig.Reloader
+	if cfg.TLSCertFile != "" {
+		tlsReloader, err = tlsconfig.NewReloader(tlsconfig.Options{
+			CertFile:     cfg.TLSCertFile,
+			KeyFile:      cfg.TLSKeyFile,
+			ClientCAFile: cfg.TLSClientCAFile,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	opts := state.MailboxOptions{
+		Size:           cfg.MailboxSize,
+		OverflowPolicy: overflowPolicies[cfg.MailboxOverflowPolicy],
+	}
+
+	if cfg.DataDir == "" {
+		return newServer(cfg, state.NewStateWithMailboxOptions(opts), tlsReloader, tokens, logger), nil
+	}
+
+	store, err := storage.OpenFileStore(cfg.DataDir, cfg.CompactionInterval)
+	if err != nil {
+		return nil, err
 	}
+
+	st, err := state.NewStateWithStore(store, opts)
+	if err != nil {
+		return nil, errors.Join(err, store.Close())
+	}
+
+	return newServer(cfg, st, tlsReloader, tokens, logger), nil
 }
 
-func (s *Server) Start() {
+// newServer creates the server around the given state, enabling its session tokens unless tokens is nil
+func newServer(
+	cfg *config.Config,
+	st *state.State,
+	tlsReloader *tlsconfig.Reloader,
+	tokens *state.TokenOptions,
+	logger *slog.Logger,
+) *Server {
+
+	if tokens != nil {
+		st.EnableTokens(*tokens)
+	}
+
+	s := &Server{
+		cfg:    cfg,
+		state:  st,
+		logger: logger,
+		tls:    tlsReloader,
+		conns:  map[net.Conn]*connection{},
+	}
+	s.metrics = newServerMetrics(s)
+	return s
+}
 
-	// Start listening on the specified port
-	ln, err := net.Listen("tcp", fmt.Sprintf(":%d", s.port))
+// sessionTokenOptions returns the options of the session tokens, or nil if they are disabled.
+// Without a configured key, a random one gets generated.
+func sessionTokenOptions(cfg *config.Config) (*state.TokenOptions, error) {
+
+	if cfg.SessionResumeGrace == 0 {
+		return nil, nil
+	}
+
+	key := []byte(cfg.SessionTokenKey)
+	if len(key) == 0 {
+		key = make([]byte, 32)
+		_, err := rand.Read(key)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &state.TokenOptions{
+		Key:   key,
+		TTL:   cfg.SessionTokenTTL,
+		Grace: cfg.SessionResumeGrace,
+	}, nil
+}
+
+// Start accepts the incoming connections until the server gets shut down,
+// in which case it returns ErrServerClosed
+func (s *Server) Start() error {
+
+	// Start listening on the specified address
+	ln, err := net.Listen("tcp", s.cfg.ListenAddress)
 	if err != nil {
-		log.Fatal(err)
+		return err
+	}
+	if s.tls != nil {
+		ln = tls.NewListener(ln, s.tls.Config())
 	}
-	defer ln.Close()
 
-	fmt.Println("Server ready for incoming connections...")
+	s.mutex.Lock()
+	if s.shuttingDown {
+		s.mutex.Unlock()
+		ln.Close()
+		return ErrServerClosed
+	}
+	s.listener = ln
+	s.mutex.Unlock()
+
+	if s.cfg.MetricsAddress != "" {
+		err = s.serveMetrics()
+		if err != nil {
+			ln.Close()
+			return err
+		}
+	}
+
+	s.logger.Info("server ready for incoming connections", "address", ln.Addr().String(), "tls", s.tls != nil)
 	for {
 		conn, err := ln.Accept()
+		if err != nil && s.isShuttingDown() {
+			return ErrServerClosed
+		}
 		if err != nil {
-			log.Fatal(err)
+			ln.Close()
+			return err
+		}
+
+		c, ok := s.track(conn)
+		if !ok {
+			conn.Close()
+			continue
 		}
 
 		// Accept incoming connections (in async, so that we can accept many)
-		go s.handleConnection(conn)
+		go s.handleConnection(conn, c)
 	}
 }
 
-func (s *Server) handleConnection(conn net.Conn) {
+// Shutdown stops accepting new connections, tells the connected clients that
+// the server is going away and waits for the commands being processed to complete,
+// before closing the connections and flushing the persisted state.
+// If the context expires first, the connections get closed right away.
+func (s *Server) Shutdown(ctx context.Context) error {
+
+	s.mutex.Lock()
+	s.shuttingDown = true
+	if s.listener != nil {
+		s.listener.Close()
+	}
+	conns := maps.Clone(s.conns)
+	s.mutex.Unlock()
+
+	// a client not reading from the socket must not block the shutdown,
+	// so the connections get notified concurrently
+	for conn, c := range conns {
+		go func() {
+			// the commands read from now on get refused, while the one in progress completes
+			c.session.Close()
+
+			err := c.out.WriteFrame(commands.NewGoingAway())
+			if err != nil {
+				s.logger.Warn("notifying shutdown to client", "remote_addr", conn.RemoteAddr().String(), "error", err)
+			}
+
+			// unblock the handler waiting for the next command,
+			// while letting the one in progress complete
+			s.mutex.Lock()
+			conn.SetReadDeadline(time.Now())
+			s.mutex.Unlock()
+		}()
+	}
+
+	handlersDone := make(chan struct{})
+	go func() {
+		s.handlers.Wait()
+		close(handlersDone)
+	}()
+
+	var ctxErr error
+	select {
+	case <-handlersDone:
+	case <-ctx.Done():
+		ctxErr = ctx.Err()
+
+		s.mutex.Lock()
+		for conn := range s.conns {
+			conn.Close()
+		}
+		s.mutex.Unlock()
+
+		<-handlersDone
+	}
+
+	// the metrics stay available while the connections drain
+	var metricsErr error
+	s.mutex.Lock()
+	metricsServer := s.metricsServer
+	s.mutex.Unlock()
+	if metricsServer != nil {
+		metricsErr = metricsServer.Close()
+	}
+
+	return errors.Join(ctxErr, metricsErr, s.state.Close())
+}
+
+// ReloadTLS reads the TLS certificate and client CAs again: the connections established
+// from now on use them, while the open ones are not affected. If the files are invalid,
+// the previous ones are kept. It does nothing if the server doesn't use TLS.
+func (s *Server) ReloadTLS() error {
+	if s.tls == nil {
+		return nil
+	}
+
+	return s.tls.Reload()
+}
+
+// track registers a new connection, unless the server is shutting down
+func (s *Server) track(conn net.Conn) (*connection, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.shuttingDown {
+		return nil, false
+	}
+
+	c := &connection{
+		session: commands.NewSession(conn, s.logger.With(
+			"conn_id", s.lastConnID.Add(1),
+			"remote_addr", conn.RemoteAddr().String(),
+		), s.policy(), s.metrics),
+		out: newFrameWriter(conn, s.cfg.WriteTimeout),
+	}
+	s.conns[conn] = c
+	s.handlers.Add(1)
+
+	return c, true
+}
+
+func (s *Server) untrack(conn net.Conn) {
+	s.mutex.Lock()
+	delete(s.conns, conn)
+	s.mutex.Unlock()
+
+	s.handlers.Done()
+}
+
+// extendReadDeadline gives the client another idle timeout to send the next command:
+// a client silent for longer than that is considered gone, even if the TCP connection
+// looks still open. On shutdown the deadline is not extended anymore.
+func (s *Server) extendReadDeadline(conn net.Conn) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.cfg.IdleTimeout > 0 && !s.shuttingDown {
+		conn.SetReadDeadline(time.Now().Add(s.cfg.IdleTimeout))
+	}
+}
+
+func (s *Server) limits() commands.Limits {
+	return commands.Limits{
+		MaxFrameSize:        uint32(s.cfg.MaxFrameSize),
+		MaxUsernameLength:   s.cfg.MaxUsernameLength,
+		MaxMessageLength:    s.cfg.MaxMessageLength,
+		SkipOversizedFrames: s.cfg.OversizedFramePolicy == config.OversizedFramePolicySkip,
+	}
+}
+
+func (s *Server) policy() commands.Policy {
+	return commands.Policy{
+		AllowPasswordlessLogin: s.cfg.AllowPasswordlessLogin,
+		Features:               s.features(),
+	}
+}
+
+// features returns the optional features offered to the clients, which they learn about with Hello.
+// Some of them depend on the config.
+func (s *Server) features() []string {
+	var features []string
+	if s.cfg.SessionResumeGrace > 0 {
+		features = append(features, commands.FeatureSessionTokens)
+	}
+	if s.cfg.AllowPasswordlessLogin {
+		features = append(features, commands.FeaturePasswordlessLogin)
+	}
+	return append(features, commands.FeatureDeliveryAcks)
+}
+
+func (s *Server) isShuttingDown() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.shuttingDown
+}
+
+func (s *Server) handleConnection(conn net.Conn, c *connection) {
+
+	session, out := c.session, c.out
+	session.Logger().Info("connection established")
+
+	var d *delivery
+	activity := make(chan struct{}, 1)
+	stopHeartbeat := make(chan struct{})
+	defer func() {
+		session.Close()
+		close(stopHeartbeat)
+		s.state.Logout(conn)
+		s.syncDelivery(session, out, d)
+		conn.Close()
+		s.untrack(conn)
+	}()
+
+	if s.cfg.IdleTimeout > 0 {
+		go s.heartbeat(out, session.Logger(), activity, stopHeartbeat)
+	}
 
-	fmt.Println("Connection established, waiting for commands...")
 	for {
 
-		cmd, cmdErr := commands.ParseCommand(conn)
+		s.extendReadDeadline(conn)
+
+		cmd, cmdErr := commands.ParseCommand(session, s.limits())
+		if cmdErr == nil {
+			select {
+			case activity <- struct{}{}:
+			default:
+			}
+		}
+
+		// the logs about the frame carry its correlationId, once it's known
+		logger := session.CommandLogger()
 		if cmdErr == io.EOF {
-			s.state.Logout(conn)
-			fmt.Println("Client disconnected")
+			logger.Info("client disconnected")
+			break
+		}
+
+		// the frames that couldn't be parsed get an error response,
+		// unless the stream itself is broken
+		var parseErr *commands.ParseError
+		if errors.As(cmdErr, &parseErr) {
+			logger.Warn("parsing command", "error", cmdErr)
+
+			wErr := out.WriteFrame(parseErr.Response())
+			if wErr != nil {
+				logger.Warn("writing response on socket", "error", wErr)
+				break
+			}
+			continue
+		}
+
+		// the frames that couldn't be read as a whole get an error response too,
+		// but the stream is out of sync, so the connection can't be used anymore
+		var frameErr *commands.FrameError
+		if errors.As(cmdErr, &frameErr) {
+			logger.Warn("reading frame", "error", cmdErr)
+
+			wErr := out.WriteFrame(frameErr.Response())
+			if wErr != nil {
+				logger.Warn("writing response on socket", "error", wErr)
+			}
+			break
+		}
+		if cmdErr != nil && s.isShuttingDown() {
+			logger.Info("closing connection for shutdown")
+			break
+		}
+		var netErr net.Error
+		if errors.As(cmdErr, &netErr) && netErr.Timeout() {
+			logger.Info("closing idle connection")
 			break
 		}
 		if cmdErr != nil {
-			fmt.Println("Error while parsing command:", cmdErr)
+			logger.Warn("reading command", "error", cmdErr)
 			break
 		}
 
 		resp, procErr := cmd.Process(s.state)
 		if procErr != nil {
-			fmt.Println("Error while processing command:", procErr)
+			logger.Error("processing command", "command", cmd, "error", procErr)
 			break
 		}
+		session.Sync(s.state)
 
-		wErr := resp.Write(conn)
-		if wErr != nil {
-			fmt.Println("Error while writing response on socket:", wErr)
-			break
+		if resp != nil {
+			wErr := out.WriteFrame(resp)
+			if wErr != nil {
+				logger.Warn("writing response on socket", "error", wErr)
+				break
+			}
 		}
+
+		d = s.syncDelivery(session, out, d)
 	}
 }
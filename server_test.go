@@ -0,0 +1,218 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net"
+	"tcpserver/commands"
+	"tcpserver/config"
+	"tcpserver/protocol"
+	"tcpserver/state"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestServer creates a server keeping its state in memory, accepting the passwordless logins
+// and never pinging the clients, unless configure says otherwise
+func newTestServer(t *testing.T, configure func(cfg *config.Config)) *Server {
+	cfg := config.Default()
+	cfg.DataDir = ""
+	cfg.AllowPasswordlessLogin = true
+	cfg.IdleTimeout = 0
+	cfg.SessionResumeGrace = 0
+	if configure != nil {
+		configure(&cfg)
+	}
+
+	tokens, err := sessionTokenOptions(&cfg)
+	require.NoError(t, err)
+
+	return newServer(&cfg, state.NewStateWithMailboxSize(cfg.MailboxSize), nil, tokens, slog.New(slog.DiscardHandler))
+}
+
+// connect hands a new connection to the server, as if it had been accepted, and returns the client side of it
+func connect(t *testing.T, s *Server) net.Conn {
+	clientConn, serverConn := net.Pipe()
+
+	c, ok := s.track(serverConn)
+	require.True(t, ok)
+	go s.handleConnection(serverConn, c)
+
+	t.Cleanup(func() { _ = clientConn.Close() })
+	return clientConn
+}
+
+// sessionOf returns the session the server tracks for its only connection
+func sessionOf(t *testing.T, s *Server) *commands.Session {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	require.Len(t, s.conns, 1)
+	for _, c := range s.conns {
+		return c.session
+	}
+	return nil
+}
+
+// send writes a frame as a client would
+func send(t *testing.T, conn net.Conn, correlationID uint32, body protocol.Body) {
+	require.NoError(t, protocol.WriteFrame(conn, protocol.Version1, correlationID, body))
+}
+
+// receive reads the next frame written by the server
+func receive(t *testing.T, conn net.Conn) (protocol.Header, protocol.Body) {
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(time.Second)))
+
+	header, body, err := protocol.ReadFrame(conn, 1<<20)
+	require.NoError(t, err)
+	return header, body
+}
+
+// login logs in the user on the connection, reading the frames up to the ReplayDone following the response
+func login(t *testing.T, conn net.Conn, username string) {
+	send(t, conn, 1, &protocol.Login{Username: username})
+
+	_, body := receive(t, conn)
+	require.Equal(t, protocol.StatusOK, body.(*protocol.Response).Status)
+	for {
+		_, body = receive(t, conn)
+		if _, ok := body.(*protocol.ReplayDone); ok {
+			return
+		}
+	}
+}
+
+func Test_Server_Shutdown_ClosesSessions(t *testing.T) {
+	s := newTestServer(t, nil)
+	conn := connect(t, s)
+	login(t, conn, "alice")
+
+	shutdown := make(chan error, 1)
+	go func() {
+		shutdown <- s.Shutdown(context.Background())
+	}()
+
+	// the GoingAway can't be written until it's read, but the session is closing already
+	require.Eventually(t, func() bool {
+		return sessionOf(t, s).Phase() == commands.PhaseClosing
+	}, time.Second, time.Millisecond)
+
+	send(t, conn, 2, &protocol.Ping{})
+
+	header, body := receive(t, conn)
+	assert.Equal(t, protocol.CodeGoingAway, header.Code)
+	assert.IsType(t, &protocol.GoingAway{}, body)
+
+	header, body = receive(t, conn)
+	assert.Equal(t, uint32(2), header.CorrelationID)
+	assert.Equal(t, protocol.StatusNotAllowed, body.(*protocol.Response).Status)
+
+	// the connection gets closed, and the user logged out
+	_, _, err := protocol.ReadFrame(conn, 1<<20)
+	assert.Error(t, err)
+	assert.NoError(t, <-shutdown)
+	assert.Equal(t, map[string]bool{"alice": false}, s.state.Users())
+}
+
+func Test_Server_Shutdown_Drains(t *testing.T) {
+	s := newTestServer(t, nil)
+	alice := connect(t, s)
+	login(t, alice, "alice")
+
+	// bob is offline, so his message waits in the mailbox
+	offline := &net.TCPConn{}
+	require.NoError(t, s.state.Login(offline, "bob"))
+	s.state.Logout(offline)
+	send(t, alice, 2, &protocol.Message{Message: "Hi", From: "alice", To: "bob", Timestamp: time.Unix(1, 0)})
+	_, body := receive(t, alice)
+	require.Equal(t, protocol.StatusOK, body.(*protocol.Response).Status)
+
+	shutdown := make(chan error, 1)
+	go func() {
+		shutdown <- s.Shutdown(context.Background())
+	}()
+
+	_, body = receive(t, alice)
+	assert.IsType(t, &protocol.GoingAway{}, body)
+	_, _, err := protocol.ReadFrame(alice, 1<<20)
+	assert.ErrorIs(t, err, io.EOF)
+
+	assert.NoError(t, <-shutdown)
+	assert.Empty(t, s.conns)
+	assert.Equal(t, map[string]bool{"alice": false, "bob": false}, s.state.Users())
+	assert.Equal(t, 1, s.state.QueuedMessages()["bob"])
+}
+
+func Test_Server_Shutdown_Timeout(t *testing.T) {
+	s := newTestServer(t, nil)
+	conn := connect(t, s)
+	login(t, conn, "alice")
+
+	// the client never reads the GoingAway, so the connection gets closed when the time is over
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	err := s.Shutdown(ctx)
+
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Empty(t, s.conns)
+	_, _, err = protocol.ReadFrame(conn, 1<<20)
+	assert.Error(t, err)
+}
+
+func Test_Server_track_ShuttingDown(t *testing.T) {
+	s := newTestServer(t, nil)
+	require.NoError(t, s.Shutdown(context.Background()))
+
+	clientConn, serverConn := net.Pipe()
+	defer clientConn.Close()
+	defer serverConn.Close()
+
+	_, ok := s.track(serverConn)
+
+	assert.False(t, ok)
+}
+
+func Test_Server_Login_SessionToken(t *testing.T) {
+	tests := []struct {
+		name      string
+		features  []string
+		wantToken bool
+	}{
+		{
+			name:      "the client asked for the session tokens",
+			features:  []string{commands.FeatureSessionTokens},
+			wantToken: true,
+		},
+		{
+			name:      "a v1 client that didn't say Hello only gets the response",
+			wantToken: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t, func(cfg *config.Config) {
+				cfg.SessionResumeGrace = time.Minute
+			})
+			conn := connect(t, s)
+			if tt.features != nil {
+				hello(t, conn, tt.features...)
+			}
+
+			send(t, conn, 2, &protocol.Login{Username: "alice"})
+
+			_, body := receive(t, conn)
+			require.Equal(t, protocol.StatusOK, body.(*protocol.Response).Status)
+			if tt.wantToken {
+				_, body = receive(t, conn)
+				assert.IsType(t, &protocol.SessionToken{}, body)
+			}
+			_, body = receive(t, conn)
+			assert.Equal(t, &protocol.ReplayDone{}, body)
+		})
+	}
+}
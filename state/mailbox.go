@@ -0,0 +1,207 @@
+package state
+
+import (
+	"errors"
+	"log/slog"
+	"slices"
+	"sort"
+	"sync"
+)
+
+var (
+	ErrMailboxFull = errors.New("mailbox full")
+)
+
+// OverflowPolicy decides what happens to a message addressed to a full mailbox
+type OverflowPolicy int
+
+const (
+	// OverflowReject refuses the message with ErrMailboxFull
+	OverflowReject OverflowPolicy = iota
+	// OverflowDropOldest makes room for the message by dropping the oldest one queued
+	OverflowDropOldest
+	// OverflowSpill queues the message out of the mailbox: it's kept by the store of the state alone,
+	// and read back from it when the mailbox gets drained. It requires a store.
+	OverflowSpill
+)
+
+// MailboxOptions configures the mailboxes of the users
+type MailboxOptions struct {
+	// Size is the maximum number of messages kept in the mailbox per user, the deliveries
+	// not acknowledged yet included, MessageQueueMaxSize when not set
+	Size           int
+	OverflowPolicy OverflowPolicy
+}
+
+// Delivery is a message taken from the mailbox of its recipient to be delivered, numbered by its sequence
+type Delivery struct {
+	Sequence uint64
+	Message
+}
+
+// Mailbox queues the messages addressed to a user until they get delivered,
+// and keeps the ones delivered until the client acknowledges them.
+// It's safe for concurrent use.
+type Mailbox struct {
+	mutex    sync.Mutex
+	messages []Message
+	// spilled is the number of messages kept by the store alone: once there is any,
+	// the new messages get spilled too, so they are always the last ones added to the store
+	spilled int
+
+	// sequence is the one of the last delivery, the deliveries are numbered from 1
+	sequence uint64
+	// unacknowledged are the deliveries not acknowledged yet, by increasing sequence
+	unacknowledged []Delivery
+
+	// notify gets signaled when a message is queued
+	notify chan struct{}
+}
+
+func newMailbox() *Mailbox {
+	return &Mailbox{
+		messages: []Message{},
+		notify:   make(chan struct{}, 1),
+	}
+}
+
+// Len returns the number of messages queued, the spilled ones and the unacknowledged deliveries included
+func (m *Mailbox) Len() int {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return len(m.messages) + m.spilled + len(m.unacknowledged)
+}
+
+// enqueue adds the message to the mailbox, applying the overflow policy of the state when it's full.
+// The message is persisted in the store (if any) only once it's sure to be queued.
+func (m *Mailbox) enqueue(s *State, to string, msg Message) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	// the deliveries not acknowledged yet take room too, otherwise a client that never acknowledges
+	// would get its mailbox drained without limit
+	full := len(m.messages)+len(m.unacknowledged) >= s.mailboxSize() || m.spilled > 0
+	// without a store to keep them, the messages can't be spilled: they are rejected instead
+	rejected := s.mailbox.OverflowPolicy == OverflowReject || (s.mailbox.OverflowPolicy == OverflowSpill && s.store == nil)
+	if full && rejected {
+		return ErrMailboxFull
+	}
+
+	if s.store != nil {
+		err := s.store.AddMessage(to, msg)
+		if err != nil {
+			return err
+		}
+	}
+
+	switch {
+	case !full:
+		m.messages = append(m.messages, msg)
+
+	case s.mailbox.OverflowPolicy == OverflowDropOldest:
+		// the deliveries not acknowledged are older than the messages queued
+		var dropped Message
+		if len(m.unacknowledged) > 0 {
+			dropped = m.unacknowledged[0].Message
+			m.unacknowledged = slices.Delete(m.unacknowledged, 0, 1)
+			m.messages = append(m.messages, msg)
+		} else {
+			dropped = m.messages[0]
+			m.messages = append(slices.Delete(m.messages, 0, 1), msg)
+		}
+
+		// the message dropped won't ever be delivered, so it doesn't need to be persisted anymore
+		if s.store != nil {
+			err := s.store.RemoveMessage(to, dropped)
+			if err != nil {
+				slog.Error("removing dropped message from the store", "to", to, "error", err)
+			}
+		}
+
+	case s.mailbox.OverflowPolicy == OverflowSpill:
+		// the message has been added to the store above, which is where it's kept
+		m.spilled++
+	}
+
+	select {
+	case m.notify <- struct{}{}:
+	default:
+	}
+
+	return nil
+}
+
+// putBack queues again the messages drained but not delivered, ahead of the others
+func (m *Mailbox) putBack(msgs []Message) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.messages = append(slices.Clone(msgs), m.messages...)
+
+	select {
+	case m.notify <- struct{}{}:
+	default:
+	}
+}
+
+// drain removes all the messages queued, the spilled ones included, and returns them sorted by timestamp
+func (m *Mailbox) drain(s *State, to string) []Message {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	drained := m.messages
+	m.messages = []Message{}
+
+	if m.spilled > 0 {
+		spilled, err := s.store.LastMessages(to, m.spilled)
+		if err != nil {
+			// the spilled messages are left where they are, to be taken by the next drain
+			slog.Error("reading spilled messages from the store", "to", to, "error", err)
+		} else {
+			drained = append(drained, spilled...)
+			m.spilled = 0
+		}
+	}
+
+	sort.SliceStable(drained, func(i, j int) bool {
+		return drained[i].Timestamp.Before(drained[j].Timestamp)
+	})
+
+	return drained
+}
+
+// deliver numbers the message taken from the mailbox, keeping it until its delivery gets acknowledged
+func (m *Mailbox) deliver(msg Message) Delivery {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.sequence++
+	delivery := Delivery{Sequence: m.sequence, Message: msg}
+	m.unacknowledged = append(m.unacknowledged, delivery)
+
+	return delivery
+}
+
+// acknowledge removes the deliveries up to the given sequence, and returns them
+func (m *Mailbox) acknowledge(sequence uint64) []Delivery {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	i := 0
+	for i < len(m.unacknowledged) && m.unacknowledged[i].Sequence <= sequence {
+		i++
+	}
+
+	acknowledged := m.unacknowledged[:i:i]
+	m.unacknowledged = m.unacknowledged[i:]
+
+	return acknowledged
+}
+
+// pending returns the deliveries not acknowledged yet, by increasing sequence
+func (m *Mailbox) pending() []Delivery {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	return slices.Clone(m.unacknowledged)
+}
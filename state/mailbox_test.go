@@ -0,0 +1,299 @@
+package state
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_State_EnqueueMessage_Overflow(t *testing.T) {
+	first := Message{From: "sender", Timestamp: time.Unix(1, 0), Payload: "first"}
+	second := Message{From: "sender", Timestamp: time.Unix(2, 0), Payload: "second"}
+	third := Message{From: "sender", Timestamp: time.Unix(3, 0), Payload: "third"}
+
+	tests := []struct {
+		name         string
+		policy       OverflowPolicy
+		wantErrs     []error
+		wantMessages []Message
+		wantInStore  []Message
+		wantRemoved  []Message
+	}{
+		{
+			name:         "reject: the messages beyond the size get rejected",
+			policy:       OverflowReject,
+			wantErrs:     []error{nil, nil, ErrMailboxFull},
+			wantMessages: []Message{first, second},
+			wantInStore:  []Message{first, second},
+		},
+		{
+			name:         "drop oldest: the oldest messages make room for the new ones",
+			policy:       OverflowDropOldest,
+			wantErrs:     []error{nil, nil, nil},
+			wantMessages: []Message{second, third},
+			wantInStore:  []Message{second, third},
+			wantRemoved:  []Message{first},
+		},
+		{
+			name:         "spill: the messages beyond the size are left in the store",
+			policy:       OverflowSpill,
+			wantErrs:     []error{nil, nil, nil},
+			wantMessages: []Message{first, second, third},
+			wantInStore:  []Message{first, second, third},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			store := &mockStore{}
+			s, err := NewStateWithStore(store, MailboxOptions{
+				Size:           2,
+				OverflowPolicy: tt.policy,
+			})
+			require.NoError(t, err)
+			s.LoggedUsers["recipient"] = false
+
+			for i, msg := range []Message{first, second, third} {
+				err := s.EnqueueMessage(msg.From, "recipient", msg.Timestamp, msg.Payload)
+				assert.Equal(t, tt.wantErrs[i], err)
+			}
+
+			assert.Equal(t, tt.wantInStore, store.mailboxes["recipient"])
+			assert.Equal(t, tt.wantRemoved, store.removed)
+			assert.LessOrEqual(t, len(s.Mailboxes["recipient"].messages), 2)
+			assert.Equal(t, len(tt.wantMessages), s.Mailboxes["recipient"].Len())
+			assert.Equal(t, tt.wantMessages, s.DrainMailbox("recipient"))
+		})
+	}
+}
+
+func Test_State_EnqueueMessage_SpillsInOrder(t *testing.T) {
+
+	store := &mockStore{}
+	s, err := NewStateWithStore(store, MailboxOptions{
+		Size:           1,
+		OverflowPolicy: OverflowSpill,
+	})
+	require.NoError(t, err)
+	s.LoggedUsers["recipient"] = false
+
+	_ = s.EnqueueMessage("sender", "recipient", time.Unix(1, 0), "first")
+	_ = s.EnqueueMessage("sender", "recipient", time.Unix(2, 0), "second")
+
+	// once a message got spilled, the next ones follow it, even if there's room in the mailbox,
+	// so that the spilled messages are always the last ones added to the store
+	first := s.Mailboxes["recipient"].messages[0]
+	s.Mailboxes["recipient"].messages = []Message{}
+	require.NoError(t, store.RemoveMessage("recipient", first))
+	_ = s.EnqueueMessage("sender", "recipient", time.Unix(3, 0), "third")
+
+	assert.Empty(t, s.Mailboxes["recipient"].messages)
+	assert.Equal(t, 2, s.Mailboxes["recipient"].spilled)
+	drained := s.DrainMailbox("recipient")
+	require.Len(t, drained, 2)
+	assert.Equal(t, "second", drained[0].Payload)
+	assert.Equal(t, "third", drained[1].Payload)
+}
+
+func Test_State_EnqueueMessage_SpillWithoutStore(t *testing.T) {
+
+	s := NewStateWithMailboxOptions(MailboxOptions{
+		Size:           1,
+		OverflowPolicy: OverflowSpill,
+	})
+	s.LoggedUsers["recipient"] = false
+
+	// without a store to keep them, the messages overflowing the mailbox are rejected
+	assert.NoError(t, s.EnqueueMessage("sender", "recipient", time.Unix(1, 0), "first"))
+	assert.Equal(t, ErrMailboxFull, s.EnqueueMessage("sender", "recipient", time.Unix(2, 0), "second"))
+}
+
+func Test_State_DrainMailbox_SpillError(t *testing.T) {
+
+	store := &mockStore{}
+	s, err := NewStateWithStore(store, MailboxOptions{
+		Size:           1,
+		OverflowPolicy: OverflowSpill,
+	})
+	require.NoError(t, err)
+	s.LoggedUsers["recipient"] = false
+
+	_ = s.EnqueueMessage("sender", "recipient", time.Unix(1, 0), "first")
+	_ = s.EnqueueMessage("sender", "recipient", time.Unix(2, 0), "second")
+
+	// the spilled messages are kept for the next drain
+	store.err = errors.New("disk failure")
+	assert.Len(t, s.DrainMailbox("recipient"), 1)
+
+	store.err = nil
+	assert.Len(t, s.DrainMailbox("recipient"), 1)
+	assert.Equal(t, 0, s.Mailboxes["recipient"].Len())
+}
+
+func Test_State_EnqueueMessage_Concurrent(t *testing.T) {
+	mockConn := net.TCPConn{}
+
+	s := NewStateWithMailboxSize(50)
+	_ = s.Login(&mockConn, "recipient")
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 100)
+	for i := range 100 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- s.EnqueueMessage("sender", "recipient", time.Unix(int64(i), 0), "message")
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	// a full mailbox never blocks the senders
+	full := 0
+	for err := range errs {
+		if err == ErrMailboxFull {
+			full++
+		}
+	}
+	assert.Equal(t, 50, full)
+	assert.Len(t, s.DrainMailbox("recipient"), 50)
+}
+
+func Test_State_Acknowledge(t *testing.T) {
+	first := Message{From: "alice", Timestamp: time.Unix(1, 0), Payload: "first"}
+	second := Message{From: "alice", Timestamp: time.Unix(2, 0), Payload: "second"}
+	third := Message{From: "alice", Timestamp: time.Unix(3, 0), Payload: "third"}
+
+	tests := []struct {
+		name        string
+		sequence    uint64
+		wantPending []Delivery
+		wantInStore []Message
+		wantRemoved []Message
+	}{
+		{
+			name:        "nothing received",
+			sequence:    0,
+			wantPending: []Delivery{{1, first}, {2, second}, {3, third}},
+			wantInStore: []Message{first, second, third},
+		},
+		{
+			name:        "received up to a sequence",
+			sequence:    2,
+			wantPending: []Delivery{{3, third}},
+			wantInStore: []Message{third},
+			wantRemoved: []Message{first, second},
+		},
+		{
+			name:        "received all",
+			sequence:    3,
+			wantPending: []Delivery{},
+			wantInStore: []Message{},
+			wantRemoved: []Message{first, second, third},
+		},
+		{
+			name:        "sequence not delivered yet",
+			sequence:    10,
+			wantPending: []Delivery{},
+			wantInStore: []Message{},
+			wantRemoved: []Message{first, second, third},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			store := &mockStore{}
+			s, err := NewStateWithStore(store, MailboxOptions{})
+			require.NoError(t, err)
+			s.LoggedUsers["bob"] = false
+			for _, msg := range []Message{first, second, third} {
+				require.NoError(t, s.EnqueueMessage(msg.From, "bob", msg.Timestamp, msg.Payload))
+			}
+			for _, msg := range s.DrainMailbox("bob") {
+				s.Deliver("bob", msg)
+			}
+
+			s.Acknowledge("bob", tt.sequence)
+
+			assert.Equal(t, tt.wantPending, s.Unacknowledged("bob"))
+			assert.Equal(t, len(tt.wantPending), s.QueuedMessages()["bob"])
+			assert.Equal(t, tt.wantInStore, store.mailboxes["bob"])
+			assert.Equal(t, tt.wantRemoved, store.removed)
+		})
+	}
+}
+
+func Test_State_Deliver_NumbersTheMailbox(t *testing.T) {
+	s := NewState()
+	msg := Message{From: "alice", Timestamp: time.Unix(1, 0), Payload: "Hi"}
+
+	// the sequence keeps growing across the acknowledgements, each mailbox numbering its own deliveries
+	assert.Equal(t, Delivery{Sequence: 1, Message: msg}, s.Deliver("bob", msg))
+	s.Acknowledge("bob", 1)
+	assert.Equal(t, Delivery{Sequence: 2, Message: msg}, s.Deliver("bob", msg))
+	assert.Equal(t, Delivery{Sequence: 1, Message: msg}, s.Deliver("carol", msg))
+
+	assert.Equal(t, []Delivery{{Sequence: 2, Message: msg}}, s.Unacknowledged("bob"))
+}
+
+func Test_State_EnqueueMessage_UnacknowledgedFillTheMailbox(t *testing.T) {
+	first := Message{From: "sender", Timestamp: time.Unix(1, 0), Payload: "first"}
+	second := Message{From: "sender", Timestamp: time.Unix(2, 0), Payload: "second"}
+	third := Message{From: "sender", Timestamp: time.Unix(3, 0), Payload: "third"}
+
+	tests := []struct {
+		name               string
+		policy             OverflowPolicy
+		wantErr            error
+		wantUnacknowledged []Delivery
+		wantMessages       []Message
+		wantRemoved        []Message
+	}{
+		{
+			name:               "reject: a client that never acknowledges gets its mailbox full",
+			policy:             OverflowReject,
+			wantErr:            ErrMailboxFull,
+			wantUnacknowledged: []Delivery{{1, first}, {2, second}},
+			wantMessages:       []Message{},
+		},
+		{
+			name:               "drop oldest: the oldest delivery not acknowledged makes room",
+			policy:             OverflowDropOldest,
+			wantUnacknowledged: []Delivery{{2, second}},
+			wantMessages:       []Message{third},
+			wantRemoved:        []Message{first},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			store := &mockStore{}
+			s, err := NewStateWithStore(store, MailboxOptions{
+				Size:           2,
+				OverflowPolicy: tt.policy,
+			})
+			require.NoError(t, err)
+			s.LoggedUsers["recipient"] = false
+
+			// each message gets delivered, but never acknowledged
+			for _, msg := range []Message{first, second} {
+				require.NoError(t, s.EnqueueMessage(msg.From, "recipient", msg.Timestamp, msg.Payload))
+				for _, drained := range s.DrainMailbox("recipient") {
+					s.Deliver("recipient", drained)
+				}
+			}
+
+			err = s.EnqueueMessage(third.From, "recipient", third.Timestamp, third.Payload)
+
+			assert.Equal(t, tt.wantErr, err)
+			assert.Equal(t, tt.wantUnacknowledged, s.Unacknowledged("recipient"))
+			assert.Equal(t, tt.wantMessages, s.Mailboxes["recipient"].messages)
+			assert.Equal(t, tt.wantRemoved, store.removed)
+		})
+	}
+}
@@ -0,0 +1,64 @@
+package state
+
+import (
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"sync"
+)
+
+const (
+	passwordSaltLength = 16
+	passwordHashLength = 32
+)
+
+// PasswordIterations is the number of PBKDF2 iterations of the new password hashes.
+// The existing hashes keep the count they were created with.
+var PasswordIterations = 600_000
+
+// PasswordHash is a salted PBKDF2-HMAC-SHA256 hash of a password
+type PasswordHash struct {
+	Salt       []byte `json:"salt"`
+	Iterations int    `json:"iterations"`
+	Hash       []byte `json:"hash"`
+}
+
+// HashPassword hashes the password with a new random salt
+func HashPassword(password string) (PasswordHash, error) {
+
+	salt := make([]byte, passwordSaltLength)
+	_, err := rand.Read(salt)
+	if err != nil {
+		return PasswordHash{}, err
+	}
+
+	hash, err := pbkdf2.Key(sha256.New, password, salt, PasswordIterations, passwordHashLength)
+	if err != nil {
+		return PasswordHash{}, err
+	}
+
+	return PasswordHash{
+		Salt:       salt,
+		Iterations: PasswordIterations,
+		Hash:       hash,
+	}, nil
+}
+
+// Verify tells whether the password is the one that was hashed, in constant time
+func (p PasswordHash) Verify(password string) bool {
+
+	hash, err := pbkdf2.Key(sha256.New, password, p.Salt, p.Iterations, len(p.Hash))
+	if err != nil {
+		return false
+	}
+
+	return subtle.ConstantTimeCompare(hash, p.Hash) == 1
+}
+
+// dummyPasswordHash is verified in place of the hash of an unknown user,
+// so that the time taken to answer doesn't tell whether the user exists
+var dummyPasswordHash = sync.OnceValue(func() PasswordHash {
+	hash, _ := HashPassword("")
+	return hash
+})
@@ -0,0 +1,76 @@
+package state
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_HashPassword(t *testing.T) {
+
+	hash, err := HashPassword("secret")
+	require.NoError(t, err)
+
+	assert.Len(t, hash.Salt, passwordSaltLength)
+	assert.Len(t, hash.Hash, passwordHashLength)
+	assert.Equal(t, PasswordIterations, hash.Iterations)
+
+	// the same password gets a different salt, hence a different hash
+	other, err := HashPassword("secret")
+	require.NoError(t, err)
+	assert.NotEqual(t, hash.Salt, other.Salt)
+	assert.NotEqual(t, hash.Hash, other.Hash)
+}
+
+func Test_PasswordHash_Verify(t *testing.T) {
+	fastPasswordHashing(t)
+
+	hash, err := HashPassword("secret")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		hash     PasswordHash
+		password string
+		want     bool
+	}{
+		{
+			name:     "happy path: right password",
+			hash:     hash,
+			password: "secret",
+			want:     true,
+		},
+		{
+			name:     "error: wrong password",
+			hash:     hash,
+			password: "Secret",
+			want:     false,
+		},
+		{
+			name:     "error: empty password",
+			hash:     hash,
+			password: "",
+			want:     false,
+		},
+		{
+			name:     "error: corrupted hash",
+			hash:     PasswordHash{Salt: hash.Salt, Iterations: hash.Iterations},
+			password: "secret",
+			want:     false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			assert.Equal(t, tt.want, tt.hash.Verify(tt.password))
+		})
+	}
+}
+
+// fastPasswordHashing lowers the iterations of the password hashes for the duration of the test
+func fastPasswordHashing(t *testing.T) {
+	iterations := PasswordIterations
+	PasswordIterations = 1
+	t.Cleanup(func() { PasswordIterations = iterations })
+}
@@ -2,9 +2,11 @@ package state
 
 import (
 	"errors"
-	"fmt"
+	"log/slog"
+	"maps"
 	"net"
 	"sync"
+	"tcpserver/logging"
 	"time"
 )
 
@@ -15,84 +17,329 @@ const (
 var (
 	ErrUserAlreadyOnline  = errors.New("user already online")
 	ErrRecipientNotExists = errors.New("recipient doesn't exist")
+	ErrUsernameTaken      = errors.New("username taken")
+	ErrBadCredentials     = errors.New("bad credentials")
 )
 
 type State struct {
 	mutex       sync.Mutex
 	Connections map[net.Conn]string
 	LoggedUsers map[string]bool
-	Messages    map[string]chan Message
-	Interrupts  map[string]chan bool
+	// Passwords holds the hashes of the users who registered with a password
+	Passwords  map[string]PasswordHash
+	Mailboxes  map[string]*Mailbox
+	// Interrupts are closed to stop the delivery of the messages to a connection when it logs out
+	Interrupts map[net.Conn]chan struct{}
+
+	// store is optional: without it, the state lives in memory only
+	store Store
+
+	mailbox MailboxOptions
+
+	// tokens is nil while the session tokens are disabled
+	tokens *TokenOptions
+	// sessions are never persisted in the store: the tokens can't resume them after a restart
+	sessions map[string]*resumableSession
+	// now is replaced in the tests
+	now func() time.Time
 }
 
 func NewState() *State {
+	return NewStateWithMailboxSize(MessageQueueMaxSize)
+}
+
+func NewStateWithMailboxSize(mailboxSize int) *State {
+	return NewStateWithMailboxOptions(MailboxOptions{Size: mailboxSize})
+}
+
+// NewStateWithMailboxOptions creates a state whose mailboxes follow the given options
+func NewStateWithMailboxOptions(opts MailboxOptions) *State {
 	return &State{
 		mutex:       sync.Mutex{},
 		Connections: map[net.Conn]string{},
 		LoggedUsers: map[string]bool{},
-		Messages:    map[string](chan Message){},
-		Interrupts:  map[string]chan bool{},
+		Passwords:   map[string]PasswordHash{},
+		Mailboxes:   map[string]*Mailbox{},
+		Interrupts:  map[net.Conn]chan struct{}{},
+		mailbox:     opts,
+		now:         time.Now,
 	}
 }
 
+// Login logs the user in on the connection without a password, creating them if they don't exist yet.
+// The users who registered with a password can't log in this way.
 func (s *State) Login(conn net.Conn, username string) error {
 
-	if s.userIsOnline(username) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, hasPassword := s.Passwords[username]; hasPassword {
+		return ErrBadCredentials
+	}
+
+	isOnline, exists := s.LoggedUsers[username]
+	if isOnline {
 		return ErrUserAlreadyOnline
 	}
 
-	s.mutex.Lock()
+	if !exists && s.store != nil {
+		err := s.store.AddUser(User{Username: username})
+		if err != nil {
+			return err
+		}
+	}
+
 	s.LoggedUsers[username] = true
 	s.Connections[conn] = username
+
+	return nil
+}
+
+// Register creates a user who logs in with the given password
+func (s *State) Register(username string, password string) error {
+
+	// hashing is slow on purpose, so it's done before taking the lock
+	hash, err := HashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, exists := s.LoggedUsers[username]; exists {
+		return ErrUsernameTaken
+	}
+
+	if s.store != nil {
+		err = s.store.AddUser(User{Username: username, Password: &hash})
+		if err != nil {
+			return err
+		}
+	}
+
+	if s.Passwords == nil {
+		s.Passwords = map[string]PasswordHash{}
+	}
+	s.Passwords[username] = hash
+	s.LoggedUsers[username] = false
+
+	return nil
+}
+
+// LoginWithPassword logs the user in on the connection, if they registered with the given password
+func (s *State) LoginWithPassword(conn net.Conn, username string, password string) error {
+
+	s.mutex.Lock()
+	hash, ok := s.Passwords[username]
 	s.mutex.Unlock()
 
+	// an unknown user takes as long as a wrong password to be refused
+	if !ok {
+		hash = dummyPasswordHash()
+	}
+	if !hash.Verify(password) || !ok {
+		return ErrBadCredentials
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.LoggedUsers[username] {
+		return ErrUserAlreadyOnline
+	}
+
+	s.LoggedUsers[username] = true
+	s.Connections[conn] = username
+
 	return nil
 }
 
 func (s *State) Logout(conn net.Conn) {
 	s.mutex.Lock()
-	s.LoggedUsers[s.Connections[conn]] = false
+	defer s.mutex.Unlock()
+
+	username, ok := s.Connections[conn]
+	if !ok {
+		return
+	}
+	s.LoggedUsers[username] = false
 	delete(s.Connections, conn)
-	s.mutex.Unlock()
+	s.sessionDisconnected(username)
+
+	// stop the delivery of the messages to the connection that is going away,
+	// leaving alone the one to another connection the user may already be logged in on
+	interrupt, ok := s.Interrupts[conn]
+	if ok {
+		close(interrupt)
+		delete(s.Interrupts, conn)
+	}
 }
 
-func (s *State) EnqueueMessage(from string, to string, timestamp time.Time, message string) error {
+// Users returns a snapshot of the known users, each with its online status
+func (s *State) Users() map[string]bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
 
-	if !s.userExists(to) {
-		return ErrRecipientNotExists
+	return maps.Clone(s.LoggedUsers)
+}
+
+// QueuedMessages returns the number of messages waiting in the mailbox of each user who has one
+func (s *State) QueuedMessages() map[string]int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	queued := make(map[string]int, len(s.Mailboxes))
+	for username, mailbox := range s.Mailboxes {
+		queued[username] = mailbox.Len()
 	}
 
-	_, ok := s.Messages[to]
-	if !ok {
-		s.Messages[to] = make(chan Message, MessageQueueMaxSize)
+	return queued
+}
+
+// Username returns the user logged in on the given connection, if any
+func (s *State) Username(conn net.Conn) (string, bool) {
+	s.mutex.Lock()
+	username, ok := s.Connections[conn]
+	s.mutex.Unlock()
+	return username, ok
+}
+
+// Mailbox returns the channel signaled when a message is queued for the given user.
+// It gets created if the user didn't receive any message yet.
+func (s *State) Mailbox(username string) <-chan struct{} {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.mailboxOf(username).notify
+}
+
+// Interrupt returns the channel closed when the user logged in on the connection logs out,
+// to stop the delivery of their messages to it. It's already closed if nobody is logged in on it.
+func (s *State) Interrupt(conn net.Conn) <-chan struct{} {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, ok := s.Connections[conn]; !ok {
+		interrupt := make(chan struct{})
+		close(interrupt)
+		return interrupt
 	}
 
-	_, ok = s.Interrupts[to]
+	interrupt, ok := s.Interrupts[conn]
 	if !ok {
-		s.Interrupts[to] = make(chan bool, 1)
+		if s.Interrupts == nil {
+			s.Interrupts = map[net.Conn]chan struct{}{}
+		}
+		interrupt = make(chan struct{})
+		s.Interrupts[conn] = interrupt
 	}
 
-	s.Messages[to] <- Message{
-		From:      from,
-		Timestamp: timestamp,
-		Payload:   message,
+	return interrupt
+}
+
+// DrainMailbox removes from the mailbox of the given user the messages
+// queued so far, and returns them sorted by timestamp
+func (s *State) DrainMailbox(username string) []Message {
+	s.mutex.Lock()
+	mailbox := s.mailboxOf(username)
+	s.mutex.Unlock()
+
+	return mailbox.drain(s, username)
+}
+
+// PutBack queues again the messages taken from the mailbox of the given user that couldn't be delivered.
+// They were already accepted, so they get queued even if the mailbox is full.
+func (s *State) PutBack(username string, msgs []Message) {
+	if len(msgs) == 0 {
+		return
 	}
 
-	return nil
+	s.mutex.Lock()
+	mailbox := s.mailboxOf(username)
+	s.mutex.Unlock()
+
+	mailbox.putBack(msgs)
 }
 
-func (s *State) userExists(username string) bool {
+// Deliver numbers a message taken from the mailbox of the given user before writing it to them.
+// It's kept, in the mailbox and in the store, until its delivery gets acknowledged.
+func (s *State) Deliver(username string, msg Message) Delivery {
 	s.mutex.Lock()
-	_, ok := s.LoggedUsers[username]
+	mailbox := s.mailboxOf(username)
 	s.mutex.Unlock()
-	return ok
+
+	return mailbox.deliver(msg)
 }
 
-func (s *State) userIsOnline(username string) bool {
+// Unacknowledged returns the deliveries to the given user that haven't been acknowledged yet, by increasing sequence.
+// They must be delivered again, with the same sequence.
+func (s *State) Unacknowledged(username string) []Delivery {
 	s.mutex.Lock()
-	isOnline := s.LoggedUsers[username]
+	mailbox := s.mailboxOf(username)
 	s.mutex.Unlock()
-	return isOnline
+
+	return mailbox.pending()
+}
+
+// Acknowledge forgets the deliveries to the given user up to the given sequence, which were received.
+// They are removed from the store too: failing to do so only means that they will be delivered again after a restart.
+func (s *State) Acknowledge(username string, sequence uint64) {
+	s.mutex.Lock()
+	mailbox := s.mailboxOf(username)
+	s.mutex.Unlock()
+
+	acknowledged := mailbox.acknowledge(sequence)
+	if s.store == nil {
+		return
+	}
+
+	for _, delivery := range acknowledged {
+		err := s.store.RemoveMessage(username, delivery.Message)
+		if err != nil {
+			slog.Error("removing acknowledged message from the store", "to", username, "error", err)
+		}
+	}
+}
+
+// EnqueueMessage queues the message for its recipient. When the mailbox of the recipient is full,
+// the message is handled according to the overflow policy: with OverflowReject, it fails with ErrMailboxFull.
+func (s *State) EnqueueMessage(from string, to string, timestamp time.Time, message string) error {
+
+	s.mutex.Lock()
+	_, exists := s.LoggedUsers[to]
+	if !exists {
+		s.mutex.Unlock()
+		return ErrRecipientNotExists
+	}
+	mailbox := s.mailboxOf(to)
+	s.mutex.Unlock()
+
+	return mailbox.enqueue(s, to, Message{
+		From:      from,
+		Timestamp: timestamp,
+		Payload:   message,
+	})
+}
+
+// mailboxSize returns the maximum number of messages queued in the mailbox of each user,
+// MessageQueueMaxSize when not set
+func (s *State) mailboxSize() int {
+	if s.mailbox.Size == 0 {
+		return MessageQueueMaxSize
+	}
+	return s.mailbox.Size
+}
+
+// mailboxOf returns the mailbox of the given user, creating it if needed.
+// It must be called holding the mutex.
+func (s *State) mailboxOf(username string) *Mailbox {
+	mailbox, ok := s.Mailboxes[username]
+	if !ok {
+		mailbox = newMailbox()
+		s.Mailboxes[username] = mailbox
+	}
+	return mailbox
 }
 
 type Message struct {
@@ -101,11 +348,11 @@ type Message struct {
 	Payload   string
 }
 
-func (m *Message) Print() {
-	fmt.Println("-----")
-	fmt.Println("Message")
-	fmt.Printf("\tfrom: %s\n", m.From)
-	fmt.Printf("\ttime: %s\n", m.Timestamp.String())
-	fmt.Printf("\tpayload: %s\n", m.Payload)
-	fmt.Println("-----")
+// LogValue describes the message in the logs
+func (m Message) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.String("from", m.From),
+		slog.Time("time", m.Timestamp),
+		logging.Payload(m.Payload),
+	)
 }
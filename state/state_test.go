@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func Test_State_Login(t *testing.T) {
@@ -28,11 +29,11 @@ func Test_State_Login(t *testing.T) {
 				LoggedUsers: map[string]bool{
 					"user1": true,
 				},
-				Messages: map[string]chan Message{},
+				Mailboxes: map[string]*Mailbox{},
 				Connections: map[net.Conn]string{
 					&mockConn: "user1",
 				},
-				Interrupts: map[string]chan bool{},
+				Interrupts: map[net.Conn]chan struct{}{},
 			},
 			wantErr: nil,
 		},
@@ -42,11 +43,11 @@ func Test_State_Login(t *testing.T) {
 				LoggedUsers: map[string]bool{
 					"user1": true,
 				},
-				Messages: map[string]chan Message{},
+				Mailboxes: map[string]*Mailbox{},
 				Connections: map[net.Conn]string{
 					&mockConn: "user1",
 				},
-				Interrupts: map[string]chan bool{},
+				Interrupts: map[net.Conn]chan struct{}{},
 			},
 			conn:     &mockConn,
 			username: "user1",
@@ -54,11 +55,11 @@ func Test_State_Login(t *testing.T) {
 				LoggedUsers: map[string]bool{
 					"user1": true,
 				},
-				Messages: map[string]chan Message{},
+				Mailboxes: map[string]*Mailbox{},
 				Connections: map[net.Conn]string{
 					&mockConn: "user1",
 				},
-				Interrupts: map[string]chan bool{},
+				Interrupts: map[net.Conn]chan struct{}{},
 			},
 			wantErr: ErrUserAlreadyOnline,
 		},
@@ -70,7 +71,7 @@ func Test_State_Login(t *testing.T) {
 
 			assert.Equal(t, tt.wantState.LoggedUsers, tt.state.LoggedUsers)
 			assert.Equal(t, tt.wantState.Connections, tt.state.Connections)
-			assert.Equal(t, tt.wantState.Messages, tt.state.Messages)
+			assert.Equal(t, tt.wantState.Mailboxes, tt.state.Mailboxes)
 			assert.Equal(t, tt.wantState.Interrupts, tt.state.Interrupts)
 			assert.Equal(t, tt.wantErr, err)
 		})
@@ -92,7 +93,7 @@ func Test_State_Logout(t *testing.T) {
 				LoggedUsers: map[string]bool{
 					"user1": true,
 				},
-				Messages: map[string]chan Message{},
+				Mailboxes: map[string]*Mailbox{},
 				Connections: map[net.Conn]string{
 					&mockConn: "user1",
 				},
@@ -102,7 +103,7 @@ func Test_State_Logout(t *testing.T) {
 				LoggedUsers: map[string]bool{
 					"user1": false,
 				},
-				Messages:    map[string]chan Message{},
+				Mailboxes:   map[string]*Mailbox{},
 				Connections: map[net.Conn]string{},
 			},
 		},
@@ -114,7 +115,7 @@ func Test_State_Logout(t *testing.T) {
 
 			assert.Equal(t, tt.wantState.LoggedUsers, tt.state.LoggedUsers)
 			assert.Equal(t, tt.wantState.Connections, tt.state.Connections)
-			assert.Equal(t, tt.wantState.Messages, tt.state.Messages)
+			assert.Equal(t, tt.wantState.Mailboxes, tt.state.Mailboxes)
 			assert.Equal(t, tt.wantState.Interrupts, tt.state.Interrupts)
 		})
 	}
@@ -141,16 +142,16 @@ func Test_State_EnqueueMessage(t *testing.T) {
 					"sender":    true,
 					"recipient": true,
 				},
-				Messages: map[string]chan Message{
-					"recipient": make(chan Message, MessageQueueMaxSize),
+				Mailboxes: map[string]*Mailbox{
+					"recipient": newMailbox(),
 				},
 				Connections: map[net.Conn]string{
 					&mockConn1: "sender",
 					&mockConn2: "recipient",
 				},
-				Interrupts: map[string]chan bool{
-					"sender":    make(chan bool, 1),
-					"recipient": make(chan bool, 1),
+				Interrupts: map[net.Conn]chan struct{}{
+					&mockConn1: make(chan struct{}),
+					&mockConn2: make(chan struct{}),
 				},
 			},
 			from:      "sender",
@@ -173,14 +174,14 @@ func Test_State_EnqueueMessage(t *testing.T) {
 					"sender":    true,
 					"recipient": true,
 				},
-				Messages: map[string]chan Message{},
+				Mailboxes: map[string]*Mailbox{},
 				Connections: map[net.Conn]string{
 					&mockConn1: "sender",
 					&mockConn2: "recipient",
 				},
-				Interrupts: map[string]chan bool{
-					"sender":    make(chan bool, 1),
-					"recipient": make(chan bool, 1),
+				Interrupts: map[net.Conn]chan struct{}{
+					&mockConn1: make(chan struct{}),
+					&mockConn2: make(chan struct{}),
 				},
 			},
 			from:      "sender",
@@ -203,13 +204,13 @@ func Test_State_EnqueueMessage(t *testing.T) {
 					"sender":    true,
 					"recipient": false,
 				},
-				Messages: map[string]chan Message{},
+				Mailboxes: map[string]*Mailbox{},
 				Connections: map[net.Conn]string{
 					&mockConn1: "sender",
 					&mockConn2: "recipient",
 				},
-				Interrupts: map[string]chan bool{
-					"sender": make(chan bool, 1),
+				Interrupts: map[net.Conn]chan struct{}{
+					&mockConn1: make(chan struct{}),
 				},
 			},
 			from:      "sender",
@@ -231,13 +232,13 @@ func Test_State_EnqueueMessage(t *testing.T) {
 				LoggedUsers: map[string]bool{
 					"sender": true,
 				},
-				Messages: map[string]chan Message{},
+				Mailboxes: map[string]*Mailbox{},
 				Connections: map[net.Conn]string{
 					&mockConn1: "sender",
 					&mockConn2: "recipient",
 				},
-				Interrupts: map[string]chan bool{
-					"sender": make(chan bool, 1),
+				Interrupts: map[net.Conn]chan struct{}{
+					&mockConn1: make(chan struct{}),
 				},
 			},
 			from:         "sender",
@@ -251,28 +252,284 @@ func Test_State_EnqueueMessage(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 
-			received := []Message{}
-			go collectReceived(tt.state.Messages, &received)
-
 			err := tt.state.EnqueueMessage(tt.from, tt.to, tt.timestamp, tt.message)
 
-			time.Sleep(20 * time.Millisecond)
-			assert.Equal(t, tt.wantMessages, received)
 			assert.Equal(t, tt.wantErr, err)
+			if err == nil {
+				assert.Equal(t, tt.wantMessages, tt.state.DrainMailbox(tt.to))
+			}
 		})
 	}
 }
 
-func collectReceived(msgsMap map[string]chan Message, received *[]Message) {
-
-	for {
-		msgs := msgsMap["recipient"]
-		if msgs == nil {
-			time.Sleep(10 * time.Millisecond)
-			continue
-		}
-		msg := <-msgs
-		*received = append(*received, msg)
-		msg.Print()
+func Test_State_Logout_InterruptsDelivery(t *testing.T) {
+	mockConn := net.TCPConn{}
+
+	s := NewState()
+	_ = s.Login(&mockConn, "user1")
+	interrupt := s.Interrupt(&mockConn)
+
+	s.Logout(&mockConn)
+
+	assert.True(t, isClosed(interrupt))
+	assert.Empty(t, s.Interrupts)
+
+	// a second logout on the same connection is a no-op
+	s.Logout(&mockConn)
+
+	assert.Equal(t, map[string]bool{"user1": false}, s.LoggedUsers)
+}
+
+func Test_State_Logout_LeavesTheOtherConnectionsAlone(t *testing.T) {
+	oldConn := net.TCPConn{}
+	newConn := net.TCPConn{}
+
+	// the user logs out of a connection, and logs in again on another one
+	// before the delivery to the first one is over
+	s := NewState()
+	_ = s.Login(&oldConn, "user1")
+	oldInterrupt := s.Interrupt(&oldConn)
+	s.Logout(&oldConn)
+	_ = s.Login(&newConn, "user1")
+	newInterrupt := s.Interrupt(&newConn)
+
+	assert.True(t, isClosed(oldInterrupt))
+	assert.False(t, isClosed(newInterrupt))
+
+	s.Logout(&newConn)
+
+	assert.True(t, isClosed(newInterrupt))
+}
+
+func Test_State_Interrupt(t *testing.T) {
+	mockConn := net.TCPConn{}
+
+	s := NewState()
+
+	// nobody is logged in on the connection, so there is nothing to deliver to it
+	assert.True(t, isClosed(s.Interrupt(&mockConn)))
+	assert.Empty(t, s.Interrupts)
+
+	_ = s.Login(&mockConn, "user1")
+	interrupt := s.Interrupt(&mockConn)
+
+	assert.False(t, isClosed(interrupt))
+	// the same channel is returned once created
+	assert.Equal(t, interrupt, s.Interrupt(&mockConn))
+}
+
+// isClosed tells if the channel is closed, without blocking
+func isClosed(c <-chan struct{}) bool {
+	select {
+	case <-c:
+		return true
+	default:
+		return false
 	}
 }
+
+func Test_State_Register(t *testing.T) {
+	fastPasswordHashing(t)
+	mockConn := net.TCPConn{}
+
+	s := NewState()
+	_ = s.Login(&mockConn, "passwordless")
+
+	require.NoError(t, s.Register("alice", "secret"))
+	assert.Equal(t, map[string]bool{"passwordless": true, "alice": false}, s.Users())
+	assert.True(t, s.Passwords["alice"].Verify("secret"))
+
+	assert.ErrorIs(t, s.Register("alice", "other"), ErrUsernameTaken)
+	assert.ErrorIs(t, s.Register("passwordless", "other"), ErrUsernameTaken)
+}
+
+func Test_State_LoginWithPassword(t *testing.T) {
+	fastPasswordHashing(t)
+	mockConn1 := net.TCPConn{}
+	mockConn2 := net.TCPConn{}
+
+	tests := []struct {
+		name     string
+		username string
+		password string
+		wantErr  error
+	}{
+		{
+			name:     "happy path: right password",
+			username: "alice",
+			password: "secret",
+		},
+		{
+			name:     "error: wrong password",
+			username: "alice",
+			password: "wrong",
+			wantErr:  ErrBadCredentials,
+		},
+		{
+			name:     "error: unknown user",
+			username: "bob",
+			password: "secret",
+			wantErr:  ErrBadCredentials,
+		},
+		{
+			name:     "error: user without password",
+			username: "passwordless",
+			password: "",
+			wantErr:  ErrBadCredentials,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			s := NewState()
+			require.NoError(t, s.Register("alice", "secret"))
+			require.NoError(t, s.Login(&mockConn2, "passwordless"))
+			s.Logout(&mockConn2)
+
+			err := s.LoginWithPassword(&mockConn1, tt.username, tt.password)
+
+			assert.ErrorIs(t, err, tt.wantErr)
+			username, loggedIn := s.Username(&mockConn1)
+			assert.Equal(t, tt.wantErr == nil, loggedIn)
+			if tt.wantErr == nil {
+				assert.Equal(t, tt.username, username)
+			}
+		})
+	}
+}
+
+func Test_State_LoginWithPassword_AlreadyOnline(t *testing.T) {
+	fastPasswordHashing(t)
+	mockConn1 := net.TCPConn{}
+	mockConn2 := net.TCPConn{}
+
+	s := NewState()
+	require.NoError(t, s.Register("alice", "secret"))
+	require.NoError(t, s.LoginWithPassword(&mockConn1, "alice", "secret"))
+
+	assert.ErrorIs(t, s.LoginWithPassword(&mockConn2, "alice", "secret"), ErrUserAlreadyOnline)
+	// the users with a password can't log in without it
+	s.Logout(&mockConn1)
+	assert.ErrorIs(t, s.Login(&mockConn2, "alice"), ErrBadCredentials)
+}
+
+func Test_State_Username(t *testing.T) {
+	mockConn1 := net.TCPConn{}
+	mockConn2 := net.TCPConn{}
+
+	s := NewState()
+	_ = s.Login(&mockConn1, "user1")
+
+	username, ok := s.Username(&mockConn1)
+	assert.True(t, ok)
+	assert.Equal(t, "user1", username)
+
+	_, ok = s.Username(&mockConn2)
+	assert.False(t, ok)
+}
+
+func Test_State_Mailbox(t *testing.T) {
+
+	s := NewState()
+
+	notify := s.Mailbox("user1")
+	assert.Equal(t, 1, cap(notify))
+
+	// the same channel is returned once created
+	assert.Equal(t, notify, s.Mailbox("user1"))
+}
+
+func Test_State_Mailbox_NotifiesQueuedMessages(t *testing.T) {
+	mockConn := net.TCPConn{}
+
+	s := NewState()
+	_ = s.Login(&mockConn, "recipient")
+	notify := s.Mailbox("recipient")
+
+	_ = s.EnqueueMessage("sender", "recipient", time.Unix(1, 0), "first")
+	_ = s.EnqueueMessage("sender", "recipient", time.Unix(2, 0), "second")
+
+	// the notifications don't pile up: one is enough to drain all the messages
+	assert.Len(t, notify, 1)
+	<-notify
+	assert.Len(t, s.DrainMailbox("recipient"), 2)
+}
+
+func Test_State_DrainMailbox(t *testing.T) {
+	mockConn := net.TCPConn{}
+
+	s := NewState()
+	_ = s.Login(&mockConn, "recipient")
+	_ = s.EnqueueMessage("sender", "recipient", time.Unix(3, 0), "third")
+	_ = s.EnqueueMessage("sender", "recipient", time.Unix(1, 0), "first")
+	_ = s.EnqueueMessage("sender", "recipient", time.Unix(2, 0), "second")
+
+	drained := s.DrainMailbox("recipient")
+
+	assert.Equal(t, []Message{
+		{From: "sender", Timestamp: time.Unix(1, 0), Payload: "first"},
+		{From: "sender", Timestamp: time.Unix(2, 0), Payload: "second"},
+		{From: "sender", Timestamp: time.Unix(3, 0), Payload: "third"},
+	}, drained)
+	assert.Empty(t, s.DrainMailbox("recipient"))
+}
+
+func Test_State_Users(t *testing.T) {
+	mockConn1 := net.TCPConn{}
+	mockConn2 := net.TCPConn{}
+
+	s := NewState()
+	_ = s.Login(&mockConn1, "user1")
+	_ = s.Login(&mockConn2, "user2")
+	s.Logout(&mockConn2)
+
+	users := s.Users()
+	assert.Equal(t, map[string]bool{"user1": true, "user2": false}, users)
+
+	// the snapshot is not affected by later changes
+	s.Logout(&mockConn1)
+	assert.Equal(t, map[string]bool{"user1": true, "user2": false}, users)
+}
+
+func Test_State_QueuedMessages(t *testing.T) {
+	mockConn1 := net.TCPConn{}
+	mockConn2 := net.TCPConn{}
+
+	s := NewState()
+	_ = s.Login(&mockConn1, "user1")
+	_ = s.Login(&mockConn2, "user2")
+	_ = s.EnqueueMessage("user2", "user1", time.Unix(1, 0), "first")
+	_ = s.EnqueueMessage("user2", "user1", time.Unix(2, 0), "second")
+	_ = s.EnqueueMessage("user1", "user2", time.Unix(3, 0), "third")
+	s.DrainMailbox("user2")
+
+	assert.Equal(t, map[string]int{"user1": 2, "user2": 0}, s.QueuedMessages())
+}
+
+func Test_NewStateWithMailboxSize(t *testing.T) {
+
+	s := NewStateWithMailboxSize(5)
+	assert.Equal(t, MailboxOptions{Size: 5}, s.mailbox)
+
+	assert.Equal(t, 5, s.mailboxSize())
+
+	s = NewStateWithMailboxSize(0)
+	assert.Equal(t, MessageQueueMaxSize, s.mailboxSize())
+}
+
+func Test_State_PutBack(t *testing.T) {
+	mockConn := net.TCPConn{}
+	first := Message{From: "sender", Timestamp: time.Unix(1, 0), Payload: "first"}
+	second := Message{From: "sender", Timestamp: time.Unix(2, 0), Payload: "second"}
+
+	s := NewStateWithMailboxSize(1)
+	_ = s.Login(&mockConn, "recipient")
+	_ = s.EnqueueMessage(first.From, "recipient", first.Timestamp, first.Payload)
+	drained := s.DrainMailbox("recipient")
+	_ = s.EnqueueMessage(second.From, "recipient", second.Timestamp, second.Payload)
+
+	// the messages put back are queued even if the mailbox is full
+	s.PutBack("recipient", drained)
+
+	assert.Equal(t, []Message{first, second}, s.DrainMailbox("recipient"))
+}
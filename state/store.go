@@ -0,0 +1,64 @@
+package state
+
+// User is a user known by the store
+type User struct {
+	Username string
+	// Password is nil for the users who logged in without a password
+	Password *PasswordHash
+}
+
+// Store persists the users and the messages waiting to be delivered,
+// so that they survive a restart of the server
+type Store interface {
+	// Load returns the users and the undelivered messages persisted so far
+	Load() (users []User, mailboxes map[string][]Message, err error)
+	AddUser(user User) error
+	AddMessage(to string, msg Message) error
+	// RemoveMessage is called once the message has been delivered to its recipient
+	RemoveMessage(to string, msg Message) error
+	// LastMessages returns the count messages added last for the user and not removed yet, oldest first.
+	// The messages spilled by OverflowSpill are read back with it.
+	LastMessages(to string, count int) ([]Message, error)
+	Close() error
+}
+
+// NewStateWithStore creates a state backed by the given store,
+// restoring the users (as offline) and their undelivered messages
+func NewStateWithStore(store Store, opts MailboxOptions) (*State, error) {
+
+	users, mailboxes, err := store.Load()
+	if err != nil {
+		return nil, err
+	}
+
+	s := NewStateWithMailboxOptions(opts)
+	s.store = store
+
+	for _, user := range users {
+		s.LoggedUsers[user.Username] = false
+		if user.Password != nil {
+			s.Passwords[user.Username] = *user.Password
+		}
+	}
+
+	// the mailboxes hold all the messages restored, even if they exceed their usual size,
+	// unless they spill: then the ones beyond the size are left in the store
+	for to, msgs := range mailboxes {
+		mailbox := s.mailboxOf(to)
+		if opts.OverflowPolicy == OverflowSpill && len(msgs) > s.mailboxSize() {
+			mailbox.spilled = len(msgs) - s.mailboxSize()
+			msgs = msgs[:s.mailboxSize()]
+		}
+		mailbox.messages = append(mailbox.messages, msgs...)
+	}
+
+	return s, nil
+}
+
+// Close releases the store backing the state, if any
+func (s *State) Close() error {
+	if s.store == nil {
+		return nil
+	}
+	return s.store.Close()
+}
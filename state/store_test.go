@@ -0,0 +1,118 @@
+package state
+
+import (
+	"net"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type mockStore struct {
+	users     []User
+	mailboxes map[string][]Message
+	added     []Message
+	removed   []Message
+	// err is returned by LastMessages
+	err error
+}
+
+func (ms *mockStore) Load() ([]User, map[string][]Message, error) {
+	return ms.users, ms.mailboxes, nil
+}
+
+func (ms *mockStore) AddUser(user User) error {
+	ms.users = append(ms.users, user)
+	return nil
+}
+
+func (ms *mockStore) AddMessage(to string, msg Message) error {
+	ms.added = append(ms.added, msg)
+	if ms.mailboxes == nil {
+		ms.mailboxes = map[string][]Message{}
+	}
+	ms.mailboxes[to] = append(ms.mailboxes[to], msg)
+	return nil
+}
+
+func (ms *mockStore) RemoveMessage(to string, msg Message) error {
+	ms.removed = append(ms.removed, msg)
+	i := slices.Index(ms.mailboxes[to], msg)
+	if i >= 0 {
+		ms.mailboxes[to] = slices.Delete(ms.mailboxes[to], i, i+1)
+	}
+	return nil
+}
+
+func (ms *mockStore) LastMessages(to string, count int) ([]Message, error) {
+	if ms.err != nil {
+		return nil, ms.err
+	}
+	msgs := ms.mailboxes[to]
+	return slices.Clone(msgs[max(len(msgs)-count, 0):]), nil
+}
+
+func (ms *mockStore) Close() error {
+	return nil
+}
+
+func Test_NewStateWithStore(t *testing.T) {
+	msg := Message{From: "alice", Timestamp: time.Unix(1, 0), Payload: "hello"}
+	password := PasswordHash{Salt: []byte("salt"), Iterations: 1, Hash: []byte("hash")}
+	store := &mockStore{
+		users: []User{{Username: "alice"}, {Username: "bob", Password: &password}},
+		mailboxes: map[string][]Message{
+			"bob": {msg},
+		},
+	}
+
+	s, err := NewStateWithStore(store, MailboxOptions{})
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string]bool{"alice": false, "bob": false}, s.LoggedUsers)
+	assert.Equal(t, map[string]PasswordHash{"bob": password}, s.Passwords)
+	assert.Equal(t, []Message{msg}, s.DrainMailbox("bob"))
+}
+
+func Test_NewStateWithStore_Spilled(t *testing.T) {
+	msgs := []Message{
+		{From: "alice", Timestamp: time.Unix(1, 0), Payload: "first"},
+		{From: "alice", Timestamp: time.Unix(2, 0), Payload: "second"},
+		{From: "alice", Timestamp: time.Unix(3, 0), Payload: "third"},
+	}
+	store := &mockStore{
+		users:     []User{{Username: "bob"}},
+		mailboxes: map[string][]Message{"bob": slices.Clone(msgs)},
+	}
+
+	s, err := NewStateWithStore(store, MailboxOptions{Size: 1, OverflowPolicy: OverflowSpill})
+	require.NoError(t, err)
+
+	// the messages beyond the size are left in the store, as if they had been spilled
+	assert.Equal(t, msgs[:1], s.Mailboxes["bob"].messages)
+	assert.Equal(t, 3, s.Mailboxes["bob"].Len())
+	assert.Equal(t, msgs, s.DrainMailbox("bob"))
+}
+
+func Test_State_PersistsChanges(t *testing.T) {
+	mockConn := net.TCPConn{}
+	msg := Message{From: "alice", Timestamp: time.Unix(1, 0), Payload: "hello"}
+	store := &mockStore{}
+
+	s, err := NewStateWithStore(store, MailboxOptions{})
+	require.NoError(t, err)
+
+	require.NoError(t, s.Login(&mockConn, "bob"))
+	s.Logout(&mockConn)
+	require.NoError(t, s.Login(&mockConn, "bob"))
+	require.NoError(t, s.EnqueueMessage(msg.From, "bob", msg.Timestamp, msg.Payload))
+	delivery := s.Deliver("bob", s.DrainMailbox("bob")[0])
+	s.Acknowledge("bob", delivery.Sequence)
+
+	// the user is persisted only the first time they log in
+	assert.Equal(t, []User{{Username: "bob"}}, store.users)
+	assert.Equal(t, []Message{msg}, store.added)
+	assert.Equal(t, []Message{msg}, store.removed)
+}
@@ -0,0 +1,163 @@
+package state
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"net"
+	"time"
+)
+
+const (
+	tokenNonceLength = 16
+	// tokenHeaderLength is the length of the expiry and the nonce, before the username
+	tokenHeaderLength = 8 + tokenNonceLength
+)
+
+var (
+	ErrTokensDisabled = errors.New("session tokens disabled")
+	ErrInvalidToken   = errors.New("invalid session token")
+)
+
+// TokenOptions configures the session tokens, which let a user whose connection dropped
+// resume their session on a new one, without logging in again
+type TokenOptions struct {
+	// Key signs the tokens with HMAC-SHA256
+	Key []byte
+	// TTL is how long a token is valid after being issued
+	TTL time.Duration
+	// Grace is how long after the connection dropped the session can be resumed
+	Grace time.Duration
+}
+
+// resumableSession is the last session of a user, which their latest token can resume
+type resumableSession struct {
+	nonce []byte
+	// disconnectedAt is zero while the user is connected
+	disconnectedAt time.Time
+}
+
+// EnableTokens makes the state issue session tokens with the given options.
+// It must be called before the state is used.
+func (s *State) EnableTokens(opts TokenOptions) {
+	s.tokens = &opts
+	s.sessions = map[string]*resumableSession{}
+}
+
+// IssueToken returns a new token resuming the current session of the user, along with its expiry.
+// The tokens issued before to the same user can't be used anymore.
+func (s *State) IssueToken(username string) (string, time.Time, error) {
+
+	if s.tokens == nil {
+		return "", time.Time{}, ErrTokensDisabled
+	}
+
+	nonce := make([]byte, tokenNonceLength)
+	_, err := rand.Read(nonce)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	expiresAt := s.now().Add(s.tokens.TTL)
+
+	s.mutex.Lock()
+	s.sessions[username] = &resumableSession{nonce: nonce}
+	s.mutex.Unlock()
+
+	return s.signToken(expiresAt, nonce, username), expiresAt, nil
+}
+
+// Resume logs the user of the token in on the connection, if their previous connection dropped
+// within the grace period. The token can't be used again: a new one must be issued.
+func (s *State) Resume(conn net.Conn, token string) (string, error) {
+
+	if s.tokens == nil {
+		return "", ErrTokensDisabled
+	}
+
+	expiresAt, nonce, username, err := s.parseToken(token)
+	if err != nil {
+		return "", err
+	}
+
+	now := s.now()
+	if !now.Before(expiresAt) {
+		return "", ErrInvalidToken
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	session, ok := s.sessions[username]
+	if !ok || !hmac.Equal(session.nonce, nonce) {
+		return "", ErrInvalidToken
+	}
+	if s.LoggedUsers[username] {
+		return "", ErrUserAlreadyOnline
+	}
+	if session.disconnectedAt.IsZero() || now.Sub(session.disconnectedAt) > s.tokens.Grace {
+		return "", ErrInvalidToken
+	}
+
+	delete(s.sessions, username)
+	s.LoggedUsers[username] = true
+	s.Connections[conn] = username
+
+	return username, nil
+}
+
+// RevokeTokens makes the tokens issued to the user unusable, e.g. when they log out on purpose
+func (s *State) RevokeTokens(username string) {
+	s.mutex.Lock()
+	delete(s.sessions, username)
+	s.mutex.Unlock()
+}
+
+// sessionDisconnected starts the grace period of the session of the user, if they have one.
+// It must be called holding the mutex.
+func (s *State) sessionDisconnected(username string) {
+	session, ok := s.sessions[username]
+	if ok {
+		session.disconnectedAt = s.now()
+	}
+}
+
+// signToken encodes the token as base64 of: expiry (unix nanoseconds), nonce, username, HMAC of all of them
+func (s *State) signToken(expiresAt time.Time, nonce []byte, username string) string {
+
+	var payload bytes.Buffer
+	_ = binary.Write(&payload, binary.BigEndian, expiresAt.UnixNano())
+	payload.Write(nonce)
+	payload.WriteString(username)
+
+	mac := hmac.New(sha256.New, s.tokens.Key)
+	mac.Write(payload.Bytes())
+
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(payload.Bytes()))
+}
+
+func (s *State) parseToken(token string) (time.Time, []byte, string, error) {
+
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil || len(raw) < tokenHeaderLength+sha256.Size {
+		return time.Time{}, nil, "", ErrInvalidToken
+	}
+
+	payload, signature := raw[:len(raw)-sha256.Size], raw[len(raw)-sha256.Size:]
+
+	mac := hmac.New(sha256.New, s.tokens.Key)
+	mac.Write(payload)
+	if !hmac.Equal(mac.Sum(nil), signature) {
+		return time.Time{}, nil, "", ErrInvalidToken
+	}
+
+	expiresAt := time.Unix(0, int64(binary.BigEndian.Uint64(payload[:8])))
+	nonce := payload[8:tokenHeaderLength]
+	username := string(payload[tokenHeaderLength:])
+
+	return expiresAt, nonce, username, nil
+}
@@ -0,0 +1,175 @@
+package state
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// tokenState returns a state issuing tokens, whose clock is moved forward by advancing it
+func tokenState(t *testing.T) (*State, func(time.Duration)) {
+	t.Helper()
+
+	s := NewState()
+	now := time.Unix(1_700_000_000, 0)
+	s.now = func() time.Time { return now }
+	s.EnableTokens(TokenOptions{Key: []byte("key"), TTL: time.Hour, Grace: time.Minute})
+
+	return s, func(d time.Duration) { now = now.Add(d) }
+}
+
+func Test_State_IssueToken(t *testing.T) {
+	s, _ := tokenState(t)
+
+	token, expiresAt, err := s.IssueToken("alice")
+
+	require.NoError(t, err)
+	assert.NotEmpty(t, token)
+	assert.Equal(t, time.Unix(1_700_000_000, 0).Add(time.Hour), expiresAt)
+}
+
+func Test_State_IssueToken_Disabled(t *testing.T) {
+	s := NewState()
+
+	_, _, err := s.IssueToken("alice")
+
+	assert.Equal(t, ErrTokensDisabled, err)
+}
+
+func Test_State_Resume(t *testing.T) {
+	oldConn := net.TCPConn{}
+	newConn := net.TCPConn{}
+
+	tests := []struct {
+		name string
+		// prepare runs after alice logged in on oldConn and got a token
+		prepare func(s *State, advance func(time.Duration), token string) string
+		wantErr error
+	}{
+		{
+			name: "happy path",
+			prepare: func(s *State, advance func(time.Duration), token string) string {
+				s.Logout(&oldConn)
+				advance(time.Minute)
+				return token
+			},
+			wantErr: nil,
+		},
+		{
+			name: "error: the user is still online",
+			prepare: func(s *State, advance func(time.Duration), token string) string {
+				return token
+			},
+			wantErr: ErrUserAlreadyOnline,
+		},
+		{
+			name: "error: grace period over",
+			prepare: func(s *State, advance func(time.Duration), token string) string {
+				s.Logout(&oldConn)
+				advance(time.Minute + time.Second)
+				return token
+			},
+			wantErr: ErrInvalidToken,
+		},
+		{
+			name: "error: token expired",
+			prepare: func(s *State, advance func(time.Duration), token string) string {
+				advance(time.Hour)
+				s.Logout(&oldConn)
+				return token
+			},
+			wantErr: ErrInvalidToken,
+		},
+		{
+			name: "error: token replaced by a newer one",
+			prepare: func(s *State, advance func(time.Duration), token string) string {
+				_, _, err := s.IssueToken("alice")
+				require.NoError(t, err)
+				s.Logout(&oldConn)
+				return token
+			},
+			wantErr: ErrInvalidToken,
+		},
+		{
+			name: "error: token revoked",
+			prepare: func(s *State, advance func(time.Duration), token string) string {
+				s.RevokeTokens("alice")
+				s.Logout(&oldConn)
+				return token
+			},
+			wantErr: ErrInvalidToken,
+		},
+		{
+			name: "error: token tampered with",
+			prepare: func(s *State, advance func(time.Duration), token string) string {
+				s.Logout(&oldConn)
+				// the first character encodes the top bits of the expiry
+				first := "A"
+				if token[0] == 'A' {
+					first = "B"
+				}
+				return first + token[1:]
+			},
+			wantErr: ErrInvalidToken,
+		},
+		{
+			name: "error: not a token",
+			prepare: func(s *State, advance func(time.Duration), token string) string {
+				s.Logout(&oldConn)
+				return "not a token"
+			},
+			wantErr: ErrInvalidToken,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, advance := tokenState(t)
+			require.NoError(t, s.Login(&oldConn, "alice"))
+			token, _, err := s.IssueToken("alice")
+			require.NoError(t, err)
+
+			username, err := s.Resume(&newConn, tt.prepare(s, advance, token))
+
+			assert.Equal(t, tt.wantErr, err)
+			if tt.wantErr == nil {
+				assert.Equal(t, "alice", username)
+				assert.Equal(t, map[net.Conn]string{&newConn: "alice"}, s.Connections)
+				assert.True(t, s.LoggedUsers["alice"])
+			}
+		})
+	}
+}
+
+func Test_State_Resume_SingleUse(t *testing.T) {
+	conn := net.TCPConn{}
+	s, _ := tokenState(t)
+	require.NoError(t, s.Login(&conn, "alice"))
+	token, _, err := s.IssueToken("alice")
+	require.NoError(t, err)
+	s.Logout(&conn)
+
+	_, err = s.Resume(&conn, token)
+	require.NoError(t, err)
+	s.Logout(&conn)
+
+	_, err = s.Resume(&conn, token)
+	assert.Equal(t, ErrInvalidToken, err)
+}
+
+func Test_State_Resume_OtherKey(t *testing.T) {
+	conn := net.TCPConn{}
+	s, _ := tokenState(t)
+	require.NoError(t, s.Login(&conn, "alice"))
+	token, _, err := s.IssueToken("alice")
+	require.NoError(t, err)
+	s.Logout(&conn)
+
+	// e.g. the server restarted with a new random key
+	s.tokens.Key = []byte("other key")
+
+	_, err = s.Resume(&conn, token)
+	assert.Equal(t, ErrInvalidToken, err)
+}
@@ -0,0 +1,417 @@
+package storage
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"tcpserver/state"
+	"time"
+)
+
+const (
+	journalFileName  = "journal.log"
+	snapshotFileName = "snapshot.json"
+)
+
+const (
+	opAddUser       = "add_user"
+	opAddMessage    = "add_message"
+	opRemoveMessage = "remove_message"
+)
+
+var (
+	ErrStoreClosed = errors.New("store closed")
+)
+
+// record is a line of the journal, describing a single change
+type record struct {
+	Seq     uint64         `json:"seq"`
+	Op      string         `json:"op"`
+	User    string         `json:"user"`
+	Message *storedMessage `json:"message,omitempty"`
+	// Password is set when adding a user who registered with a password
+	Password *state.PasswordHash `json:"password,omitempty"`
+}
+
+// snapshot is the content of the whole store, up to the journal record with sequence Seq
+type snapshot struct {
+	Seq       uint64                        `json:"seq"`
+	Users     []string                      `json:"users"`
+	Passwords map[string]state.PasswordHash `json:"passwords,omitempty"`
+	Mailboxes map[string][]storedMessage    `json:"mailboxes"`
+}
+
+// storedMessage is a state.Message as written in the files. Its payload is written as bytes (base64 in JSON),
+// since a JSON string would replace the bytes that aren't valid UTF-8.
+type storedMessage struct {
+	From      string
+	Timestamp time.Time
+	Data      []byte
+	// Payload is only set in the files written before Data, whose payloads are read back as they are
+	Payload string `json:",omitempty"`
+}
+
+func newStoredMessage(msg state.Message) storedMessage {
+	return storedMessage{
+		From:      msg.From,
+		Timestamp: msg.Timestamp,
+		Data:      []byte(msg.Payload),
+	}
+}
+
+func (sm storedMessage) message() state.Message {
+	payload := sm.Payload
+	if sm.Data != nil {
+		payload = string(sm.Data)
+	}
+
+	return state.Message{
+		From:      sm.From,
+		Timestamp: sm.Timestamp,
+		Payload:   payload,
+	}
+}
+
+// FileStore is a state.Store persisting the changes in an append-only journal.
+// The journal gets periodically compacted into a snapshot of the whole store,
+// so that it doesn't grow forever.
+type FileStore struct {
+	mutex   sync.Mutex
+	dir     string
+	journal *os.File
+	data    snapshot
+	closed  bool
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+// OpenFileStore opens the store kept in the given directory, creating it if needed,
+// and replays its snapshot and journal. A compactionInterval of 0 disables the periodic compaction.
+func OpenFileStore(dir string, compactionInterval time.Duration) (*FileStore, error) {
+
+	err := os.MkdirAll(dir, 0o700)
+	if err != nil {
+		return nil, err
+	}
+
+	fs := &FileStore{
+		dir: dir,
+		data: snapshot{
+			Users:     []string{},
+			Passwords: map[string]state.PasswordHash{},
+			Mailboxes: map[string][]storedMessage{},
+		},
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+
+	err = fs.readSnapshot()
+	if err != nil {
+		return nil, err
+	}
+
+	err = fs.replayJournal()
+	if err != nil {
+		return nil, err
+	}
+
+	fs.journal, err = os.OpenFile(fs.path(journalFileName), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, err
+	}
+
+	if compactionInterval > 0 {
+		go fs.compactPeriodically(compactionInterval)
+	} else {
+		close(fs.done)
+	}
+
+	return fs, nil
+}
+
+func (fs *FileStore) Load() ([]state.User, map[string][]state.Message, error) {
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+
+	users := make([]state.User, 0, len(fs.data.Users))
+	for _, username := range fs.data.Users {
+		user := state.User{Username: username}
+		if password, ok := fs.data.Passwords[username]; ok {
+			user.Password = &password
+		}
+		users = append(users, user)
+	}
+
+	mailboxes := make(map[string][]state.Message, len(fs.data.Mailboxes))
+	for to, stored := range fs.data.Mailboxes {
+		mailboxes[to] = messages(stored)
+	}
+
+	return users, mailboxes, nil
+}
+
+func (fs *FileStore) LastMessages(to string, count int) ([]state.Message, error) {
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+
+	stored := fs.data.Mailboxes[to]
+	return messages(stored[max(len(stored)-count, 0):]), nil
+}
+
+func messages(stored []storedMessage) []state.Message {
+	msgs := make([]state.Message, 0, len(stored))
+	for _, sm := range stored {
+		msgs = append(msgs, sm.message())
+	}
+	return msgs
+}
+
+func (fs *FileStore) AddUser(user state.User) error {
+	return fs.append(record{Op: opAddUser, User: user.Username, Password: user.Password})
+}
+
+func (fs *FileStore) AddMessage(to string, msg state.Message) error {
+	sm := newStoredMessage(msg)
+	return fs.append(record{Op: opAddMessage, User: to, Message: &sm})
+}
+
+func (fs *FileStore) RemoveMessage(to string, msg state.Message) error {
+	sm := newStoredMessage(msg)
+	return fs.append(record{Op: opRemoveMessage, User: to, Message: &sm})
+}
+
+// Compact writes a snapshot of the whole store and empties the journal
+func (fs *FileStore) Compact() error {
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+
+	if fs.closed {
+		return ErrStoreClosed
+	}
+
+	return fs.compact()
+}
+
+// Close compacts the store one last time and releases its files
+func (fs *FileStore) Close() error {
+	fs.mutex.Lock()
+	if fs.closed {
+		fs.mutex.Unlock()
+		return nil
+	}
+	fs.closed = true
+	close(fs.stop)
+	fs.mutex.Unlock()
+
+	<-fs.done
+
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+
+	cErr := fs.compact()
+	return errors.Join(cErr, fs.journal.Close())
+}
+
+func (fs *FileStore) compactPeriodically(interval time.Duration) {
+	defer close(fs.done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-fs.stop:
+			return
+		case <-ticker.C:
+			err := fs.Compact()
+			if err != nil {
+				slog.Error("compacting the store", "error", err)
+			}
+		}
+	}
+}
+
+// append writes the record on the journal and applies it to the data in memory.
+// The journal is not synced on every write: the records written survive a crash
+// of the server, but not a crash of the whole machine.
+func (fs *FileStore) append(r record) error {
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+
+	if fs.closed {
+		return ErrStoreClosed
+	}
+
+	r.Seq = fs.data.Seq + 1
+
+	line, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+
+	_, err = fs.journal.Write(append(line, '\n'))
+	if err != nil {
+		return err
+	}
+
+	fs.apply(r)
+
+	return nil
+}
+
+func (fs *FileStore) apply(r record) {
+
+	fs.data.Seq = r.Seq
+
+	switch r.Op {
+	case opAddUser:
+		if !slices.Contains(fs.data.Users, r.User) {
+			fs.data.Users = append(fs.data.Users, r.User)
+		}
+		if r.Password != nil {
+			fs.data.Passwords[r.User] = *r.Password
+		}
+
+	case opAddMessage:
+		fs.data.Mailboxes[r.User] = append(fs.data.Mailboxes[r.User], *r.Message)
+
+	case opRemoveMessage:
+		// identical messages are interchangeable, so the first one matching gets removed
+		removed := r.Message.message()
+		msgs := fs.data.Mailboxes[r.User]
+		i := slices.IndexFunc(msgs, func(sm storedMessage) bool {
+			m := sm.message()
+			return m.From == removed.From &&
+				m.Payload == removed.Payload &&
+				m.Timestamp.Equal(removed.Timestamp)
+		})
+		if i < 0 {
+			return
+		}
+
+		msgs = slices.Delete(msgs, i, i+1)
+		if len(msgs) == 0 {
+			delete(fs.data.Mailboxes, r.User)
+			return
+		}
+		fs.data.Mailboxes[r.User] = msgs
+	}
+}
+
+func (fs *FileStore) readSnapshot() error {
+
+	content, err := os.ReadFile(fs.path(snapshotFileName))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	err = json.Unmarshal(content, &fs.data)
+	if err != nil {
+		return fmt.Errorf("corrupted snapshot: %w", err)
+	}
+
+	// the snapshots written before the passwords were introduced don't have them
+	if fs.data.Passwords == nil {
+		fs.data.Passwords = map[string]state.PasswordHash{}
+	}
+	if fs.data.Mailboxes == nil {
+		fs.data.Mailboxes = map[string][]storedMessage{}
+	}
+
+	return nil
+}
+
+func (fs *FileStore) replayJournal() error {
+
+	journal, err := os.Open(fs.path(journalFileName))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer journal.Close()
+
+	var validSize int64
+	reader := bufio.NewReader(journal)
+	for {
+		line, rErr := reader.ReadBytes('\n')
+
+		// a last line without the newline is a record that was being written
+		// when the server stopped: it gets dropped, so that the next records
+		// aren't appended to it
+		if rErr == io.EOF && len(line) > 0 {
+			return os.Truncate(fs.path(journalFileName), validSize)
+		}
+		if rErr == io.EOF {
+			return nil
+		}
+		if rErr != nil {
+			return rErr
+		}
+		validSize += int64(len(line))
+
+		var r record
+		err = json.Unmarshal(line, &r)
+		if err != nil {
+			return fmt.Errorf("corrupted journal: %w", err)
+		}
+
+		// the records already part of the snapshot are skipped: they are still in the journal
+		// if the server stopped after writing the snapshot, but before emptying the journal
+		if r.Seq <= fs.data.Seq {
+			continue
+		}
+
+		fs.apply(r)
+	}
+}
+
+// compact must be called holding the mutex
+func (fs *FileStore) compact() error {
+
+	content, err := json.Marshal(fs.data)
+	if err != nil {
+		return err
+	}
+
+	// the snapshot is replaced atomically, so that a crash never leaves it half written
+	tmpPath := fs.path(snapshotFileName + ".tmp")
+	tmp, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+
+	_, err = tmp.Write(content)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	cErr := tmp.Close()
+	if err != nil {
+		return err
+	}
+	if cErr != nil {
+		return cErr
+	}
+
+	err = os.Rename(tmpPath, fs.path(snapshotFileName))
+	if err != nil {
+		return err
+	}
+
+	return fs.journal.Truncate(0)
+}
+
+func (fs *FileStore) path(name string) string {
+	return filepath.Join(fs.dir, name)
+}
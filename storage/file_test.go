@@ -0,0 +1,250 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"tcpserver/state"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_FileStore_Replay(t *testing.T) {
+	msg1 := state.Message{From: "alice", Timestamp: time.Unix(1, 0), Payload: "first"}
+	// the payloads can be any bytes, not only valid UTF-8
+	msg2 := state.Message{From: "alice", Timestamp: time.Unix(2, 0), Payload: "second\xff\xfe\x00"}
+	password := state.PasswordHash{Salt: []byte("salt"), Iterations: 1, Hash: []byte("hash")}
+
+	tests := []struct {
+		name          string
+		compact       bool
+		wantUsers     []state.User
+		wantMailboxes map[string][]state.Message
+	}{
+		{
+			name:      "happy path: replay from the journal",
+			compact:   false,
+			wantUsers: []state.User{{Username: "alice", Password: &password}, {Username: "bob"}},
+			wantMailboxes: map[string][]state.Message{
+				"bob": {msg2},
+			},
+		},
+		{
+			name:      "happy path: replay from the snapshot",
+			compact:   true,
+			wantUsers: []state.User{{Username: "alice", Password: &password}, {Username: "bob"}},
+			wantMailboxes: map[string][]state.Message{
+				"bob": {msg2},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			dir := t.TempDir()
+
+			fs, err := OpenFileStore(dir, 0)
+			require.NoError(t, err)
+
+			require.NoError(t, fs.AddUser(state.User{Username: "alice", Password: &password}))
+			require.NoError(t, fs.AddUser(state.User{Username: "bob"}))
+			require.NoError(t, fs.AddMessage("bob", msg1))
+			require.NoError(t, fs.AddMessage("bob", msg2))
+			require.NoError(t, fs.RemoveMessage("bob", msg1))
+			if tt.compact {
+				require.NoError(t, fs.Compact())
+			}
+
+			// the store is not closed, as if the server crashed
+			require.NoError(t, fs.journal.Close())
+
+			reopened, err := OpenFileStore(dir, 0)
+			require.NoError(t, err)
+			defer reopened.Close()
+
+			users, mailboxes, err := reopened.Load()
+			assert.Equal(t, tt.wantUsers, users)
+			assert.Equal(t, len(tt.wantMailboxes), len(mailboxes))
+			for to, msgs := range tt.wantMailboxes {
+				assert.Len(t, mailboxes[to], len(msgs))
+				for i := range msgs {
+					assert.Equal(t, msgs[i].From, mailboxes[to][i].From)
+					assert.Equal(t, msgs[i].Payload, mailboxes[to][i].Payload)
+					assert.True(t, msgs[i].Timestamp.Equal(mailboxes[to][i].Timestamp))
+				}
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func Test_FileStore_TextPayloads(t *testing.T) {
+	dir := t.TempDir()
+
+	// the files written before the payloads were stored as bytes hold them as text
+	require.NoError(t, os.WriteFile(filepath.Join(dir, snapshotFileName), []byte(`{"seq":2,"users":["bob"],`+
+		`"mailboxes":{"bob":[{"From":"alice","Timestamp":"1970-01-01T00:00:01Z","Payload":"first"}]}}`), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, journalFileName), []byte(
+		`{"seq":3,"op":"add_message","user":"bob","message":{"From":"alice","Timestamp":"1970-01-01T00:00:02Z","Payload":"second"}}`+"\n"+
+			`{"seq":4,"op":"remove_message","user":"bob","message":{"From":"alice","Timestamp":"1970-01-01T00:00:01Z","Payload":"first"}}`+"\n"), 0o600))
+
+	fs, err := OpenFileStore(dir, 0)
+	require.NoError(t, err)
+	defer fs.Close()
+
+	_, mailboxes, err := fs.Load()
+	require.NoError(t, err)
+	require.Len(t, mailboxes["bob"], 1)
+	assert.Equal(t, "alice", mailboxes["bob"][0].From)
+	assert.Equal(t, "second", mailboxes["bob"][0].Payload)
+	assert.True(t, time.Unix(2, 0).Equal(mailboxes["bob"][0].Timestamp))
+
+	// the messages written from now on are removed all the same
+	require.NoError(t, fs.RemoveMessage("bob", mailboxes["bob"][0]))
+	_, mailboxes, err = fs.Load()
+	require.NoError(t, err)
+	assert.Empty(t, mailboxes)
+}
+
+func Test_FileStore_LastMessages(t *testing.T) {
+	msgs := []state.Message{
+		{From: "alice", Timestamp: time.Unix(1, 0), Payload: "first"},
+		{From: "alice", Timestamp: time.Unix(2, 0), Payload: "second"},
+		{From: "alice", Timestamp: time.Unix(3, 0), Payload: "third"},
+	}
+
+	fs, err := OpenFileStore(t.TempDir(), 0)
+	require.NoError(t, err)
+	defer fs.Close()
+
+	for _, msg := range msgs {
+		require.NoError(t, fs.AddMessage("bob", msg))
+	}
+	require.NoError(t, fs.RemoveMessage("bob", msgs[0]))
+
+	tests := []struct {
+		name  string
+		to    string
+		count int
+		want  []state.Message
+	}{
+		{
+			name:  "happy path: the last ones, oldest first",
+			to:    "bob",
+			count: 1,
+			want:  msgs[2:],
+		},
+		{
+			name:  "happy path: more than there are",
+			to:    "bob",
+			count: 5,
+			want:  msgs[1:],
+		},
+		{
+			name:  "happy path: unknown user",
+			to:    "carol",
+			count: 1,
+			want:  []state.Message{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			got, err := fs.LastMessages(tt.to, tt.count)
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func Test_FileStore_Close(t *testing.T) {
+
+	dir := t.TempDir()
+
+	fs, err := OpenFileStore(dir, time.Hour)
+	require.NoError(t, err)
+	require.NoError(t, fs.AddUser(state.User{Username: "alice"}))
+
+	require.NoError(t, fs.Close())
+
+	// closing compacts the journal into the snapshot
+	journal, err := os.ReadFile(filepath.Join(dir, journalFileName))
+	require.NoError(t, err)
+	assert.Empty(t, journal)
+
+	assert.Equal(t, ErrStoreClosed, fs.AddUser(state.User{Username: "bob"}))
+	assert.NoError(t, fs.Close())
+
+	reopened, err := OpenFileStore(dir, 0)
+	require.NoError(t, err)
+	defer reopened.Close()
+
+	users, _, err := reopened.Load()
+	assert.Equal(t, []state.User{{Username: "alice"}}, users)
+	assert.NoError(t, err)
+}
+
+func Test_FileStore_JournalAlreadyInSnapshot(t *testing.T) {
+
+	dir := t.TempDir()
+
+	fs, err := OpenFileStore(dir, 0)
+	require.NoError(t, err)
+	require.NoError(t, fs.AddMessage("bob", state.Message{From: "alice", Payload: "hello"}))
+
+	journal, err := os.ReadFile(filepath.Join(dir, journalFileName))
+	require.NoError(t, err)
+
+	// simulate a crash after writing the snapshot, but before emptying the journal
+	require.NoError(t, fs.Close())
+	require.NoError(t, os.WriteFile(filepath.Join(dir, journalFileName), journal, 0o600))
+
+	reopened, err := OpenFileStore(dir, 0)
+	require.NoError(t, err)
+	defer reopened.Close()
+
+	_, mailboxes, err := reopened.Load()
+	assert.Len(t, mailboxes["bob"], 1)
+	assert.NoError(t, err)
+}
+
+func Test_FileStore_TruncatedJournal(t *testing.T) {
+
+	dir := t.TempDir()
+
+	fs, err := OpenFileStore(dir, 0)
+	require.NoError(t, err)
+	require.NoError(t, fs.AddUser(state.User{Username: "alice"}))
+
+	// simulate a crash while writing a record
+	_, err = fs.journal.WriteString(`{"seq":2,"op":"add_us`)
+	require.NoError(t, err)
+	require.NoError(t, fs.journal.Close())
+
+	reopened, err := OpenFileStore(dir, 0)
+	require.NoError(t, err)
+	require.NoError(t, reopened.AddUser(state.User{Username: "bob"}))
+	require.NoError(t, reopened.journal.Close())
+
+	// the partial record has been dropped, so the next ones are still readable
+	again, err := OpenFileStore(dir, 0)
+	require.NoError(t, err)
+	defer again.Close()
+
+	users, _, err := again.Load()
+	assert.Equal(t, []state.User{{Username: "alice"}, {Username: "bob"}}, users)
+	assert.NoError(t, err)
+}
+
+func Test_FileStore_CorruptedJournal(t *testing.T) {
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, journalFileName), []byte("not json\n"), 0o600))
+
+	_, err := OpenFileStore(dir, 0)
+
+	assert.ErrorContains(t, err, "corrupted journal")
+}
@@ -0,0 +1,94 @@
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"sync/atomic"
+)
+
+var (
+	ErrNoClientCAs = errors.New("no certificate found")
+)
+
+// Options holds the files the TLS config is loaded from
+type Options struct {
+	CertFile string
+	KeyFile  string
+	// ClientCAFile is optional: when set, the clients must present a certificate signed by one of its CAs
+	ClientCAFile string
+}
+
+// Reloader serves a TLS config whose files can be reloaded while the listener is running:
+// the connections established after a reload get the new certificate, the others keep the old one.
+type Reloader struct {
+	opts    Options
+	current atomic.Pointer[tls.Config]
+}
+
+// NewReloader loads the TLS config from the files in opts
+func NewReloader(opts Options) (*Reloader, error) {
+
+	r := &Reloader{opts: opts}
+
+	err := r.Reload()
+	if err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// Reload reads the files again. If any of them is invalid, the previous config is kept.
+func (r *Reloader) Reload() error {
+
+	cert, err := tls.LoadX509KeyPair(r.opts.CertFile, r.opts.KeyFile)
+	if err != nil {
+		return fmt.Errorf("loading certificate: %w", err)
+	}
+
+	cfg := &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{cert},
+	}
+
+	if r.opts.ClientCAFile != "" {
+		pool, pErr := loadCertPool(r.opts.ClientCAFile)
+		if pErr != nil {
+			return fmt.Errorf("loading client CAs: %w", pErr)
+		}
+		cfg.ClientCAs = pool
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	r.current.Store(cfg)
+
+	return nil
+}
+
+// Config returns the config to listen with, which follows the reloads
+func (r *Reloader) Config() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			return r.current.Load(), nil
+		},
+	}
+}
+
+func loadCertPool(path string) (*x509.CertPool, error) {
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(content) {
+		return nil, fmt.Errorf("%w in %s", ErrNoClientCAs, path)
+	}
+
+	return pool, nil
+}
@@ -0,0 +1,279 @@
+package tlsconfig
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_NewReloader(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t)
+	ca.issue(t, dir, "server", "v1")
+	ca.writeCA(t, dir, "ca")
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "empty.pem"), []byte("nothing here"), 0o600))
+
+	tests := []struct {
+		name    string
+		opts    Options
+		wantErr string
+	}{
+		{
+			name: "happy path: certificate only",
+			opts: Options{CertFile: filepath.Join(dir, "server.crt"), KeyFile: filepath.Join(dir, "server.key")},
+		},
+		{
+			name: "happy path: certificate and client CAs",
+			opts: Options{CertFile: filepath.Join(dir, "server.crt"), KeyFile: filepath.Join(dir, "server.key"), ClientCAFile: filepath.Join(dir, "ca.crt")},
+		},
+		{
+			name:    "error: missing certificate",
+			opts:    Options{CertFile: filepath.Join(dir, "missing.crt"), KeyFile: filepath.Join(dir, "server.key")},
+			wantErr: "loading certificate",
+		},
+		{
+			name:    "error: key not matching the certificate",
+			opts:    Options{CertFile: filepath.Join(dir, "server.crt"), KeyFile: filepath.Join(dir, "ca.key")},
+			wantErr: "loading certificate",
+		},
+		{
+			name:    "error: no client CA in the file",
+			opts:    Options{CertFile: filepath.Join(dir, "server.crt"), KeyFile: filepath.Join(dir, "server.key"), ClientCAFile: filepath.Join(dir, "empty.pem")},
+			wantErr: "loading client CAs: no certificate found",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			r, err := NewReloader(tt.opts)
+
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.NotNil(t, r.Config())
+		})
+	}
+}
+
+func Test_Reloader_Reload(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t)
+	ca.issue(t, dir, "server", "v1")
+
+	r, err := NewReloader(Options{CertFile: filepath.Join(dir, "server.crt"), KeyFile: filepath.Join(dir, "server.key")})
+	require.NoError(t, err)
+
+	serverName, _, err := handshake(t, r.Config(), ca.clientConfig(nil))
+	require.NoError(t, err)
+	assert.Equal(t, "v1", serverName)
+
+	// the new certificate is served after a reload
+	ca.issue(t, dir, "server", "v2")
+	require.NoError(t, r.Reload())
+
+	serverName, _, err = handshake(t, r.Config(), ca.clientConfig(nil))
+	require.NoError(t, err)
+	assert.Equal(t, "v2", serverName)
+
+	// an invalid certificate is refused, and the previous one is kept
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "server.crt"), []byte("garbage"), 0o600))
+	assert.Error(t, r.Reload())
+
+	serverName, _, err = handshake(t, r.Config(), ca.clientConfig(nil))
+	require.NoError(t, err)
+	assert.Equal(t, "v2", serverName)
+}
+
+func Test_Reloader_ClientCertificates(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t)
+	ca.issue(t, dir, "server", "server")
+	ca.writeCA(t, dir, "ca")
+	clientCert := ca.issue(t, dir, "client", "alice")
+	otherCert := newTestCA(t).issue(t, dir, "other", "mallory")
+
+	r, err := NewReloader(Options{
+		CertFile:     filepath.Join(dir, "server.crt"),
+		KeyFile:      filepath.Join(dir, "server.key"),
+		ClientCAFile: filepath.Join(dir, "ca.crt"),
+	})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name       string
+		clientCert *tls.Certificate
+		wantClient string
+		wantErr    bool
+	}{
+		{
+			name:       "happy path: certificate signed by the CA",
+			clientCert: clientCert,
+			wantClient: "alice",
+		},
+		{
+			name:    "error: no certificate",
+			wantErr: true,
+		},
+		{
+			name:       "error: certificate signed by another CA",
+			clientCert: otherCert,
+			wantErr:    true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			_, clientName, err := handshake(t, r.Config(), ca.clientConfig(tt.clientCert))
+
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantClient, clientName)
+		})
+	}
+}
+
+// handshake connects a client to a server with the given configs, returning the common names
+// of the certificates they presented, and the error of the server side, if any
+func handshake(t *testing.T, serverCfg *tls.Config, clientCfg *tls.Config) (string, string, error) {
+	t.Helper()
+
+	serverConn, clientConn := net.Pipe()
+	defer serverConn.Close()
+	defer clientConn.Close()
+
+	server := tls.Server(serverConn, serverCfg)
+	client := tls.Client(clientConn, clientCfg)
+
+	clientErr := make(chan error, 1)
+	go func() {
+		err := client.Handshake()
+		if err == nil {
+			// with TLS 1.3 the client learns its certificate was refused only when reading
+			_, err = client.Read(make([]byte, 1))
+		}
+		clientErr <- err
+	}()
+
+	err := server.Handshake()
+	if err == nil {
+		_, err = server.Write([]byte{0})
+	}
+	if err != nil {
+		clientConn.Close()
+		<-clientErr
+		return "", "", err
+	}
+	require.NoError(t, <-clientErr)
+
+	var clientName string
+	if peers := server.ConnectionState().PeerCertificates; len(peers) > 0 {
+		clientName = peers[0].Subject.CommonName
+	}
+
+	return client.ConnectionState().PeerCertificates[0].Subject.CommonName, clientName, nil
+}
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	return &testCA{cert: cert, key: key}
+}
+
+// issue writes a certificate signed by the CA, valid both as server (for localhost) and as client,
+// in <name>.crt and <name>.key
+func (ca *testCA) issue(t *testing.T, dir string, name string, commonName string) *tls.Certificate {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	require.NoError(t, err)
+
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})
+	require.NoError(t, os.WriteFile(filepath.Join(dir, name+".crt"), certPEM, 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, name+".key"), keyPEM, 0o600))
+
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	require.NoError(t, err)
+	return &cert
+}
+
+// writeCA writes the certificate of the CA in <name>.crt and its key in <name>.key
+func (ca *testCA) writeCA(t *testing.T, dir string, name string) {
+	t.Helper()
+
+	keyDER, err := x509.MarshalPKCS8PrivateKey(ca.key)
+	require.NoError(t, err)
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.cert.Raw})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})
+	require.NoError(t, os.WriteFile(filepath.Join(dir, name+".crt"), certPEM, 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, name+".key"), keyPEM, 0o600))
+}
+
+// clientConfig trusts the CA, presenting the given certificate if not nil
+func (ca *testCA) clientConfig(cert *tls.Certificate) *tls.Config {
+
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+
+	cfg := &tls.Config{RootCAs: pool, ServerName: "localhost"}
+	if cert != nil {
+		cfg.Certificates = []tls.Certificate{*cert}
+	}
+	return cfg
+}